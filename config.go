@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"tempLogger/types"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+const (
+	defaultBaud        = 9600
+	defaultFilePattern = "tempLogger-{date}.log"
+	// maxReadTimeout is the longest read timeout the serial driver
+	// supports, in seconds.
+	maxReadTimeout = 25
+)
+
+// legacyTLCfg is the flat configuration used before versions were added.
+type legacyTLCfg struct {
+	ID         string
+	SerialPath string
+	Baud       int
+	Retries    int
+}
+
+var baudRates = map[int]bool{
+	50: true, 75: true, 110: true, 134: true, 150: true, 200: true, 300: true, 600: true,
+	1200: true, 1800: true, 2400: true, 4800: true, 9600: true, 19200: true, 38400: true,
+	57600: true, 115200: true, 230400: true, 460800: true, 500000: true, 576000: true,
+	921600: true, 1000000: true, 1152000: true, 1500000: true, 2000000: true,
+	2500000: true, 3000000: true, 3500000: true, 4000000: true,
+}
+
+var parities = map[string]serial.Parity{
+	"":      serial.ParityNone,
+	"none":  serial.ParityNone,
+	"odd":   serial.ParityOdd,
+	"even":  serial.ParityEven,
+	"mark":  serial.ParityMark,
+	"space": serial.ParitySpace,
+}
+
+var stopBits = map[float32]serial.StopBits{
+	0:   serial.Stop1,
+	1:   serial.Stop1,
+	1.5: serial.Stop1Half,
+	2:   serial.Stop2,
+}
+
+// LoadTLCfg reads the configuration file and fills in its defaults.
+// Unknown fields are an error so a misspelled option is not silently
+// ignored.
+func LoadTLCfg(cfgPath string) (cfg types.TLCfg, err error) {
+	cfgBytes, err := os.ReadFile(cfgPath)
+	if err != nil {
+		err = fmt.Errorf("LoadTLCfg: Could not read file %s: %w", cfgPath, err)
+		return
+	}
+	if cfg, err = parseTLCfg(cfgBytes); err != nil {
+		err = fmt.Errorf("LoadTLCfg: %s: %w", cfgPath, err)
+	}
+	return
+}
+
+// parseTLCfg decodes a configuration of either version, returning it in the
+// current one.
+func parseTLCfg(cfgBytes []byte) (cfg types.TLCfg, err error) {
+	var probe struct {
+		Version int `json:"version"`
+	}
+	if err = json.Unmarshal(cfgBytes, &probe); err != nil {
+		err = fmt.Errorf("parseTLCfg: %w", err)
+		return
+	}
+	switch probe.Version {
+	case 0:
+		var legacy legacyTLCfg
+		if err = decodeStrict(cfgBytes, &legacy); err != nil {
+			return
+		}
+		cfg = types.TLCfg{
+			Version: types.TLCfgVersion,
+			ID:      legacy.ID,
+			Serial:  types.SerialCfg{Path: legacy.SerialPath, Baud: legacy.Baud, Retries: legacy.Retries},
+		}
+	case types.TLCfgVersion:
+		if err = decodeStrict(cfgBytes, &cfg); err != nil {
+			return
+		}
+	default:
+		err = fmt.Errorf("parseTLCfg: Unsupported version %d; expected %d", probe.Version, types.TLCfgVersion)
+		return
+	}
+	setTLDefaults(&cfg)
+	return
+}
+
+func decodeStrict(cfgBytes []byte, v any) (err error) {
+	dec := json.NewDecoder(bytes.NewReader(cfgBytes))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(v); err != nil {
+		err = fmt.Errorf("decodeStrict: %w", err)
+	}
+	return
+}
+
+func setTLDefaults(cfg *types.TLCfg) {
+	if cfg.Serial.Baud == 0 {
+		cfg.Serial.Baud = defaultBaud
+	}
+	if cfg.Serial.DataBits == 0 {
+		cfg.Serial.DataBits = serial.DefaultSize
+	}
+	if cfg.Output.FilePattern == "" {
+		cfg.Output.FilePattern = defaultFilePattern
+	}
+	if len(cfg.Sinks) == 0 {
+		cfg.Sinks = []types.SinkCfg{{Type: types.SinkFile}}
+	}
+	for i := range cfg.Sinks {
+		sink := &cfg.Sinks[i]
+		if sink.Type != types.SinkHTTP {
+			continue
+		}
+		if sink.Outbox == "" {
+			sink.Outbox = cfg.ID + ".outbox"
+		}
+		if sink.BatchSize == 0 {
+			sink.BatchSize = defaultBatchSize
+		}
+	}
+}
+
+// validateTLCfg reports every problem with cfg, not just the first.
+func validateTLCfg(cfg types.TLCfg) error {
+	var problems []error
+	add := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+	if !types.ValidSensorID(cfg.ID) {
+		add("id must be letters, digits and underscores, not starting with a digit: %q", cfg.ID)
+	}
+	if cfg.Site != "" && !types.ValidSite(cfg.Site) {
+		add("site must be letters, digits and single underscores: %q", cfg.Site)
+	}
+	if cfg.Serial.Path == "" {
+		add("serial.path is required")
+	}
+	if !baudRates[cfg.Serial.Baud] {
+		add("serial.baud is not a supported rate: %d", cfg.Serial.Baud)
+	}
+	if cfg.Serial.DataBits < 5 || cfg.Serial.DataBits > 8 {
+		add("serial.dataBits must be 5 to 8: %d", cfg.Serial.DataBits)
+	}
+	if _, ok := parities[cfg.Serial.Parity]; !ok {
+		add("serial.parity must be none, odd, even, mark or space: %q", cfg.Serial.Parity)
+	}
+	if _, ok := stopBits[cfg.Serial.StopBits]; !ok {
+		add("serial.stopBits must be 1, 1.5 or 2: %v", cfg.Serial.StopBits)
+	}
+	if cfg.Serial.ReadTimeoutSeconds < 0 || cfg.Serial.ReadTimeoutSeconds > maxReadTimeout {
+		add("serial.readTimeoutSeconds must be 0 to %d: %d", maxReadTimeout, cfg.Serial.ReadTimeoutSeconds)
+	}
+	if cfg.Serial.Retries < 0 {
+		add("serial.retries must not be negative: %d", cfg.Serial.Retries)
+	}
+	if err := types.ValidateFilePattern(cfg.Output.FilePattern); err != nil {
+		add("output.filePattern: %s", err.Error())
+	}
+	if _, err := outputLocation(cfg.Output); err != nil {
+		add("output.timezone is not a known zone: %q", cfg.Output.Timezone)
+	}
+	seen := make(map[string]bool, len(cfg.Sinks))
+	for _, sink := range cfg.Sinks {
+		switch sink.Type {
+		case types.SinkFile, types.SinkStdout:
+		case types.SinkHTTP:
+			if u, err := url.Parse(sink.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				add("sinks: http url must be an http or https address: %q", sink.URL)
+			}
+			if (sink.Cert == "") != (sink.Key == "") {
+				add("sinks: http cert and key must be set together")
+			}
+			if sink.BatchSize < 0 {
+				add("sinks: http batchSize must not be negative: %d", sink.BatchSize)
+			}
+		default:
+			add("sinks: Unknown type %q; must be %s, %s or %s", sink.Type, types.SinkFile, types.SinkStdout, types.SinkHTTP)
+			continue
+		}
+		if seen[sink.Type] {
+			add("sinks: Duplicate %s sink", sink.Type)
+		}
+		seen[sink.Type] = true
+	}
+	return errors.Join(problems...)
+}
+
+// checkTLCfgFiles reports the problems with the files cfg refers to, which
+// may be fixed without changing the configuration.
+func checkTLCfgFiles(cfg types.TLCfg) error {
+	var problems []error
+	if cfg.Serial.Path != "" {
+		if _, err := os.Stat(cfg.Serial.Path); err != nil {
+			problems = append(problems, fmt.Errorf("serial.path: %w", err))
+		}
+	}
+	dir := cfg.Output.Dir
+	if dir == "" {
+		dir = "."
+	}
+	if info, err := os.Stat(dir); err != nil {
+		problems = append(problems, fmt.Errorf("output.dir: %w", err))
+	} else if !info.IsDir() {
+		problems = append(problems, fmt.Errorf("output.dir is not a directory: %s", dir))
+	}
+	for _, sink := range cfg.Sinks {
+		if sink.Type != types.SinkHTTP {
+			continue
+		}
+		for _, file := range []string{sink.CA, sink.Cert, sink.Key} {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				problems = append(problems, fmt.Errorf("sinks: %w", err))
+			}
+		}
+		if _, err := os.Stat(filepath.Dir(sink.Outbox)); err != nil {
+			problems = append(problems, fmt.Errorf("sinks: http outbox: %w", err))
+		}
+	}
+	return errors.Join(problems...)
+}
+
+// serialConfig returns the settings to open the port with.
+func serialConfig(cfg types.SerialCfg) *serial.Config {
+	return &serial.Config{
+		Name:        cfg.Path,
+		Baud:        cfg.Baud,
+		Size:        byte(cfg.DataBits),
+		Parity:      parities[cfg.Parity],
+		StopBits:    stopBits[cfg.StopBits],
+		ReadTimeout: time.Duration(cfg.ReadTimeoutSeconds) * time.Second,
+	}
+}
+
+// outputLocation returns the zone days are taken in.
+func outputLocation(cfg types.OutputCfg) (loc *time.Location, err error) {
+	if cfg.Timezone == "" {
+		return time.Local, nil
+	}
+	if loc, err = time.LoadLocation(cfg.Timezone); err != nil {
+		err = fmt.Errorf("outputLocation: %w", err)
+	}
+	return
+}
+
+// logFileName returns the path of the file a reading of sensor id on host
+// taken at ts goes in.
+func logFileName(cfg types.OutputCfg, loc *time.Location, id string, host string, ts time.Time) string {
+	return filepath.Join(cfg.Dir, types.FormatFileName(cfg.FilePattern, id, host, ts.In(loc)))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+
+	"github.com/tarm/serial"
+)
+
+func TestLoadTLCfg(t *testing.T) {
+	cfg, err := LoadTLCfg("tempLogger.json")
+	if err != nil {
+		t.Fatalf("LoadTLCfg: %s", err.Error())
+	}
+	if err = validateTLCfg(cfg); err != nil {
+		t.Errorf("Example configuration invalid: %s", err.Error())
+	}
+	c := serialConfig(cfg.Serial)
+	if c.Name != "/dev/ttyACM0" || c.Baud != 9600 || c.Parity != serial.ParityNone || c.StopBits != serial.Stop1 || c.ReadTimeout != 20*time.Second {
+		t.Errorf("Unexpected serial settings: %+v", c)
+	}
+}
+
+func TestParseTLCfg(t *testing.T) {
+	// The original flat format still works, with defaults filled in
+	cfg, err := parseTLCfg([]byte(`{"ID": "sensor1", "SerialPath": "/dev/ttyACM0", "Baud": 9600, "Retries": 60}`))
+	if err != nil {
+		t.Fatalf("Legacy configuration: %s", err.Error())
+	}
+	if cfg.Version != types.TLCfgVersion || cfg.Serial.Path != "/dev/ttyACM0" || cfg.Serial.Retries != 60 ||
+		cfg.Output.FilePattern != defaultFilePattern || len(cfg.Sinks) != 1 || cfg.Sinks[0].Type != types.SinkFile {
+		t.Errorf("Unexpected legacy configuration: %+v", cfg)
+	}
+
+	for _, bad := range []string{
+		`{"ID": "sensor1", "SerialPth": "/dev/ttyACM0"}`,
+		`{"version": 2, "id": "sensor1", "serial": {"path": "/dev/ttyACM0", "baudRate": 9600}}`,
+		`{"version": 3, "id": "sensor1"}`,
+		`{"version": 2, "id": "sensor1"`,
+	} {
+		if _, err = parseTLCfg([]byte(bad)); err == nil {
+			t.Errorf("Expected %s to fail", bad)
+		}
+	}
+}
+
+func TestValidateTLCfg(t *testing.T) {
+	cfg, err := parseTLCfg([]byte(`{
+		"version": 2,
+		"id": "1st sensor",
+		"site": "my__cabin",
+		"serial": {"baud": 9601, "dataBits": 9, "parity": "odd-ish", "stopBits": 3, "readTimeoutSeconds": 30, "retries": -1},
+		"output": {"filePattern": "logs/{day}.log", "timezone": "Mars/Olympus_Mons"},
+		"sinks": [{"type": "file"}, {"type": "file"}, {"type": "kafka"}, {"type": "http", "url": "tlweb:8080", "key": "key.pem"}]
+	}`))
+	if err != nil {
+		t.Fatalf("parseTLCfg: %s", err.Error())
+	}
+	err = validateTLCfg(cfg)
+	if err == nil {
+		t.Fatal("Expected an invalid configuration")
+	}
+	// Every problem is reported, not just the first
+	for _, field := range []string{"id", "site", "serial.path", "serial.baud", "serial.dataBits", "serial.parity", "serial.stopBits",
+		"serial.readTimeoutSeconds", "serial.retries", "output.filePattern", "output.timezone", "Duplicate file", "kafka", "http url", "cert and key"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("No problem reported with %s", field)
+		}
+	}
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+	cfg := types.TLCfg{ID: "sensor1", Output: types.OutputCfg{Dir: dir, Timezone: "UTC"}}
+	setTLDefaults(&cfg)
+	sinks, err := newSinks(cfg, "pi")
+	if err != nil || len(sinks) != 1 {
+		t.Fatalf("newSinks: %d %v", len(sinks), err)
+	}
+	// 2024-01-14 23:30 in UTC-7 is already the 15th in UTC
+	ts := time.Date(2024, 1, 14, 23, 30, 0, 0, time.FixedZone("MST", -7*60*60))
+	line := []byte(`{"id":"sensor1"}` + "\n")
+	for i := 0; i < 2; i++ {
+		if err = sinks[0].Write(ts, line); err != nil {
+			t.Fatalf("Write: %s", err.Error())
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "tempLogger-20240115.log"))
+	if err != nil || string(data) != strings.Repeat(string(line), 2) {
+		t.Errorf("Unexpected log file: %q %v", data, err)
+	}
+
+	// Hourly files named for the sensor and machine
+	cfg.Output.FilePattern = "{host}-{id}-{date}T{hour}.log"
+	sinks, _ = newSinks(cfg, "pi")
+	if err = sinks[0].Write(ts, line); err != nil {
+		t.Fatalf("Write: %s", err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(dir, "pi-sensor1-20240115T06.log")); err != nil {
+		t.Errorf("No hourly file: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err = (writerSink{w: &buf}).Write(ts, line); err != nil || buf.String() != string(line) {
+		t.Errorf("Unexpected stream output: %q %v", buf.String(), err)
+	}
+}
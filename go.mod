@@ -5,6 +5,18 @@ go 1.21
 require (
 	github.com/mattn/go-sqlite3 v1.14.19
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	github.com/xitongsys/parquet-go v1.6.2
+	golang.org/x/crypto v0.17.0
+	golang.org/x/term v0.15.0
 )
 
-require golang.org/x/sys v0.0.0-20220503163025-988cb79eb6c6 // indirect
+require (
+	github.com/apache/arrow/go/arrow v0.0.0-20200730104253-651201b0f516 // indirect
+	github.com/apache/thrift v0.14.2 // indirect
+	github.com/golang/snappy v0.0.3 // indirect
+	github.com/klauspost/compress v1.13.1 // indirect
+	github.com/pierrec/lz4/v4 v4.1.8 // indirect
+	github.com/xitongsys/parquet-go-source v0.0.0-20200817004010-026bad9b25d0 // indirect
+	golang.org/x/sys v0.16.0 // indirect
+	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543 // indirect
+)
@@ -0,0 +1,336 @@
+// Package metrics keeps counters, gauges and histograms and serves them in
+// the Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets suit latencies in seconds from a millisecond to ten
+// seconds.
+var DefaultBuckets = []float64{0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Sample is one value of a metric computed at collection time.
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics served together.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: Duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteText writes every metric in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	metrics := append([]metric{}, r.metrics...)
+	r.mu.Unlock()
+	bw := bufio.NewWriter(w)
+	for _, m := range metrics {
+		m.write(bw)
+	}
+	return bw.Flush()
+}
+
+// Handler serves the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+// desc holds what every metric type shares.
+type desc struct {
+	name       string
+	help       string
+	metricType string
+	labelNames []string
+}
+
+func (d desc) writeHeader(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", d.name, escapeHelp(d.help))
+	fmt.Fprintf(w, "# TYPE %s %s\n", d.name, d.metricType)
+}
+
+// labels formats a label set, with any extra name and value appended.
+func (d desc) labels(values []string, extraName string, extraValue string) string {
+	if len(d.labelNames) == 0 && extraName == "" {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteByte('{')
+	for i, name := range d.labelNames {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(name + `="` + escapeLabel(values[i]) + `"`)
+	}
+	if extraName != "" {
+		if len(d.labelNames) > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(extraName + `="` + escapeLabel(extraValue) + `"`)
+	}
+	sb.WriteByte('}')
+	return sb.String()
+}
+
+func (d desc) key(values []string) string {
+	if len(values) != len(d.labelNames) {
+		panic(fmt.Sprintf("metrics: %s takes %d label values, not %d", d.name, len(d.labelNames), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// valueVec is a set of values keyed by label values, used by counters and
+// gauges.
+type valueVec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func newValueVec(d desc) *valueVec {
+	return &valueVec{desc: d, values: make(map[string]float64), labels: make(map[string][]string)}
+}
+
+func (vv *valueVec) update(fn func(float64) float64, labelValues []string) {
+	key := vv.key(labelValues)
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	if _, ok := vv.labels[key]; !ok {
+		vv.labels[key] = append([]string{}, labelValues...)
+	}
+	vv.values[key] = fn(vv.values[key])
+}
+
+func (vv *valueVec) get(labelValues []string) float64 {
+	vv.mu.Lock()
+	defer vv.mu.Unlock()
+	return vv.values[vv.key(labelValues)]
+}
+
+func (vv *valueVec) write(w *bufio.Writer) {
+	vv.mu.Lock()
+	samples := make([]Sample, 0, len(vv.values))
+	for key, val := range vv.values {
+		samples = append(samples, Sample{LabelValues: vv.labels[key], Value: val})
+	}
+	vv.mu.Unlock()
+	if len(samples) == 0 && len(vv.labelNames) == 0 {
+		samples = append(samples, Sample{})
+	}
+	writeSamples(w, vv.desc, samples)
+}
+
+func writeSamples(w *bufio.Writer, d desc, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return slices.Compare(samples[i].LabelValues, samples[j].LabelValues) < 0
+	})
+	d.writeHeader(w)
+	for _, sample := range samples {
+		fmt.Fprintf(w, "%s%s %s\n", d.name, d.labels(sample.LabelValues, "", ""), formatValue(sample.Value))
+	}
+}
+
+// Counter is a value that only increases.
+type Counter struct {
+	vec *valueVec
+}
+
+// NewCounter registers a counter with the given label names.
+func (r *Registry) NewCounter(name string, help string, labelNames ...string) *Counter {
+	c := &Counter{newValueVec(desc{name, help, "counter", labelNames})}
+	r.register(name, c.vec)
+	return c
+}
+
+// Inc adds one to the counter with the given label values.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative amount to the counter with the given label values.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		panic("metrics: Counter " + c.vec.name + " cannot decrease")
+	}
+	c.vec.update(func(old float64) float64 { return old + v }, labelValues)
+}
+
+// Value returns the count with the given label values.
+func (c *Counter) Value(labelValues ...string) float64 {
+	return c.vec.get(labelValues)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	vec *valueVec
+}
+
+// NewGauge registers a gauge with the given label names.
+func (r *Registry) NewGauge(name string, help string, labelNames ...string) *Gauge {
+	g := &Gauge{newValueVec(desc{name, help, "gauge", labelNames})}
+	r.register(name, g.vec)
+	return g
+}
+
+// Set sets the gauge with the given label values.
+func (g *Gauge) Set(v float64, labelValues ...string) {
+	g.vec.update(func(float64) float64 { return v }, labelValues)
+}
+
+// Add changes the gauge with the given label values by v.
+func (g *Gauge) Add(v float64, labelValues ...string) {
+	g.vec.update(func(old float64) float64 { return old + v }, labelValues)
+}
+
+// Value returns the gauge with the given label values.
+func (g *Gauge) Value(labelValues ...string) float64 {
+	return g.vec.get(labelValues)
+}
+
+// gaugeFunc computes its samples when collected.
+type gaugeFunc struct {
+	desc
+	fn func() []Sample
+}
+
+// NewGaugeFunc registers a gauge whose samples are computed by fn each time
+// the registry is written.
+func (r *Registry) NewGaugeFunc(name string, help string, labelNames []string, fn func() []Sample) {
+	r.register(name, &gaugeFunc{desc{name, help, "gauge", labelNames}, fn})
+}
+
+func (gf *gaugeFunc) write(w *bufio.Writer) {
+	writeSamples(w, gf.desc, gf.fn())
+}
+
+// Histogram counts observations in cumulative buckets.
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	count       uint64
+	sum         float64
+}
+
+// NewHistogram registers a histogram with the given upper bucket bounds,
+// which must be sorted, and label names.
+func (r *Registry) NewHistogram(name string, help string, buckets []float64, labelNames ...string) *Histogram {
+	h := &Histogram{
+		desc:    desc{name, help, "histogram", labelNames},
+		buckets: buckets,
+		series:  make(map[string]*histogramSeries),
+	}
+	r.register(name, h)
+	return h
+}
+
+// Observe adds a value to the histogram with the given label values.
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hs, ok := h.series[key]
+	if !ok {
+		hs = &histogramSeries{labelValues: append([]string{}, labelValues...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = hs
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hs.counts[i]++
+		}
+	}
+	hs.count++
+	hs.sum += v
+}
+
+// Count returns the number of observations with the given label values.
+func (h *Histogram) Count(labelValues ...string) uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if hs, ok := h.series[h.key(labelValues)]; ok {
+		return hs.count
+	}
+	return 0
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series := make([]*histogramSeries, 0, len(h.series))
+	for _, hs := range h.series {
+		series = append(series, hs)
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return slices.Compare(series[i].labelValues, series[j].labelValues) < 0
+	})
+	h.writeHeader(w)
+	for _, hs := range series {
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(hs.labelValues, "le", formatValue(bound)), hs.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labels(hs.labelValues, "le", "+Inf"), hs.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labels(hs.labelValues, "", ""), formatValue(hs.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labels(hs.labelValues, "", ""), hs.count)
+	}
+}
@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounter("http_requests_total", "HTTP requests.", "handler", "code")
+	errors := r.NewCounter("errors_total", "Errors.")
+	temp := r.NewGauge("temperature_celsius", "Temperature.", "sensor")
+	latency := r.NewHistogram("query_seconds", "Query latency.", []float64{0.1, 1}, "op")
+	r.NewGaugeFunc("up", "Whether the sensor is reporting.", []string{"sensor"}, func() []Sample {
+		return []Sample{{LabelValues: []string{"b"}, Value: 0}, {LabelValues: []string{"a"}, Value: 1}}
+	})
+
+	requests.Inc("/", "200")
+	requests.Inc("/", "200")
+	requests.Inc("/api", "404")
+	temp.Set(-2.5, `back "yard"`)
+	latency.Observe(0.05, "read")
+	latency.Observe(0.5, "read")
+	latency.Observe(5, "read")
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: %s", err.Error())
+	}
+	expected := `# HELP http_requests_total HTTP requests.
+# TYPE http_requests_total counter
+http_requests_total{handler="/",code="200"} 2
+http_requests_total{handler="/api",code="404"} 1
+# HELP errors_total Errors.
+# TYPE errors_total counter
+errors_total 0
+# HELP temperature_celsius Temperature.
+# TYPE temperature_celsius gauge
+temperature_celsius{sensor="back \"yard\""} -2.5
+# HELP query_seconds Query latency.
+# TYPE query_seconds histogram
+query_seconds_bucket{op="read",le="0.1"} 1
+query_seconds_bucket{op="read",le="1"} 2
+query_seconds_bucket{op="read",le="+Inf"} 3
+query_seconds_sum{op="read"} 5.55
+query_seconds_count{op="read"} 3
+# HELP up Whether the sensor is reporting.
+# TYPE up gauge
+up{sensor="a"} 1
+up{sensor="b"} 0
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s\nExpected:\n%s", buf.String(), expected)
+	}
+	if requests.Value("/", "200") != 2 || errors.Value() != 0 || latency.Count("read") != 3 {
+		t.Error("Unexpected values")
+	}
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") || w.Body.String() != expected {
+		t.Error("Unexpected handler response")
+	}
+}
+
+func TestMisuse(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounter("c_total", "C.", "label")
+	for name, fn := range map[string]func(){
+		"duplicate":   func() { r.NewGauge("c_total", "Again.") },
+		"label count": func() { c.Inc() },
+		"decrease":    func() { c.Add(-1, "x") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: Expected a panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
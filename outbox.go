@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Outbox is a durable queue of the readings tlweb has not acknowledged: a
+// file of lines, appended to as readings arrive, and the offset of the first
+// line not yet acknowledged, kept in a second file beside it.
+type Outbox struct {
+	path string
+	mu   sync.Mutex
+	f    *os.File
+	// offset is where the unacknowledged lines start and size where they
+	// end.
+	offset  int64
+	size    int64
+	pending int
+}
+
+// OpenOutbox opens the outbox at path, creating it if needed.  A line left
+// unfinished by a crash is dropped.
+func OpenOutbox(path string) (ob *Outbox, err error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		err = fmt.Errorf("OpenOutbox: %w", err)
+		return
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		f.Close() // ignore error; Read error takes precedence
+		err = fmt.Errorf("OpenOutbox: Error reading %s: %w", path, err)
+		return
+	}
+	size := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if size < int64(len(data)) {
+		if err = f.Truncate(size); err != nil {
+			f.Close() // ignore error; Truncate error takes precedence
+			err = fmt.Errorf("OpenOutbox: Error dropping unfinished line of %s: %w", path, err)
+			return
+		}
+	}
+	ob = &Outbox{path: path, f: f, size: size}
+	// A missing or damaged offset sends everything again, which tlweb
+	// counts as duplicates
+	if offsetBytes, rerr := os.ReadFile(ob.offsetPath()); rerr == nil {
+		offset, perr := strconv.ParseInt(strings.TrimSpace(string(offsetBytes)), 10, 64)
+		if perr == nil && offset >= 0 && offset <= size && (offset == 0 || data[offset-1] == '\n') {
+			ob.offset = offset
+		}
+	}
+	ob.pending = bytes.Count(data[ob.offset:size], []byte{'\n'})
+	return
+}
+
+func (ob *Outbox) offsetPath() string {
+	return ob.path + ".offset"
+}
+
+// Append adds line, which ends in a newline, to the end of the queue,
+// returning once it is on disk.
+func (ob *Outbox) Append(line []byte) (err error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if _, err = ob.f.WriteAt(line, ob.size); err != nil {
+		err = fmt.Errorf("Append: Error writing to %s: %w", ob.path, err)
+		return
+	}
+	if err = ob.f.Sync(); err != nil {
+		err = fmt.Errorf("Append: Error syncing %s: %w", ob.path, err)
+		return
+	}
+	ob.size += int64(len(line))
+	ob.pending++
+	return
+}
+
+// Peek returns up to max of the oldest lines not yet acknowledged, each
+// ending in a newline.
+func (ob *Outbox) Peek(max int) (lines [][]byte, err error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	reader := bufio.NewReader(io.NewSectionReader(ob.f, ob.offset, ob.size-ob.offset))
+	for len(lines) < max {
+		line, rerr := reader.ReadBytes('\n')
+		if rerr == io.EOF {
+			break
+		}
+		if rerr != nil {
+			err = fmt.Errorf("Peek: Error reading %s: %w", ob.path, rerr)
+			return
+		}
+		lines = append(lines, line)
+	}
+	return
+}
+
+// Ack removes lines, the oldest ones returned by Peek, from the queue.  The
+// file is emptied once every line is acknowledged.
+func (ob *Outbox) Ack(lines [][]byte) (err error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	offset := ob.offset
+	for _, line := range lines {
+		offset += int64(len(line))
+	}
+	pending := ob.pending - len(lines)
+	if pending == 0 {
+		// Truncate before the offset is reset, so a crash in between
+		// leaves an offset past the end, which is ignored
+		if err = ob.f.Truncate(0); err != nil {
+			err = fmt.Errorf("Ack: Error emptying %s: %w", ob.path, err)
+			return
+		}
+		ob.size, offset = 0, 0
+	}
+	if err = writeFileAtomic(ob.offsetPath(), []byte(strconv.FormatInt(offset, 10)+"\n")); err != nil {
+		err = fmt.Errorf("Ack: %w", err)
+		return
+	}
+	ob.offset, ob.pending = offset, pending
+	return
+}
+
+// Reject keeps lines that tlweb refused in a file beside the outbox, named
+// by RejectedPath, for someone to look at.  They must still be
+// acknowledged.
+func (ob *Outbox) Reject(lines [][]byte) (err error) {
+	f, err := os.OpenFile(ob.RejectedPath(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		err = fmt.Errorf("Reject: %w", err)
+		return
+	}
+	if _, err = f.Write(bytes.Join(lines, nil)); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		err = fmt.Errorf("Reject: Error writing %s: %w", ob.RejectedPath(), err)
+	}
+	return
+}
+
+// RejectedPath is the file of the lines tlweb refused.
+func (ob *Outbox) RejectedPath() string {
+	return ob.path + ".rejected"
+}
+
+// Len returns the number of lines not yet acknowledged.
+func (ob *Outbox) Len() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.pending
+}
+
+func (ob *Outbox) Close() error {
+	return ob.f.Close()
+}
+
+// writeFileAtomic replaces the file at path with data, leaving either the
+// old or the new contents after a crash.
+func writeFileAtomic(path string, data []byte) (err error) {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		err = fmt.Errorf("writeFileAtomic: %w", err)
+		return
+	}
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp) // ignore error; Write error takes precedence
+		err = fmt.Errorf("writeFileAtomic: Error writing %s: %w", tmp, err)
+		return
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		err = fmt.Errorf("writeFileAtomic: %w", err)
+	}
+	return
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"tempLogger/sdnotify"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	defaultBatchSize = 500
+	// sendTimeout limits each request to tlweb.
+	sendTimeout = 30 * time.Second
+	// minRetry and maxRetry bound the wait after a failed send, which
+	// doubles each time tlweb cannot be reached.
+	minRetry = 5 * time.Second
+	maxRetry = 5 * time.Minute
+)
+
+// httpSink keeps readings in an outbox until tlweb acknowledges them, so a
+// logger on an unreliable network loses nothing while it is cut off.
+type httpSink struct {
+	url       string
+	token     string
+	client    *http.Client
+	outbox    *Outbox
+	batchSize int
+	// notify wakes Run when a reading is added.
+	notify chan struct{}
+}
+
+func newHTTPSink(cfg types.SinkCfg) (hs *httpSink, err error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CA != "" {
+		var caPEM []byte
+		if caPEM, err = os.ReadFile(cfg.CA); err != nil {
+			err = fmt.Errorf("newHTTPSink: %w", err)
+			return
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(caPEM) {
+			err = fmt.Errorf("newHTTPSink: No certificates in %s", cfg.CA)
+			return
+		}
+	}
+	if cfg.Cert != "" {
+		var cert tls.Certificate
+		if cert, err = tls.LoadX509KeyPair(cfg.Cert, cfg.Key); err != nil {
+			err = fmt.Errorf("newHTTPSink: %w", err)
+			return
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	outbox, err := OpenOutbox(cfg.Outbox)
+	if err != nil {
+		err = fmt.Errorf("newHTTPSink: %w", err)
+		return
+	}
+	hs = &httpSink{
+		url:   strings.TrimRight(cfg.URL, "/") + types.IngestPath,
+		token: cfg.Token,
+		client: &http.Client{
+			Timeout:   sendTimeout,
+			Transport: &http.Transport{Proxy: http.ProxyFromEnvironment, TLSClientConfig: tlsConfig},
+		},
+		outbox:    outbox,
+		batchSize: cfg.BatchSize,
+		notify:    make(chan struct{}, 1),
+	}
+	outboxReadings.Set(float64(outbox.Len()))
+	if outbox.Len() > 0 {
+		log.Println("httpSink:", outbox.Len(), "readings waiting to send to", hs.url)
+		hs.notify <- struct{}{}
+	}
+	return
+}
+
+// Write queues a reading, which is sent by Run.
+func (hs *httpSink) Write(ts time.Time, line []byte) (err error) {
+	if err = hs.outbox.Append(line); err != nil {
+		err = fmt.Errorf("httpSink: %w", err)
+		return
+	}
+	outboxReadings.Set(float64(hs.outbox.Len()))
+	select {
+	case hs.notify <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// Run sends the outbox to tlweb whenever readings are added, retrying with
+// a growing delay while tlweb cannot be reached.
+func (hs *httpSink) Run() {
+	retry := minRetry
+	failing := false
+	for range hs.notify {
+		for {
+			wait, err := hs.push()
+			if err == nil {
+				break
+			}
+			sendErrors.Inc()
+			waiting := fmt.Sprintf("%d readings waiting to send to %s", hs.outbox.Len(), hs.url)
+			log.Printf("httpSink: %s; %s\n", err.Error(), waiting)
+			if !failing {
+				sdnotify.Notify(sdnotify.Status(waiting))
+				failing = true
+			}
+			if wait == 0 {
+				wait = retry
+				retry = min(retry*2, maxRetry)
+			}
+			time.Sleep(wait)
+		}
+		if failing {
+			log.Println("httpSink: Caught up with", hs.url)
+			sdnotify.Notify(sdnotify.Status("Caught up with " + hs.url))
+			failing = false
+		}
+		retry = minRetry
+	}
+}
+
+// push sends batches until the outbox is empty or a send fails.  wait is
+// how long tlweb asked to be left alone, if it did.
+func (hs *httpSink) push() (wait time.Duration, err error) {
+	for {
+		var lines [][]byte
+		if lines, err = hs.outbox.Peek(hs.batchSize); err != nil || len(lines) == 0 {
+			return
+		}
+		var acked int
+		var rejected [][]byte
+		acked, rejected, wait, err = hs.send(lines)
+		if len(rejected) > 0 {
+			// Refused for good, so they are kept aside rather than lost
+			if rerr := hs.outbox.Reject(rejected); rerr != nil {
+				err = errors.Join(err, rerr)
+				return
+			}
+			log.Println("httpSink: tlweb rejected", len(rejected), "readings; kept in", hs.outbox.RejectedPath())
+			readingsRejected.Add(float64(len(rejected)))
+		}
+		if acked > 0 {
+			if aerr := hs.outbox.Ack(lines[:acked]); aerr != nil {
+				err = errors.Join(err, aerr)
+				return
+			}
+			readingsSent.Add(float64(acked))
+			outboxReadings.Set(float64(hs.outbox.Len()))
+		}
+		if errors.Is(err, errBatchTooLarge) && hs.batchSize > 1 {
+			hs.batchSize = max(hs.batchSize/2, 1)
+			log.Println("httpSink: Batch too large; sending", hs.batchSize, "readings at a time")
+			continue
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+var errBatchTooLarge = errors.New("Batch too large")
+
+// send posts lines to tlweb, returning how many of them it acknowledged
+// and which of those it rejected.
+func (hs *httpSink) send(lines [][]byte) (acked int, rejected [][]byte, wait time.Duration, err error) {
+	req, err := http.NewRequest(http.MethodPost, hs.url, bytes.NewReader(bytes.Join(lines, nil)))
+	if err != nil {
+		err = fmt.Errorf("send: %w", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if hs.token != "" {
+		req.Header.Set("Authorization", "Bearer "+hs.token)
+	}
+	resp, err := hs.client.Do(req)
+	if err != nil {
+		err = fmt.Errorf("send: %w", err)
+		return
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		err = fmt.Errorf("send: Error reading response: %w", err)
+		return
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		var result types.IngestResult
+		if err = json.Unmarshal(body, &result); err != nil {
+			err = fmt.Errorf("send: Error parsing acknowledgement: %w", err)
+			return
+		}
+		acked = min(result.Acked, len(lines))
+		if acked == 0 {
+			err = errors.New("send: No readings acknowledged")
+			return
+		}
+		for _, n := range result.RejectedLines {
+			if n >= 1 && n <= acked {
+				log.Printf("httpSink: tlweb rejected line %d: %s", n, bytes.TrimSpace(lines[n-1]))
+				rejected = append(rejected, lines[n-1])
+			}
+		}
+		return
+	case http.StatusRequestEntityTooLarge:
+		err = fmt.Errorf("send: %w: %d readings", errBatchTooLarge, len(lines))
+		return
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if seconds, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil && seconds > 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+	}
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	json.Unmarshal(body, &apiErr) // ignore error; the status says enough
+	err = fmt.Errorf("send: %s: %s", resp.Status, apiErr.Error)
+	return
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestOutbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sensor1.outbox")
+	ob, err := OpenOutbox(path)
+	if err != nil {
+		t.Fatalf("OpenOutbox: %s", err.Error())
+	}
+	for _, line := range []string{"1\n", "2\n", "3\n"} {
+		if err = ob.Append([]byte(line)); err != nil {
+			t.Fatalf("Append: %s", err.Error())
+		}
+	}
+	lines, err := ob.Peek(2)
+	if err != nil || len(lines) != 2 || string(lines[1]) != "2\n" {
+		t.Fatalf("Peek: %q %v", lines, err)
+	}
+	if err = ob.Ack(lines[:1]); err != nil {
+		t.Fatalf("Ack: %s", err.Error())
+	}
+	ob.Close()
+
+	// A crash in the middle of a line loses only that line
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString("4")
+	f.Close()
+	if ob, err = OpenOutbox(path); err != nil {
+		t.Fatalf("OpenOutbox: %s", err.Error())
+	}
+	if ob.Len() != 2 {
+		t.Errorf("Expected 2 readings after reopening, got %d", ob.Len())
+	}
+	ob.Append([]byte("5\n"))
+	lines, _ = ob.Peek(10)
+	if strings.Join(toStrings(lines), "") != "2\n3\n5\n" {
+		t.Errorf("Unexpected readings: %q", lines)
+	}
+
+	// Acknowledging everything empties the file
+	if err = ob.Ack(lines); err != nil {
+		t.Fatalf("Ack: %s", err.Error())
+	}
+	ob.Close()
+	if info, _ := os.Stat(path); info.Size() != 0 {
+		t.Errorf("Expected an empty outbox, got %d bytes", info.Size())
+	}
+	if ob, _ = OpenOutbox(path); ob.Len() != 0 {
+		t.Errorf("Expected no readings, got %d", ob.Len())
+	}
+	ob.Close()
+}
+
+func toStrings(lines [][]byte) (s []string) {
+	for _, line := range lines {
+		s = append(s, string(line))
+	}
+	return
+}
+
+func TestHTTPSink(t *testing.T) {
+	var received []string
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != types.IngestPath || req.Header.Get("Authorization") != "Bearer tlw_secret" {
+			t.Errorf("Unexpected request: %s %v", req.URL.Path, req.Header)
+		}
+		if status != http.StatusOK {
+			w.Header().Set("Retry-After", "7")
+			w.WriteHeader(status)
+			return
+		}
+		var result types.IngestResult
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			// Only the first two of each batch are acknowledged
+			if result.Acked == 2 {
+				break
+			}
+			received = append(received, scanner.Text())
+			result.Acked++
+			if scanner.Text() == "bad" {
+				result.Rejected++
+				result.RejectedLines = append(result.RejectedLines, result.Acked)
+			}
+		}
+		json.NewEncoder(w).Encode(result)
+	}))
+	defer server.Close()
+
+	cfg := types.TLCfg{ID: "sensor1", Sinks: []types.SinkCfg{{
+		Type: types.SinkHTTP, URL: server.URL + "/", Token: "tlw_secret",
+		Outbox: filepath.Join(t.TempDir(), "sensor1.outbox"), BatchSize: 3,
+	}}}
+	setTLDefaults(&cfg)
+	sinks, err := newSinks(cfg, "pi")
+	if err != nil {
+		t.Fatalf("newSinks: %s", err.Error())
+	}
+	hs := sinks[0].(*httpSink)
+	for _, line := range []string{"1", "2", "bad", "4", "5"} {
+		if err = hs.Write(time.Now(), []byte(line+"\n")); err != nil {
+			t.Fatalf("Write: %s", err.Error())
+		}
+	}
+
+	// Nothing is lost while tlweb is unavailable
+	wait, err := hs.push()
+	if err == nil || wait != 7*time.Second || hs.outbox.Len() != 5 {
+		t.Errorf("Expected a failure with the outbox kept, got %v %s %d", err, wait, hs.outbox.Len())
+	}
+
+	status = http.StatusOK
+	if _, err = hs.push(); err != nil {
+		t.Fatalf("push: %s", err.Error())
+	}
+	if strings.Join(received, "") != "12bad45" || hs.outbox.Len() != 0 {
+		t.Errorf("Unexpected readings sent: %v, %d waiting", received, hs.outbox.Len())
+	}
+	// The rejected reading is kept rather than lost
+	if rejected, err := os.ReadFile(hs.outbox.RejectedPath()); err != nil || string(rejected) != "bad\n" {
+		t.Errorf("Expected the rejected reading to be kept, got %q %v", rejected, err)
+	}
+}
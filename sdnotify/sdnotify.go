@@ -0,0 +1,97 @@
+// Package sdnotify tells systemd about the state of a service over the
+// socket named by NOTIFY_SOCKET, as sd_notify(3) does.  Outside of a
+// Type=notify unit every call does nothing.
+package sdnotify
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	// Ready reports that startup has finished.
+	Ready = "READY=1"
+	// Stopping reports that the service is shutting down.
+	Stopping = "STOPPING=1"
+	// Watchdog resets the watchdog timer.
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status returns a state that shows msg in systemctl status.
+func Status(msg string) string {
+	return "STATUS=" + msg
+}
+
+// Notify sends state to systemd.  sent is false if NOTIFY_SOCKET is not set.
+func Notify(state string) (sent bool, err error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return
+	}
+	// A leading @ names a socket in the abstract namespace
+	if socket[0] == '@' {
+		socket = "\x00" + socket[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		err = fmt.Errorf("Notify: Error connecting to %s: %w", socket, err)
+		return
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte(state)); err != nil {
+		err = fmt.Errorf("Notify: Error writing to %s: %w", socket, err)
+		return
+	}
+	sent = true
+	return
+}
+
+// WatchdogInterval returns the WatchdogSec of the unit, or 0 if the
+// watchdog is not enabled for this process.
+func WatchdogInterval() (interval time.Duration, err error) {
+	usec := os.Getenv("WATCHDOG_USEC")
+	if usec == "" {
+		return
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return
+	}
+	n, err := strconv.ParseInt(usec, 10, 64)
+	if err != nil || n <= 0 {
+		err = fmt.Errorf("WatchdogInterval: Invalid WATCHDOG_USEC: %s", usec)
+		return
+	}
+	interval = time.Duration(n) * time.Microsecond
+	return
+}
+
+// RunWatchdog pings the watchdog at half its interval for as long as the
+// service is running, skipping pings while healthy returns an error so that
+// systemd restarts a stalled service.  It returns at once if the watchdog
+// is not enabled.
+func RunWatchdog(healthy func() error) {
+	interval, err := WatchdogInterval()
+	if err != nil {
+		log.Println("RunWatchdog:", err.Error())
+		return
+	}
+	if interval == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for range ticker.C {
+		if herr := healthy(); herr != nil {
+			log.Println("RunWatchdog: Unhealthy, not pinging the watchdog:", herr.Error())
+			Notify(Status("Unhealthy: " + herr.Error()))
+			continue
+		}
+		if _, err = Notify(Watchdog); err != nil {
+			log.Println("RunWatchdog:", err.Error())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package sdnotify
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	sent, err := Notify(Ready)
+	if sent || err != nil {
+		t.Errorf("Expected nothing sent without NOTIFY_SOCKET: %v %v", sent, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("Could not listen on %s: %s", path, err.Error())
+	}
+	defer conn.Close()
+	t.Setenv("NOTIFY_SOCKET", path)
+	sent, err = Notify(Ready)
+	if !sent || err != nil {
+		t.Fatalf("Notify failed: %v %v", sent, err)
+	}
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	buf := make([]byte, 64)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("Could not read notification: %s", err.Error())
+	}
+	if string(buf[:n]) != Ready {
+		t.Errorf("Unexpected notification: %q", buf[:n])
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	for _, test := range []struct {
+		usec     string
+		pid      string
+		interval time.Duration
+		fail     bool
+	}{
+		{"", "", 0, false},
+		{"30000000", "", 30 * time.Second, false},
+		{"30000000", strconv.Itoa(os.Getpid()), 30 * time.Second, false},
+		{"30000000", strconv.Itoa(os.Getpid() + 1), 0, false},
+		{"soon", "", 0, true},
+	} {
+		t.Setenv("WATCHDOG_USEC", test.usec)
+		t.Setenv("WATCHDOG_PID", test.pid)
+		interval, err := WatchdogInterval()
+		if interval != test.interval || (err != nil) != test.fail {
+			t.Errorf("%s/%s: Unexpected result %s, %v", test.usec, test.pid, interval, err)
+		}
+	}
+}
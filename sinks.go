@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"tempLogger/types"
+	"time"
+)
+
+// Sink is a destination of the readings.  line is the reading as a line of
+// JSON, ending in a newline.
+type Sink interface {
+	Write(ts time.Time, line []byte) error
+}
+
+// fileSink appends readings to the log file of their day, or hour, which
+// tlweb loads once it is moved into a directory it watches.
+type fileSink struct {
+	output types.OutputCfg
+	loc    *time.Location
+	id     string
+	host   string
+}
+
+func (fs fileSink) Write(ts time.Time, line []byte) (err error) {
+	fileName := logFileName(fs.output, fs.loc, fs.id, fs.host, ts)
+	f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		err = fmt.Errorf("fileSink: Error opening file %s: %w", fileName, err)
+		return
+	}
+	if _, err = f.Write(line); err != nil {
+		f.Close() // ignore error; Write error takes precedence
+		err = fmt.Errorf("fileSink: Error writing to file %s: %w", fileName, err)
+		return
+	}
+	if err = f.Close(); err != nil {
+		err = fmt.Errorf("fileSink: Error closing file %s: %w", fileName, err)
+	}
+	return
+}
+
+// writerSink writes readings to a stream such as stdout, for the journal
+// or a pipe.
+type writerSink struct {
+	w io.Writer
+}
+
+func (ws writerSink) Write(ts time.Time, line []byte) (err error) {
+	if _, err = ws.w.Write(line); err != nil {
+		err = fmt.Errorf("writerSink: %w", err)
+	}
+	return
+}
+
+// newSinks creates the sinks of a validated configuration.  host names the
+// machine in log file names.
+func newSinks(cfg types.TLCfg, host string) (sinks []Sink, err error) {
+	for _, sinkCfg := range cfg.Sinks {
+		switch sinkCfg.Type {
+		case types.SinkFile:
+			var loc *time.Location
+			if loc, err = outputLocation(cfg.Output); err != nil {
+				err = fmt.Errorf("newSinks: %w", err)
+				return
+			}
+			sinks = append(sinks, fileSink{output: cfg.Output, loc: loc, id: cfg.ID, host: host})
+		case types.SinkStdout:
+			sinks = append(sinks, writerSink{w: os.Stdout})
+		case types.SinkHTTP:
+			var hs *httpSink
+			if hs, err = newHTTPSink(sinkCfg); err != nil {
+				err = fmt.Errorf("newSinks: %w", err)
+				return
+			}
+			sinks = append(sinks, hs)
+		default:
+			err = fmt.Errorf("newSinks: Unknown sink type %s", sinkCfg.Type)
+			return
+		}
+	}
+	return
+}
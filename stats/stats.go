@@ -0,0 +1,246 @@
+// Package stats computes statistics of readings taken at irregular times.
+// Each reading is weighted by the time it stands for, so a burst of
+// readings does not outweigh sparse ones and gaps are left out.
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Sample is a value read at Time.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Span is a value held from Start to End.
+type Span struct {
+	Start time.Time
+	End   time.Time
+	Value float64
+}
+
+// Run is a continuous time, without gaps, from Start to End.
+type Run struct {
+	Start time.Time
+	End   time.Time
+}
+
+// Window holds the samples of a series and computes statistics over the
+// time from Start to End.  Each sample stands for the time until the next
+// one, unless they are more than MaxGap apart, when it stands for Interval,
+// as does the last.  Only the time inside the window counts.
+type Window struct {
+	Start    time.Time
+	End      time.Time
+	Interval time.Duration
+	MaxGap   time.Duration
+	// spans are held by the samples, in time order, and shared by slices
+	// of the window.
+	spans []Span
+	// open is set while the last span waits for the next sample to end it.
+	open bool
+}
+
+// NewWindow covers start to end.  A maxGap shorter than interval is taken to
+// be interval.
+func NewWindow(start time.Time, end time.Time, interval time.Duration, maxGap time.Duration) *Window {
+	return &Window{Start: start, End: end, Interval: interval, MaxGap: max(maxGap, interval)}
+}
+
+// Add adds value, sampled at t, which must not be before the samples added
+// already.  A sample before Start counts only for the time it holds into
+// the window, and a sample at End or later only ends the one before.
+func (w *Window) Add(t time.Time, value float64) {
+	if w.open {
+		last := &w.spans[len(w.spans)-1]
+		if t.Sub(last.Start) <= w.MaxGap {
+			last.End = t
+		}
+		w.open = false
+	}
+	if !t.Before(w.End) {
+		return
+	}
+	w.spans = append(w.spans, Span{Start: t, End: t.Add(w.Interval), Value: value})
+	w.open = true
+}
+
+// Slice returns the part of w from start to end, which shares its samples.
+// Samples are no longer added to the slice.
+func (w *Window) Slice(start time.Time, end time.Time) *Window {
+	lo := sort.Search(len(w.spans), func(i int) bool { return w.spans[i].End.After(start) })
+	hi := sort.Search(len(w.spans), func(i int) bool { return !w.spans[i].Start.Before(end) })
+	if hi < lo {
+		hi = lo
+	}
+	return &Window{Start: start, End: end, Interval: w.Interval, MaxGap: w.MaxGap, spans: w.spans[lo:hi]}
+}
+
+// Spans returns the spans held by the samples, cut to the window.
+func (w *Window) Spans() (spans []Span) {
+	for _, span := range w.spans {
+		if span.Start.Before(w.Start) {
+			span.Start = w.Start
+		}
+		if span.End.After(w.End) {
+			span.End = w.End
+		}
+		if span.Start.Before(span.End) {
+			spans = append(spans, span)
+		}
+	}
+	return
+}
+
+// Count returns the number of samples taken inside the window.
+func (w *Window) Count() (count int) {
+	for _, span := range w.spans {
+		if w.inside(span.Start) {
+			count++
+		}
+	}
+	return
+}
+
+func (w *Window) inside(t time.Time) bool {
+	return !t.Before(w.Start) && t.Before(w.End)
+}
+
+// Min and Max return the first of the lowest and highest samples taken
+// inside the window, and Last the newest.  They are zero if there are none.
+func (w *Window) Min() Sample {
+	return w.extreme(func(a, b float64) bool { return a < b })
+}
+
+func (w *Window) Max() Sample {
+	return w.extreme(func(a, b float64) bool { return a > b })
+}
+
+func (w *Window) Last() Sample {
+	return w.extreme(func(a, b float64) bool { return true })
+}
+
+// extreme returns the sample inside the window that no later one is better
+// than.
+func (w *Window) extreme(better func(a, b float64) bool) (sample Sample) {
+	first := true
+	for _, span := range w.spans {
+		if w.inside(span.Start) && (first || better(span.Value, sample.Value)) {
+			sample = Sample{Time: span.Start, Value: span.Value}
+			first = false
+		}
+	}
+	return
+}
+
+// Duration returns the time inside the window that samples stand for.
+func (w *Window) Duration() (d time.Duration) {
+	for _, span := range w.Spans() {
+		d += span.End.Sub(span.Start)
+	}
+	return
+}
+
+// Coverage returns the percentage of the window that samples stand for.
+func (w *Window) Coverage() float64 {
+	length := w.End.Sub(w.Start)
+	if length <= 0 {
+		return 0
+	}
+	return 100 * w.Duration().Seconds() / length.Seconds()
+}
+
+// Mean returns the time weighted mean, or 0 if no time is covered.
+func (w *Window) Mean() float64 {
+	var sum, total float64
+	for _, span := range w.Spans() {
+		weight := span.End.Sub(span.Start).Seconds()
+		sum += span.Value * weight
+		total += weight
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / total
+}
+
+// StdDev returns the time weighted standard deviation of the values.
+func (w *Window) StdDev() float64 {
+	mean := w.Mean()
+	var sum, total float64
+	for _, span := range w.Spans() {
+		weight := span.End.Sub(span.Start).Seconds()
+		sum += (span.Value - mean) * (span.Value - mean) * weight
+		total += weight
+	}
+	if total == 0 {
+		return 0
+	}
+	return math.Sqrt(sum / total)
+}
+
+// Percentiles returns, for each p from 0 to 100, the lowest value that the
+// series was at or below for p percent of the covered time.  They are 0 if
+// no time is covered.
+func (w *Window) Percentiles(ps ...float64) []float64 {
+	spans := w.Spans()
+	sort.SliceStable(spans, func(i, j int) bool { return spans[i].Value < spans[j].Value })
+	var total float64
+	for _, span := range spans {
+		total += span.End.Sub(span.Start).Seconds()
+	}
+	vals := make([]float64, len(ps))
+	if total == 0 {
+		return vals
+	}
+	for i, p := range ps {
+		target := total * min(max(p, 0), 100) / 100
+		var cum float64
+		for _, span := range spans {
+			cum += span.End.Sub(span.Start).Seconds()
+			vals[i] = span.Value
+			if cum >= target {
+				break
+			}
+		}
+	}
+	return vals
+}
+
+// Integral returns the integral of f of the values over the covered time, in
+// the units of f times hours.
+func (w *Window) Integral(f func(float64) float64) (sum float64) {
+	for _, span := range w.Spans() {
+		sum += f(span.Value) * span.End.Sub(span.Start).Hours()
+	}
+	return
+}
+
+// TimeWhere returns the covered time at values for which pred is true.
+func (w *Window) TimeWhere(pred func(float64) bool) (d time.Duration) {
+	for _, span := range w.Spans() {
+		if pred(span.Value) {
+			d += span.End.Sub(span.Start)
+		}
+	}
+	return
+}
+
+// Runs returns the continuous times at values for which pred is true, in
+// order.  A gap ends a run.
+func (w *Window) Runs(pred func(float64) bool) (runs []Run) {
+	for _, span := range w.Spans() {
+		if !pred(span.Value) {
+			continue
+		}
+		if n := len(runs); n > 0 && runs[n-1].End.Equal(span.Start) {
+			runs[n-1].End = span.End
+			continue
+		}
+		runs = append(runs, Run{Start: span.Start, End: span.End})
+	}
+	return
+}
@@ -0,0 +1,168 @@
+package stats
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)
+
+// at returns the time minutes after t0.
+func at(minutes float64) time.Time {
+	return t0.Add(time.Duration(minutes * float64(time.Minute)))
+}
+
+// window adds values, each a pair of minutes after t0 and value, to a
+// window of the first hour with readings every ten minutes.
+func window(values ...[2]float64) *Window {
+	w := NewWindow(t0, at(60), 10*time.Minute, 15*time.Minute)
+	for _, v := range values {
+		w.Add(at(v[0]), v[1])
+	}
+	return w
+}
+
+func near(a float64, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestEvenSampling(t *testing.T) {
+	w := window([2]float64{0, 1}, [2]float64{10, 2}, [2]float64{20, 3}, [2]float64{30, 4}, [2]float64{40, 5}, [2]float64{50, 6})
+	if w.Count() != 6 || w.Min().Value != 1 || w.Max().Value != 6 || w.Last().Value != 6 || !w.Last().Time.Equal(at(50)) {
+		t.Errorf("Unexpected count, min or max: %d %g %g", w.Count(), w.Min().Value, w.Max().Value)
+	}
+	if !near(w.Mean(), 3.5) {
+		t.Errorf("Expected a mean of 3.5, got %g", w.Mean())
+	}
+	if !near(w.StdDev(), math.Sqrt(35.0/12)) {
+		t.Errorf("Expected a standard deviation of %g, got %g", math.Sqrt(35.0/12), w.StdDev())
+	}
+	if w.Duration() != time.Hour || !near(w.Coverage(), 100) {
+		t.Errorf("Expected full coverage, got %s %g%%", w.Duration(), w.Coverage())
+	}
+	p := w.Percentiles(0, 50, 95, 100)
+	if p[0] != 1 || p[1] != 3 || p[2] != 6 || p[3] != 6 {
+		t.Errorf("Unexpected percentiles: %v", p)
+	}
+}
+
+func TestUnevenSampling(t *testing.T) {
+	// A burst of five readings of 100 in a minute must not outweigh the
+	// 0 held for the rest of the hour
+	w := window([2]float64{0, 0}, [2]float64{9, 0}, [2]float64{18, 0},
+		[2]float64{27, 100}, [2]float64{27.25, 100}, [2]float64{27.5, 100}, [2]float64{27.75, 100}, [2]float64{28, 100},
+		[2]float64{29, 0}, [2]float64{38, 0}, [2]float64{47, 0}, [2]float64{56, 0})
+	if w.Count() != 12 {
+		t.Errorf("Expected 12 samples, got %d", w.Count())
+	}
+	// 100 is held from 27 to 29
+	if !near(w.Mean(), 100*2.0/60) {
+		t.Errorf("Expected a time weighted mean of %g, got %g", 100*2.0/60, w.Mean())
+	}
+	if !near(w.StdDev(), math.Sqrt(2.0/60*(100-w.Mean())*(100-w.Mean())+58.0/60*w.Mean()*w.Mean())) {
+		t.Errorf("Unexpected standard deviation: %g", w.StdDev())
+	}
+	if p := w.Percentiles(50, 96, 97); p[0] != 0 || p[1] != 0 || p[2] != 100 {
+		t.Errorf("Unexpected percentiles: %v", p)
+	}
+	if !near(w.Coverage(), 100) {
+		t.Errorf("Expected full coverage, got %g%%", w.Coverage())
+	}
+}
+
+func TestGaps(t *testing.T) {
+	// Silent from 10 to 40; the reading before the gap stands for one
+	// interval and the last one for one interval, cut at the end
+	w := window([2]float64{0, 10}, [2]float64{10, 20}, [2]float64{40, 30}, [2]float64{55, 40})
+	if w.Duration() != 40*time.Minute {
+		t.Errorf("Expected 40 minutes covered, got %s", w.Duration())
+	}
+	if !near(w.Coverage(), 200.0/3) {
+		t.Errorf("Expected %g%% coverage, got %g%%", 200.0/3, w.Coverage())
+	}
+	if !near(w.Mean(), (10*10+20*10+30*15+40*5)/40.0) {
+		t.Errorf("Unexpected mean: %g", w.Mean())
+	}
+	runs := w.Runs(func(v float64) bool { return v > 0 })
+	if len(runs) != 2 || !runs[0].Start.Equal(at(0)) || !runs[0].End.Equal(at(20)) ||
+		!runs[1].Start.Equal(at(40)) || !runs[1].End.Equal(at(60)) {
+		t.Errorf("Unexpected runs: %v", runs)
+	}
+}
+
+func TestEdges(t *testing.T) {
+	// The reading before the window holds into it and the one after ends
+	// the last one inside; neither is counted
+	w := window([2]float64{-5, -10}, [2]float64{5, 10}, [2]float64{15, 20}, [2]float64{25, 30},
+		[2]float64{35, 40}, [2]float64{45, 50}, [2]float64{55, 60}, [2]float64{62, 70})
+	if w.Count() != 6 || w.Min().Value != 10 || w.Max().Value != 60 || w.Last().Value != 60 {
+		t.Errorf("Unexpected count, min or max: %d %g %g", w.Count(), w.Min().Value, w.Max().Value)
+	}
+	if w.Duration() != time.Hour {
+		t.Errorf("Expected the hour covered, got %s", w.Duration())
+	}
+	if !near(w.Mean(), (-10*5+10*10+20*10+30*10+40*10+50*10+60*5)/60.0) {
+		t.Errorf("Unexpected mean: %g", w.Mean())
+	}
+	// Ties go to the first
+	tie := window([2]float64{0, 5}, [2]float64{10, 1}, [2]float64{20, 5}, [2]float64{30, 1})
+	if !tie.Min().Time.Equal(at(10)) || !tie.Max().Time.Equal(t0) {
+		t.Errorf("Expected the first extremes, got %v %v", tie.Min(), tie.Max())
+	}
+
+	empty := window()
+	if empty.Count() != 0 || empty.Mean() != 0 || empty.StdDev() != 0 || empty.Coverage() != 0 || empty.Min() != (Sample{}) || empty.Last() != (Sample{}) {
+		t.Errorf("Expected zero statistics for an empty window")
+	}
+	if p := empty.Percentiles(50); p[0] != 0 {
+		t.Errorf("Expected a zero percentile for an empty window, got %v", p)
+	}
+	if runs := empty.Runs(func(float64) bool { return true }); runs != nil {
+		t.Errorf("Expected no runs, got %v", runs)
+	}
+
+	// Readings at the same time add nothing to the covered time
+	same := window([2]float64{0, 1}, [2]float64{0, 3}, [2]float64{10, 5})
+	if same.Count() != 3 || same.Duration() != 20*time.Minute || !near(same.Mean(), 4) {
+		t.Errorf("Unexpected statistics of readings at the same time: %d %s %g", same.Count(), same.Duration(), same.Mean())
+	}
+}
+
+func TestSlice(t *testing.T) {
+	w := NewWindow(t0, at(120), 10*time.Minute, 15*time.Minute)
+	for m := 0.0; m < 120; m += 10 {
+		w.Add(at(m), m)
+	}
+	first := w.Slice(t0, at(60))
+	second := w.Slice(at(60), at(120))
+	if first.Count() != 6 || second.Count() != 6 || first.Max().Value != 50 || second.Min().Value != 60 {
+		t.Errorf("Unexpected slices: %d %d %g %g", first.Count(), second.Count(), first.Max().Value, second.Min().Value)
+	}
+	if !near(first.Mean(), 25) || !near(second.Mean(), 85) {
+		t.Errorf("Unexpected means: %g %g", first.Mean(), second.Mean())
+	}
+	// A slice across the readings cuts the ones at its edges
+	middle := w.Slice(at(55), at(65))
+	if middle.Count() != 1 || middle.Duration() != 10*time.Minute || !near(middle.Mean(), 55) {
+		t.Errorf("Unexpected middle slice: %d %s %g", middle.Count(), middle.Duration(), middle.Mean())
+	}
+	if outside := w.Slice(at(200), at(300)); outside.Count() != 0 || outside.Duration() != 0 {
+		t.Errorf("Expected nothing after the readings")
+	}
+}
+
+func TestIntegral(t *testing.T) {
+	// Degree hours below 10: 10 for 30 minutes at 0, 5 for 30 at 5
+	w := window([2]float64{0, 0}, [2]float64{10, 0}, [2]float64{20, 0}, [2]float64{30, 5}, [2]float64{40, 5}, [2]float64{50, 5})
+	if got := w.Integral(func(v float64) float64 { return max(0, 10-v) }); !near(got, 7.5) {
+		t.Errorf("Expected 7.5 degree hours, got %g", got)
+	}
+	if got := w.TimeWhere(func(v float64) bool { return v < 1 }); got != 30*time.Minute {
+		t.Errorf("Expected 30 minutes below 1, got %s", got)
+	}
+	runs := w.Runs(func(v float64) bool { return v < 1 })
+	if len(runs) != 1 || !runs[0].Start.Equal(t0) || !runs[0].End.Equal(at(30)) {
+		t.Errorf("Unexpected runs: %v", runs)
+	}
+}
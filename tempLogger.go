@@ -3,11 +3,15 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io"
 	"log"
+	"net/http"
 	"os"
+	"sync/atomic"
+	"tempLogger/metrics"
+	"tempLogger/sdnotify"
 	"tempLogger/types"
 	"time"
 
@@ -16,38 +20,64 @@ import (
 
 const swVer = 3
 
-func main() {
-	fmt.Println("tempLogger Version", swVer)
-	cfg := flag.String("config", "tempLogger.json", "Path to the JSON configuration file")
-	flag.Parse()
+var (
+	registry     = metrics.NewRegistry()
+	serialErrors = registry.NewCounter("templogger_serial_errors_total",
+		"Errors opening or reading the serial port.")
+	reconnects = registry.NewCounter("templogger_serial_reconnects_total",
+		"Times the serial port was reopened after a read error.")
+	parseFailures = registry.NewCounter("templogger_parse_errors_total",
+		"Readings from the device that could not be parsed.")
+	readingsWritten = registry.NewCounter("templogger_readings_written_total",
+		"Readings written to the log file.")
+	lastReading = registry.NewGauge("templogger_last_reading_timestamp_seconds",
+		"Time of the newest reading written.")
+	outboxReadings = registry.NewGauge("templogger_outbox_readings",
+		"Readings waiting for tlweb to acknowledge them.")
+	readingsSent = registry.NewCounter("templogger_readings_sent_total",
+		"Readings acknowledged by tlweb.")
+	sendErrors = registry.NewCounter("templogger_send_errors_total",
+		"Failed attempts to send readings to tlweb.")
+	readingsRejected = registry.NewCounter("templogger_readings_rejected_total",
+		"Readings tlweb refused, kept in the rejected file of the outbox.")
+)
 
-	var s *serial.Port
-	var err error
-	var connectRetries int
+// maxSilence is how long the serial port may go without a line, or the
+// port without an attempt to open it, before the systemd watchdog is no
+// longer pinged.
+const maxSilence = time.Minute
 
-	cfgFile, err := os.Open(*cfg)
-	if err != nil {
-		log.Fatalln("tempLogger: Could not open file", *cfg, ":", err.Error())
-	}
+// lastActivity is the Unix time in nanoseconds of the last line read or
+// attempt to open the port.
+var lastActivity atomic.Int64
 
-	cfBytes, err := io.ReadAll(cfgFile)
-	if err != nil {
-		log.Fatalln("tempLogger: Could not read file", *cfg, ":", err.Error())
-	}
+func touch() {
+	lastActivity.Store(time.Now().UnixNano())
+}
 
-	var tlCfg types.TLCfg
-	err = json.Unmarshal(cfBytes, &tlCfg)
-	if err != nil {
-		log.Fatalln("tempLogger: Could not parse file", *cfg, ":", err.Error())
+// healthy is the check of the systemd watchdog, failing when a serial read
+// has hung.
+func healthy() error {
+	silence := time.Since(time.Unix(0, lastActivity.Load()))
+	if silence > maxSilence {
+		return fmt.Errorf("healthy: No serial activity for %s", silence.Round(time.Second))
 	}
+	return nil
+}
 
-	c := &serial.Config{Name: tlCfg.SerialPath, Baud: tlCfg.Baud}
+// openPort opens the serial port, retrying every 10 seconds up to retries
+// times.
+func openPort(c *serial.Config, retries int) (s *serial.Port) {
+	var err error
+	var connectRetries int
 	for {
+		touch()
 		s, err = serial.OpenPort(c)
 		if err != nil {
-			log.Println("tempLogger: Error opening serial port", tlCfg.SerialPath, ":", err.Error())
-			if connectRetries >= tlCfg.Retries {
-				log.Fatalln("tempLogger: Retried opening serial port", tlCfg.Retries, "times. Exiting...")
+			serialErrors.Inc()
+			log.Println("tempLogger: Error opening serial port", c.Name, ":", err.Error())
+			if connectRetries >= retries {
+				log.Fatalln("tempLogger: Retried opening serial port", retries, "times. Exiting...")
 			}
 			connectRetries++
 			// Sleep for 10 seconds to allow time for the port to show up
@@ -55,9 +85,65 @@ func main() {
 			continue
 		}
 		// We have a port, so quit loop
-		break
+		return
+	}
+}
+
+func main() {
+	fmt.Println("tempLogger Version", swVer)
+	cfg := flag.String("config", "tempLogger.json", "Path to the JSON configuration file")
+	metricsAddr := flag.String("metrics", "", "Address to serve Prometheus metrics on, such as :9101; disabled if empty")
+	checkConfig := flag.Bool("check-config", false, "Report every problem with the configuration and exit")
+	flag.Parse()
+
+	var err error
+
+	tlCfg, err := LoadTLCfg(*cfg)
+	if err != nil {
+		log.Fatalln("tempLogger:", err.Error())
+	}
+	if *checkConfig {
+		problems := errors.Join(validateTLCfg(tlCfg), checkTLCfgFiles(tlCfg))
+		if problems != nil {
+			fmt.Printf("%s has problems:\n%s\n", *cfg, problems.Error())
+			os.Exit(1)
+		}
+		fmt.Println(*cfg, "is OK")
+		return
+	}
+	if err = validateTLCfg(tlCfg); err != nil {
+		log.Fatalf("tempLogger: Invalid configuration %s:\n%s\n", *cfg, err.Error())
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		log.Println("tempLogger: Error getting the host name:", err.Error())
+		host = "localhost"
+	}
+	sinks, err := newSinks(tlCfg, types.HostName(host))
+	if err != nil {
+		log.Fatalln("tempLogger:", err.Error())
+	}
+
+	for _, sink := range sinks {
+		if hs, ok := sink.(*httpSink); ok {
+			go hs.Run()
+		}
+	}
+
+	if *metricsAddr != "" {
+		go func() {
+			log.Fatalln(http.ListenAndServe(*metricsAddr, registry.Handler()))
+		}()
 	}
-	defer s.Close()
+
+	c := serialConfig(tlCfg.Serial)
+	s := openPort(c, tlCfg.Serial.Retries)
+	defer func() { s.Close() }()
+	if _, err = sdnotify.Notify(sdnotify.Ready); err != nil {
+		log.Println("tempLogger: Error notifying systemd:", err.Error())
+		err = nil
+	}
+	go sdnotify.RunWatchdog(healthy)
 
 	tmpReader := bufio.NewReader(s)
 
@@ -65,8 +151,21 @@ func main() {
 	for {
 		var bytes []byte
 		// Read all of the values but only use the last one
-		for j := 0; j < 60; j++ {
-			bytes, _ = tmpReader.ReadBytes('\n')
+		for j := 0; j < 60 && err == nil; j++ {
+			bytes, err = tmpReader.ReadBytes('\n')
+			touch()
+		}
+		if err != nil {
+			serialErrors.Inc()
+			log.Println("tempLogger: Error reading serial port", c.Name, ":", err.Error())
+			s.Close()
+			sdnotify.Notify(sdnotify.Status("Reconnecting to " + c.Name))
+			s = openPort(c, tlCfg.Serial.Retries)
+			sdnotify.Notify(sdnotify.Status("Reading " + c.Name))
+			tmpReader = bufio.NewReader(s)
+			reconnects.Inc()
+			err = nil
+			continue
 		}
 		// n, err := s.Write([]byte("test"))
 		// if err != nil {
@@ -75,35 +174,34 @@ func main() {
 
 		err = json.Unmarshal(bytes, &tmpData)
 		if err != nil {
+			parseFailures.Inc()
 			log.Println("tempLogger: Error reading data:", err.Error())
+			err = nil
 			continue
 		}
 		tmpTimeStamp := time.Now()
 		tmpData.TimeStamp = tmpTimeStamp.Format(time.RFC3339)
 		tmpData.ID = tlCfg.ID
+		tmpData.Site = tlCfg.Site
 		//log.Println(string(bytes))
 		bytes, err = json.Marshal(tmpData)
 		if err != nil {
 			log.Println("tempLogger: Error marshalling data", err.Error())
+			err = nil
 			continue
 		}
-		fileName := fmt.Sprintf("tempLogger-%04d%02d%02d.log",
-			tmpTimeStamp.Year(),
-			tmpTimeStamp.Month(),
-			tmpTimeStamp.Day(),
-		)
-		f, err := os.OpenFile(fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Println("tempLogger: Error opening file", fileName, ":", err.Error())
-			continue
-		}
-		if _, err = f.WriteString(string(bytes) + "\n"); err != nil {
-			f.Close() // ignore error; Write error takes precedence
-			log.Println("tempLogger: Error writing string to file", fileName, ":", err.Error())
-		} else {
-			if err = f.Close(); err != nil {
-				log.Println("tempLogger: Error closing file", fileName, ":", err.Error())
+		line := append(bytes, '\n')
+		written := true
+		for _, sink := range sinks {
+			if err = sink.Write(tmpTimeStamp, line); err != nil {
+				log.Println("tempLogger:", err.Error())
+				written = false
 			}
 		}
+		if written {
+			readingsWritten.Inc()
+			lastReading.Set(float64(tmpTimeStamp.Unix()))
+		}
+		err = nil
 	}
 }
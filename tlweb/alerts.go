@@ -0,0 +1,582 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	defaultRateWindow = 30 * time.Minute
+	alertEventLimit   = 50
+)
+
+// LoadAlertCfg reads and checks the alert rules and notification channels.
+func LoadAlertCfg(cfgPath string) (cfg types.AlertCfg, err error) {
+	cfgFile, err := os.Open(cfgPath)
+	if err != nil {
+		err = fmt.Errorf("LoadAlertCfg: Could not open file %s: %w", cfgPath, err)
+		return
+	}
+	defer cfgFile.Close()
+	cfgBytes, err := io.ReadAll(cfgFile)
+	if err != nil {
+		err = fmt.Errorf("LoadAlertCfg: Could not read file %s: %w", cfgPath, err)
+		return
+	}
+	err = json.Unmarshal(cfgBytes, &cfg)
+	if err != nil {
+		err = fmt.Errorf("LoadAlertCfg: Could not parse file %s: %w", cfgPath, err)
+		return
+	}
+	if err = validateAlertCfg(&cfg); err != nil {
+		err = fmt.Errorf("LoadAlertCfg: %s: %w", cfgPath, err)
+		return
+	}
+	return
+}
+
+// validateAlertCfg checks cfg and fills in the default metric and units of
+// its rules.
+func validateAlertCfg(cfg *types.AlertCfg) error {
+	channels := make(map[string]bool, len(cfg.Channels))
+	for _, ch := range cfg.Channels {
+		if ch.Name == "" {
+			return fmt.Errorf("Channel with no name")
+		}
+		if channels[ch.Name] {
+			return fmt.Errorf("Duplicate channel name %s", ch.Name)
+		}
+		channels[ch.Name] = true
+		if _, err := newNotifier(ch); err != nil {
+			return err
+		}
+	}
+	rules := make(map[string]bool, len(cfg.Rules))
+	for i := range cfg.Rules {
+		rule := &cfg.Rules[i]
+		if rule.Name == "" {
+			return fmt.Errorf("Rule with no name")
+		}
+		if rules[rule.Name] {
+			return fmt.Errorf("Duplicate rule name %s", rule.Name)
+		}
+		rules[rule.Name] = true
+		switch rule.Kind {
+		case types.AlertAbove, types.AlertBelow, types.AlertRate:
+		case types.AlertNoData:
+			if rule.ForMinutes <= 0 {
+				return fmt.Errorf("Rule %s: nodata rules need forMinutes", rule.Name)
+			}
+		default:
+			return fmt.Errorf("Rule %s: Unknown kind: %s", rule.Name, rule.Kind)
+		}
+		if rule.Metric == "" {
+			rule.Metric = types.MetricTemp
+		}
+		known := false
+		for _, metric := range types.SummaryMetrics {
+			known = known || metric.Name == rule.Metric
+		}
+		if !known {
+			return fmt.Errorf("Rule %s: Unknown metric: %s", rule.Name, rule.Metric)
+		}
+		if rule.Units == "" {
+			rule.Units = types.UnitF
+		}
+		units, err := types.ParseUnit(rule.Units)
+		if err != nil {
+			return fmt.Errorf("Rule %s: %w", rule.Name, err)
+		}
+		rule.Units = units
+		if rule.Hysteresis < 0 || rule.ForMinutes < 0 || rule.WindowMinutes < 0 {
+			return fmt.Errorf("Rule %s: hysteresis, forMinutes and windowMinutes must not be negative", rule.Name)
+		}
+		for _, name := range rule.Channels {
+			if !channels[name] {
+				return fmt.Errorf("Rule %s: Unknown channel: %s", rule.Name, name)
+			}
+		}
+	}
+	return nil
+}
+
+type alertKey struct {
+	rule   string
+	sensor string
+}
+
+type seriesKey struct {
+	sensor string
+	metric string
+	units  string
+}
+
+// AlertEngine evaluates the alert rules against new readings and sends
+// notifications when a rule fires or clears.  Its state is kept in the
+// database so a restart does not repeat notifications.
+type AlertEngine struct {
+	tldb      TLDB
+	rules     []types.AlertRule
+	notifiers map[string]notifier
+	// mu guards states and history, which are updated by the watcher and
+	// the nodata check while the web handlers read them.
+	mu     sync.Mutex
+	states map[alertKey]*types.AlertStatus
+	// history holds the recent values of each series that a rate rule
+	// uses, oldest first.
+	history map[seriesKey][]types.TempRecord
+}
+
+// NewAlertEngine loads the saved alert states.  cfg must have been checked
+// by LoadAlertCfg.
+func NewAlertEngine(tldb TLDB, cfg types.AlertCfg) (ae *AlertEngine, err error) {
+	ae = &AlertEngine{
+		tldb:      tldb,
+		rules:     cfg.Rules,
+		notifiers: make(map[string]notifier, len(cfg.Channels)),
+		states:    make(map[alertKey]*types.AlertStatus),
+		history:   make(map[seriesKey][]types.TempRecord),
+	}
+	for _, ch := range cfg.Channels {
+		if ae.notifiers[ch.Name], err = newNotifier(ch); err != nil {
+			err = fmt.Errorf("NewAlertEngine: %w", err)
+			return
+		}
+	}
+	statuses, err := tldb.AlertStatuses()
+	if err != nil {
+		err = fmt.Errorf("NewAlertEngine: %w", err)
+		return
+	}
+	noData := make(map[string]bool)
+	for _, rule := range ae.rules {
+		noData[rule.Name] = rule.Kind == types.AlertNoData
+	}
+	for i := range statuses {
+		st := &statuses[i]
+		// The time of the last reading is only saved with a change of
+		// state, so a silence is measured from the newest stored one
+		if noData[st.Rule] {
+			if updated, found := ae.latestReading(st.Sensor); found && updated > st.Updated {
+				st.Updated = updated
+			}
+		}
+		ae.states[alertKey{st.Rule, st.Sensor}] = st
+	}
+	return
+}
+
+// latestReading returns the time, in milliseconds, of the newest stored
+// reading of sensor.  found is false if it has none.
+func (ae *AlertEngine) latestReading(sensor string) (updated int64, found bool) {
+	if !ae.tldb.HasTable(sensor) {
+		return
+	}
+	thd, found, err := ae.tldb.LatestRecord(sensor)
+	if err != nil {
+		log.Println("latestReading:", err.Error())
+		return
+	}
+	ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+	if !found || err != nil {
+		found = false
+		return
+	}
+	updated = ts.UnixMilli()
+	return
+}
+
+// Rules returns the configured alert rules.
+func (ae *AlertEngine) Rules() []types.AlertRule {
+	return ae.rules
+}
+
+// Statuses returns the state of every rule and sensor that has been
+// evaluated, ordered by rule then sensor.
+func (ae *AlertEngine) Statuses() (statuses []types.AlertStatus) {
+	ae.mu.Lock()
+	defer ae.mu.Unlock()
+	for _, st := range ae.states {
+		statuses = append(statuses, *st)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].Rule != statuses[j].Rule {
+			return statuses[i].Rule < statuses[j].Rule
+		}
+		return statuses[i].Sensor < statuses[j].Sensor
+	})
+	return
+}
+
+func (ae *AlertEngine) state(rule string, sensor string) *types.AlertStatus {
+	key := alertKey{rule, sensor}
+	st, ok := ae.states[key]
+	if !ok {
+		st = &types.AlertStatus{Rule: rule, Sensor: sensor, State: types.AlertOK}
+		ae.states[key] = st
+	}
+	return st
+}
+
+// Evaluate checks newly inserted readings, in time order, against the
+// rules.  Readings older than the last one evaluated for a rule are ignored
+// by it.
+func (ae *AlertEngine) Evaluate(records []types.THData) {
+	var events []types.AlertEvent
+	var notify [][]string
+	ae.mu.Lock()
+	for _, thd := range records {
+		ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+		if err != nil {
+			log.Println("Evaluate: Error parsing timestamp:", err.Error())
+			continue
+		}
+		thd.Calibrate(ae.tldb.Calibrations(thd.ID), ts)
+		for _, rule := range ae.rules {
+			if rule.Sensor != "" && rule.Sensor != thd.ID {
+				continue
+			}
+			st := ae.state(rule.Name, thd.ID)
+			if ts.UnixMilli() <= st.Updated {
+				continue
+			}
+			if ev, changed := ae.evaluateRule(rule, st, thd, ts); changed {
+				ae.save(st)
+				if ev != nil {
+					events = append(events, *ev)
+					notify = append(notify, rule.Channels)
+				}
+			}
+		}
+	}
+	ae.mu.Unlock()
+	for i := range events {
+		ae.record(events[i], notify[i])
+	}
+}
+
+// evaluateRule moves st to its next state given thd, taken at ts.  It
+// reports whether the state changed and the event to send, if any.
+func (ae *AlertEngine) evaluateRule(rule types.AlertRule, st *types.AlertStatus, thd types.THData, ts time.Time) (ev *types.AlertEvent, changed bool) {
+	date := ts.UnixMilli()
+	if rule.Kind == types.AlertNoData {
+		// Any reading ends a silence
+		st.Updated = date
+		if st.State != types.AlertOK {
+			ev = ae.transition(rule, st, types.AlertOK, date, 0)
+			changed = true
+		}
+		return
+	}
+
+	value := types.MetricValue(thd, rule.Metric, rule.Units)
+	if rule.Kind == types.AlertRate {
+		var ok bool
+		value, ok = ae.rate(rule, thd.ID, types.TempRecord{Date: date, Value: value})
+		if !ok {
+			return
+		}
+	}
+	st.Value = value
+	st.Updated = date
+	breached := ruleBreached(rule, value, st.State == types.AlertFiring)
+	held := time.Duration(date-st.Since) * time.Millisecond
+	forDuration := time.Duration(rule.ForMinutes) * time.Minute
+	switch {
+	case st.State == types.AlertOK && breached && forDuration == 0:
+		ev = ae.transition(rule, st, types.AlertFiring, date, value)
+	case st.State == types.AlertOK && breached:
+		st.State = types.AlertPending
+		st.Since = date
+	case st.State == types.AlertPending && !breached:
+		st.State = types.AlertOK
+		st.Since = date
+	case st.State == types.AlertPending && held >= forDuration:
+		ev = ae.transition(rule, st, types.AlertFiring, date, value)
+	case st.State == types.AlertFiring && !breached:
+		ev = ae.transition(rule, st, types.AlertOK, date, value)
+	default:
+		// Only the value and update time changed, which are not worth a
+		// database write per reading.
+		return
+	}
+	changed = true
+	return
+}
+
+// ruleBreached reports whether value is past the rule's threshold.  A firing
+// rule stays breached until the value is back past the threshold by the
+// hysteresis.
+func ruleBreached(rule types.AlertRule, value float32, firing bool) bool {
+	above := rule.Kind == types.AlertAbove || (rule.Kind == types.AlertRate && rule.Threshold >= 0)
+	limit := rule.Threshold
+	if firing {
+		if above {
+			limit -= rule.Hysteresis
+		} else {
+			limit += rule.Hysteresis
+		}
+	}
+	if above {
+		return value > limit
+	}
+	return value < limit
+}
+
+// rate returns the change per hour of a series over the rule's window.  It
+// is not available until the readings cover half the window.
+func (ae *AlertEngine) rate(rule types.AlertRule, sensor string, tr types.TempRecord) (rate float32, ok bool) {
+	window := defaultRateWindow
+	if rule.WindowMinutes > 0 {
+		window = time.Duration(rule.WindowMinutes) * time.Minute
+	}
+	key := seriesKey{sensor, rule.Metric, rule.Units}
+	hist := ae.history[key]
+	if n := len(hist); n == 0 || hist[n-1].Date < tr.Date {
+		hist = append(hist, tr)
+	}
+	start := 0
+	for start < len(hist) && hist[start].Date < tr.Date-window.Milliseconds() {
+		start++
+	}
+	hist = hist[start:]
+	ae.history[key] = hist
+
+	oldest := hist[0]
+	span := time.Duration(tr.Date-oldest.Date) * time.Millisecond
+	if span < window/2 {
+		return
+	}
+	rate = (tr.Value - oldest.Value) / float32(span.Hours())
+	ok = true
+	return
+}
+
+// transition moves st to state and returns the event describing it.
+func (ae *AlertEngine) transition(rule types.AlertRule, st *types.AlertStatus, state string, date int64, value float32) *types.AlertEvent {
+	st.State = state
+	st.Since = date
+	ev := &types.AlertEvent{Rule: rule.Name, Sensor: st.Sensor, State: state, Value: value, Date: date}
+	ev.Message = alertMessage(rule, *ev)
+	return ev
+}
+
+func alertMessage(rule types.AlertRule, ev types.AlertEvent) string {
+	if ev.State == types.AlertOK {
+		return fmt.Sprintf("%s: %s has cleared", rule.Name, ev.Sensor)
+	}
+	unit := ""
+	for _, metric := range types.MetricsIn(rule.Units) {
+		if metric.Name == rule.Metric {
+			unit = metric.Unit
+		}
+	}
+	switch rule.Kind {
+	case types.AlertAbove:
+		return fmt.Sprintf("%s: %s %s is %g %s, above %g %s", rule.Name, ev.Sensor, rule.Metric, ev.Value, unit, rule.Threshold, unit)
+	case types.AlertBelow:
+		return fmt.Sprintf("%s: %s %s is %g %s, below %g %s", rule.Name, ev.Sensor, rule.Metric, ev.Value, unit, rule.Threshold, unit)
+	case types.AlertRate:
+		return fmt.Sprintf("%s: %s %s is changing by %.2f %s per hour, limit %g %s", rule.Name, ev.Sensor, rule.Metric, ev.Value, unit, rule.Threshold, unit)
+	}
+	return fmt.Sprintf("%s: No data from %s for %d minutes", rule.Name, ev.Sensor, rule.ForMinutes)
+}
+
+// CheckNoData fires the nodata rules of sensors that have been silent for
+// too long at now.
+func (ae *AlertEngine) CheckNoData(now time.Time) {
+	var events []types.AlertEvent
+	var notify [][]string
+	ae.mu.Lock()
+	for _, rule := range ae.rules {
+		if rule.Kind != types.AlertNoData {
+			continue
+		}
+		sensors := []string{rule.Sensor}
+		if rule.Sensor == "" {
+			sensors = ae.tldb.Sensors()
+		}
+		for _, sensor := range sensors {
+			st := ae.state(rule.Name, sensor)
+			if st.Updated == 0 {
+				// Start from the newest stored reading
+				updated, found := ae.latestReading(sensor)
+				st.Updated = now.UnixMilli()
+				if found {
+					st.Updated = updated
+				}
+			}
+			silent := time.Duration(now.UnixMilli()-st.Updated) * time.Millisecond
+			if st.State == types.AlertOK && silent >= time.Duration(rule.ForMinutes)*time.Minute {
+				ev := ae.transition(rule, st, types.AlertFiring, now.UnixMilli(), 0)
+				ae.save(st)
+				events = append(events, *ev)
+				notify = append(notify, rule.Channels)
+			}
+		}
+	}
+	ae.mu.Unlock()
+	for i := range events {
+		ae.record(events[i], notify[i])
+	}
+}
+
+// WatchNoData runs CheckNoData every interval.
+func (ae *AlertEngine) WatchNoData(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ae.CheckNoData(now)
+	}
+}
+
+func (ae *AlertEngine) save(st *types.AlertStatus) {
+	if err := ae.tldb.SaveAlertStatus(*st); err != nil {
+		log.Println("save:", err.Error())
+	}
+}
+
+// record stores ev and sends it to the named channels in the background.
+func (ae *AlertEngine) record(ev types.AlertEvent, channels []string) {
+	log.Println("Alert", ev.State+":", ev.Message)
+	if err := ae.tldb.AddAlertEvent(ev); err != nil {
+		log.Println("record:", err.Error())
+	}
+	for _, name := range channels {
+		go func(name string, n notifier) {
+			if err := n.Notify(ev); err != nil {
+				log.Printf("record: Error notifying %s: %s\n", name, err.Error())
+			}
+		}(name, ae.notifiers[name])
+	}
+}
+
+// AlertsPage collects the rules, their states and the recent events.
+func (tlweb TLWeb) AlertsPage() (alertsPage types.AlertsPage, err error) {
+	alertsPage.Rules = []types.AlertRule{}
+	alertsPage.Statuses = []types.AlertStatus{}
+	if tlweb.Alerts != nil {
+		alertsPage.Rules = tlweb.Alerts.Rules()
+		alertsPage.Statuses = append(alertsPage.Statuses, tlweb.Alerts.Statuses()...)
+	}
+	alertsPage.Events, err = tlweb.Tldb.AlertEvents(alertEventLimit)
+	if alertsPage.Events == nil {
+		alertsPage.Events = []types.AlertEvent{}
+	}
+	return
+}
+
+// ShowAlerts renders the alert status page.
+func (tlweb TLWeb) ShowAlerts(w http.ResponseWriter, req *http.Request) {
+	alertsPage, err := tlweb.AlertsPage()
+	if err != nil {
+		log.Println("ShowAlerts:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusInternalServerError, "The alerts could not be read.")
+		return
+	}
+	tlweb.templates().Render(w, req, http.StatusOK, "alerts", alertsPage)
+}
+
+// APIAlerts lists the alert rules, their states and the recent events.
+func (tlweb TLWeb) APIAlerts(w http.ResponseWriter, req *http.Request) {
+	alertsPage, err := tlweb.AlertsPage()
+	if err != nil {
+		log.Println("APIAlerts:", err.Error())
+		writeAPIError(w, req, http.StatusInternalServerError, "Error retrieving alerts")
+		return
+	}
+	writeJSON(w, req, http.StatusOK, alertsPage)
+}
+
+// migrateAlerts creates the alert state and history tables.
+func (tldb TLDB) migrateAlerts() (err error) {
+	for _, sqlStmt := range []string{
+		"create table if not exists tlalert (rule text not null, sensor text not null, state text not null, since integer not null, value float not null, updated integer not null, primary key (rule, sensor))",
+		"create table if not exists tlalertevent (id integer not null primary key, rule text not null, sensor text not null, state text not null, value float not null, date integer not null, message text not null)",
+	} {
+		if _, err = tldb.DB.Exec(sqlStmt); err != nil {
+			err = fmt.Errorf("migrateAlerts: Error creating table: %s: %w", sqlStmt, err)
+			return
+		}
+	}
+	return
+}
+
+// AlertStatuses returns the saved state of every rule and sensor.
+func (tldb TLDB) AlertStatuses() (statuses []types.AlertStatus, err error) {
+	rows, err := tldb.DB.Query("select rule, sensor, state, since, value, updated from tlalert order by rule, sensor")
+	if err != nil {
+		err = fmt.Errorf("AlertStatuses: Error querying tlalert: %w", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var st types.AlertStatus
+		err = rows.Scan(&st.Rule, &st.Sensor, &st.State, &st.Since, &st.Value, &st.Updated)
+		if err != nil {
+			err = fmt.Errorf("AlertStatuses: Error reading query of tlalert: %w", err)
+			return
+		}
+		statuses = append(statuses, st)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("AlertStatuses: General error reading query of tlalert: %w", err)
+		return
+	}
+	return
+}
+
+// SaveAlertStatus stores the state of a rule for a sensor.
+func (tldb TLDB) SaveAlertStatus(st types.AlertStatus) (err error) {
+	sqlStmt := "insert or replace into tlalert(rule, sensor, state, since, value, updated) values(?, ?, ?, ?, ?, ?)"
+	_, err = tldb.DB.Exec(sqlStmt, st.Rule, st.Sensor, st.State, st.Since, st.Value, st.Updated)
+	if err != nil {
+		err = fmt.Errorf("SaveAlertStatus: Error saving %s for %s: %w", st.Rule, st.Sensor, err)
+		return
+	}
+	return
+}
+
+// AddAlertEvent appends to the alert history.
+func (tldb TLDB) AddAlertEvent(ev types.AlertEvent) (err error) {
+	sqlStmt := "insert into tlalertevent(rule, sensor, state, value, date, message) values(?, ?, ?, ?, ?, ?)"
+	_, err = tldb.DB.Exec(sqlStmt, ev.Rule, ev.Sensor, ev.State, ev.Value, ev.Date, ev.Message)
+	if err != nil {
+		err = fmt.Errorf("AddAlertEvent: Error saving %s for %s: %w", ev.Rule, ev.Sensor, err)
+		return
+	}
+	return
+}
+
+// AlertEvents returns up to limit of the most recent alert events, newest
+// first.
+func (tldb TLDB) AlertEvents(limit int) (events []types.AlertEvent, err error) {
+	rows, err := tldb.DB.Query("select rule, sensor, state, value, date, message from tlalertevent order by date desc, id desc limit ?", limit)
+	if err != nil {
+		err = fmt.Errorf("AlertEvents: Error querying tlalertevent: %w", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var ev types.AlertEvent
+		err = rows.Scan(&ev.Rule, &ev.Sensor, &ev.State, &ev.Value, &ev.Date, &ev.Message)
+		if err != nil {
+			err = fmt.Errorf("AlertEvents: Error reading query of tlalertevent: %w", err)
+			return
+		}
+		events = append(events, ev)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("AlertEvents: General error reading query of tlalertevent: %w", err)
+		return
+	}
+	return
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestLoadAlertCfg(t *testing.T) {
+	cfg, err := LoadAlertCfg("alerts.json")
+	if err != nil {
+		t.Fatalf("Could not load alerts.json: %s", err.Error())
+	}
+	if len(cfg.Rules) != 4 || cfg.Rules[3].Metric != types.MetricTemp || cfg.Rules[2].Units != types.UnitF {
+		t.Errorf("Unexpected rules: %+v", cfg.Rules)
+	}
+
+	for _, bad := range []types.AlertCfg{
+		{Rules: []types.AlertRule{{Name: "r", Kind: "sideways"}}},
+		{Rules: []types.AlertRule{{Name: "r", Kind: "nodata"}}},
+		{Rules: []types.AlertRule{{Name: "r", Kind: "above", Metric: "pressure"}}},
+		{Rules: []types.AlertRule{{Name: "r", Kind: "above", Units: "R"}}},
+		{Rules: []types.AlertRule{{Name: "r", Kind: "above", Channels: []string{"nowhere"}}}},
+		{Rules: []types.AlertRule{{Name: "r", Kind: "above"}, {Name: "r", Kind: "below"}}},
+		{Channels: []types.AlertChannel{{Name: "c", Type: "webhook"}}},
+		{Channels: []types.AlertChannel{{Name: "c", Type: "pager"}}},
+	} {
+		if err := validateAlertCfg(&bad); err == nil {
+			t.Errorf("Expected an error for %+v", bad)
+		}
+	}
+}
+
+// reading returns a sensor1 record minutes after a fixed time.
+func reading(minutes int, tempF float32) types.THData {
+	ts := time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC).Add(time.Duration(minutes) * time.Minute)
+	return types.THData{ID: "sensor1", TimeStamp: ts.Format(time.RFC3339), TempF: tempF, TempC: (tempF - 32) * 5 / 9, Humidity: 50}
+}
+
+func TestAlertThreshold(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	events := make(chan types.AlertEvent, 10)
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var ev types.AlertEvent
+		json.NewDecoder(req.Body).Decode(&ev)
+		events <- ev
+	}))
+	defer hook.Close()
+
+	cfg := types.AlertCfg{
+		Channels: []types.AlertChannel{{Name: "hook", Type: types.ChannelWebhook, URL: hook.URL}},
+		Rules: []types.AlertRule{{Name: "freezing", Sensor: "sensor1", Kind: types.AlertBelow,
+			Threshold: 35, Hysteresis: 2, ForMinutes: 10, Channels: []string{"hook"}}},
+	}
+	if err := validateAlertCfg(&cfg); err != nil {
+		t.Fatalf("Invalid configuration: %s", err.Error())
+	}
+	ae, err := NewAlertEngine(tldb, cfg)
+	if err != nil {
+		t.Fatalf("Could not start alerts: %s", err.Error())
+	}
+
+	steps := []struct {
+		minutes int
+		tempF   float32
+		state   string
+	}{
+		{0, 40, types.AlertOK},
+		{2, 34, types.AlertPending},
+		// A brief recovery resets the minimum duration
+		{4, 36, types.AlertOK},
+		{6, 34, types.AlertPending},
+		{12, 33, types.AlertPending},
+		{16, 33, types.AlertFiring},
+		// Within the hysteresis band
+		{18, 36, types.AlertFiring},
+		{20, 37.5, types.AlertOK},
+	}
+	for _, step := range steps {
+		ae.Evaluate([]types.THData{reading(step.minutes, step.tempF)})
+		statuses := ae.Statuses()
+		if len(statuses) != 1 || statuses[0].State != step.state {
+			t.Fatalf("Minute %d at %g F: Expected %s, Actual %+v", step.minutes, step.tempF, step.state, statuses)
+		}
+	}
+	// Readings older than the last one evaluated are ignored
+	ae.Evaluate([]types.THData{reading(1, 0)})
+	if st := ae.Statuses()[0]; st.State != types.AlertOK {
+		t.Errorf("Old reading changed the state: %+v", st)
+	}
+
+	for _, state := range []string{types.AlertFiring, types.AlertOK} {
+		select {
+		case ev := <-events:
+			if ev.State != state || ev.Rule != "freezing" || ev.Sensor != "sensor1" {
+				t.Errorf("Unexpected notification: %+v", ev)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("No %s notification", state)
+		}
+	}
+
+	history, err := tldb.AlertEvents(10)
+	if err != nil || len(history) != 2 || history[0].State != types.AlertOK {
+		t.Errorf("Unexpected history: %+v %v", history, err)
+	}
+
+	// The state survives a restart
+	ae.Evaluate([]types.THData{reading(22, 30)})
+	ae, err = NewAlertEngine(tldb, cfg)
+	if err != nil {
+		t.Fatalf("Could not restart alerts: %s", err.Error())
+	}
+	if st := ae.Statuses(); len(st) != 1 || st[0].State != types.AlertPending {
+		t.Errorf("State not restored: %+v", st)
+	}
+}
+
+func TestAlertRateAndNoData(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	cfg := types.AlertCfg{Rules: []types.AlertRule{
+		{Name: "drop", Kind: types.AlertRate, Threshold: -10, WindowMinutes: 30},
+		{Name: "silent", Sensor: "sensor1", Kind: types.AlertNoData, ForMinutes: 15},
+	}}
+	if err := validateAlertCfg(&cfg); err != nil {
+		t.Fatalf("Invalid configuration: %s", err.Error())
+	}
+	ae, err := NewAlertEngine(tldb, cfg)
+	if err != nil {
+		t.Fatalf("Could not start alerts: %s", err.Error())
+	}
+	var records []types.THData
+	for i := 0; i <= 30; i += 2 {
+		// Falling 12 F per hour
+		records = append(records, reading(i, 50-float32(i)/5))
+	}
+	ae.Evaluate(records)
+	states := make(map[string]types.AlertStatus)
+	for _, st := range ae.Statuses() {
+		states[st.Rule] = st
+	}
+	if states["drop"].State != types.AlertFiring || states["drop"].Value > -11.9 || states["drop"].Value < -12.1 {
+		t.Errorf("Unexpected rate state: %+v", states["drop"])
+	}
+
+	last := time.Date(2024, 1, 14, 0, 30, 0, 0, time.UTC)
+	ae.CheckNoData(last.Add(10 * time.Minute))
+	if st := ae.Statuses(); st[1].State != types.AlertOK {
+		t.Errorf("Fired too early: %+v", st[1])
+	}
+	ae.CheckNoData(last.Add(20 * time.Minute))
+	if st := ae.Statuses(); st[1].State != types.AlertFiring {
+		t.Errorf("Expected the nodata rule to fire: %+v", st[1])
+	}
+	ae.Evaluate([]types.THData{reading(52, 40)})
+	if st := ae.Statuses(); st[1].State != types.AlertOK {
+		t.Errorf("Expected new data to clear the nodata rule: %+v", st[1])
+	}
+
+	w := httptest.NewRecorder()
+	TLWeb{Tldb: tldb, Alerts: ae}.APIAlerts(w, httptest.NewRequest("GET", "/api/v1/alerts", nil))
+	var alertsPage types.AlertsPage
+	if err := json.Unmarshal(w.Body.Bytes(), &alertsPage); err != nil {
+		t.Fatalf("Could not parse response: %s", err.Error())
+	}
+	if len(alertsPage.Rules) != 2 || len(alertsPage.Statuses) != 2 || len(alertsPage.Events) != 3 {
+		t.Errorf("Unexpected alerts: %+v", alertsPage)
+	}
+	w = httptest.NewRecorder()
+	TLWeb{Tldb: tldb, Alerts: ae}.ShowAlerts(w, httptest.NewRequest("GET", "/alerts", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Unexpected status page response: %d", w.Code)
+	}
+}
+
+func TestAlertNoDataRestart(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	cfg := types.AlertCfg{Rules: []types.AlertRule{{Name: "silent", Sensor: "sensor2", Kind: types.AlertNoData, ForMinutes: 15}}}
+	if err := validateAlertCfg(&cfg); err != nil {
+		t.Fatalf("Invalid configuration: %s", err.Error())
+	}
+	ae, err := NewAlertEngine(tldb, cfg)
+	if err != nil {
+		t.Fatalf("Could not start alerts: %s", err.Error())
+	}
+	// A silence ends at the first reading, which saves the state, and the
+	// readings after it change nothing worth saving
+	ae.CheckNoData(time.Date(2024, 1, 14, 0, 0, 0, 0, time.UTC))
+	ae.CheckNoData(time.Date(2024, 1, 14, 0, 20, 0, 0, time.UTC))
+	var records []types.THData
+	for i := 30; i <= 60; i += 5 {
+		thd := reading(i, 50)
+		thd.ID = "sensor2"
+		records = append(records, thd)
+	}
+	ae.Evaluate(records[:1])
+	if st, _ := tldb.AlertStatuses(); len(st) != 1 || st[0].State != types.AlertOK {
+		t.Fatalf("Expected the cleared state to be saved: %+v", st)
+	}
+	imported, err := tldb.ImportRecords(records)
+	if err != nil || len(imported.Inserted) != len(records) {
+		t.Fatalf("ImportRecords: %v %+v", err, imported)
+	}
+	ae.Evaluate(imported.Inserted[1:])
+
+	ae, err = NewAlertEngine(tldb, cfg)
+	if err != nil {
+		t.Fatalf("Could not restart alerts: %s", err.Error())
+	}
+	// Ten minutes after the last reading the sensor is not silent
+	ae.CheckNoData(time.Date(2024, 1, 14, 1, 10, 0, 0, time.UTC))
+	if st := ae.Statuses(); len(st) != 1 || st[0].State != types.AlertOK {
+		t.Errorf("Healthy sensor alerted after a restart: %+v", st)
+	}
+	ae.CheckNoData(time.Date(2024, 1, 14, 1, 20, 0, 0, time.UTC))
+	if st := ae.Statuses(); len(st) != 1 || st[0].State != types.AlertFiring {
+		t.Errorf("Expected the silence to be caught after a restart: %+v", st)
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"tempLogger/types"
+	"time"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+const (
+	defaultPageLimit = 1000
+	maxPageLimit     = 10000
+)
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+type apiReadings struct {
+	Sensor   string         `json:"sensor"`
+	Readings []types.THData `json:"readings"`
+	// Next is the cursor for the following page, empty on the last page.
+	Next string `json:"next,omitempty"`
+}
+
+// writeJSON marshals v and writes it with an ETag derived from the body.  A
+// matching If-None-Match returns 304 without a body.
+func writeJSON(w http.ResponseWriter, req *http.Request, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		log.Println("writeJSON: Error marshalling response:", err.Error())
+		http.Error(w, "Internal error", http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf("\"%x\"", sum[:16])
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache")
+	if status == http.StatusOK && etagMatch(req.Header.Values("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// etagMatch reports whether the If-None-Match header fields match etag,
+// as RFC 9110 compares them: * matches any tag, and the tags of the list
+// are compared weakly, ignoring a W/ prefix.
+func etagMatch(fields []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, field := range fields {
+		for rest := field; ; {
+			rest = strings.TrimLeft(rest, " \t,")
+			if rest == "" {
+				break
+			}
+			if rest[0] == '*' {
+				return true
+			}
+			rest = strings.TrimPrefix(rest, "W/")
+			if !strings.HasPrefix(rest, `"`) {
+				// Not an entity tag, so the rest of the field is not
+				// either
+				break
+			}
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				break
+			}
+			if rest[:end+2] == etag {
+				return true
+			}
+			rest = rest[end+2:]
+		}
+	}
+	return false
+}
+
+func writeAPIError(w http.ResponseWriter, req *http.Request, status int, msg string) {
+	writeJSON(w, req, status, apiError{Error: msg})
+}
+
+// parseRangeParams reads the from and to query parameters, defaulting to
+// the last 24 hours.
+func parseRangeParams(req *http.Request) (begin time.Time, end time.Time, err error) {
+	query := req.URL.Query()
+	end, err = parseTimeParam(query.Get("to"), time.Now())
+	if err != nil {
+		return
+	}
+	begin, err = parseTimeParam(query.Get("from"), end.Add(-time.Hour*24))
+	return
+}
+
+// APISensors handles GET /api/v1/sensors?site=
+func (tlweb TLWeb) APISensors(w http.ResponseWriter, req *http.Request) {
+	all := tlweb.SensorList()
+	site, err := requestSite(req, all)
+	if err != nil {
+		writeAPIError(w, req, http.StatusNotFound, err.Error())
+		return
+	}
+	sensors := []types.SensorCfg{}
+	for _, sensor := range filterSite(all, site) {
+		if tlweb.Tldb.HasTable(sensor.ID) {
+			sensors = append(sensors, sensor)
+		}
+	}
+	writeJSON(w, req, http.StatusOK, sensors)
+}
+
+// APISensor handles the registry entry of one sensor:
+//
+//	GET  /api/v1/sensors/{id}
+//	PUT  /api/v1/sensors/{id}
+//	GET  /api/v1/sensors/{id}/calibrations
+//	POST /api/v1/sensors/{id}/calibrations
+func (tlweb TLWeb) APISensor(w http.ResponseWriter, req *http.Request) {
+	path := strings.Split(strings.TrimPrefix(req.URL.Path, "/api/v1/sensors/"), "/")
+	sensor := path[0]
+	if !tlweb.Tldb.HasTable(sensor) {
+		writeAPIError(w, req, http.StatusNotFound, "Unknown sensor: "+sensor)
+		return
+	}
+	switch {
+	case len(path) == 1 && req.Method == http.MethodGet:
+		for _, val := range tlweb.SensorList() {
+			if val.ID == sensor {
+				writeJSON(w, req, http.StatusOK, val)
+				return
+			}
+		}
+		writeAPIError(w, req, http.StatusNotFound, "Unknown sensor: "+sensor)
+	case len(path) == 1 && req.Method == http.MethodPut:
+		var sensorCfg types.SensorCfg
+		if err := json.NewDecoder(req.Body).Decode(&sensorCfg); err != nil {
+			writeAPIError(w, req, http.StatusBadRequest, "Invalid sensor: "+err.Error())
+			return
+		}
+		sensorCfg.ID = sensor
+		if err := validateSensorCfg(sensorCfg); err != nil {
+			writeAPIError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err := tlweb.Tldb.UpdateSensor(sensorCfg); err != nil {
+			log.Println("APISensor:", err.Error())
+			writeAPIError(w, req, http.StatusInternalServerError, "Error updating sensor")
+			return
+		}
+		sensorCfg.Calibrations = tlweb.Tldb.Calibrations(sensor)
+		writeJSON(w, req, http.StatusOK, sensorCfg)
+	case len(path) == 2 && path[1] == "calibrations" && req.Method == http.MethodGet:
+		cals := append([]types.Calibration{}, tlweb.Tldb.Calibrations(sensor)...)
+		writeJSON(w, req, http.StatusOK, cals)
+	case len(path) == 2 && path[1] == "calibrations" && req.Method == http.MethodPost:
+		// Scale defaults to 1 and the effective time to now
+		var body struct {
+			Metric    string     `json:"metric"`
+			Offset    float32    `json:"offset"`
+			Scale     *float32   `json:"scale"`
+			Effective *time.Time `json:"effective"`
+		}
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			writeAPIError(w, req, http.StatusBadRequest, "Invalid calibration: "+err.Error())
+			return
+		}
+		cal := types.Calibration{Metric: body.Metric, Offset: body.Offset, Scale: 1, Effective: time.Now()}
+		if body.Scale != nil {
+			cal.Scale = *body.Scale
+		}
+		if body.Effective != nil {
+			cal.Effective = *body.Effective
+		}
+		if err := tlweb.Tldb.AddCalibration(sensor, cal); err != nil {
+			writeAPIError(w, req, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeJSON(w, req, http.StatusCreated, tlweb.Tldb.Calibrations(sensor))
+	case len(path) == 1 || (len(path) == 2 && path[1] == "calibrations"):
+		writeAPIError(w, req, http.StatusMethodNotAllowed, "Method not allowed: "+req.Method)
+	default:
+		writeAPIError(w, req, http.StatusNotFound, "Not found: "+req.URL.Path)
+	}
+}
+
+// APIReadings handles GET /api/v1/readings?sensor=&from=&to=&limit=&cursor=
+//
+// The cursor is the Unix time of the last reading on the previous page.
+// Readings are strictly after it, so it can be passed back unchanged.
+func (tlweb TLWeb) APIReadings(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	sensor := query.Get("sensor")
+	if !tlweb.Tldb.HasTable(sensor) {
+		writeAPIError(w, req, http.StatusNotFound, "Unknown sensor: "+sensor)
+		return
+	}
+	begin, end, err := parseRangeParams(req)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	limit := defaultPageLimit
+	if val := query.Get("limit"); val != "" {
+		limit, err = strconv.Atoi(val)
+		if err != nil || limit <= 0 || limit > maxPageLimit {
+			writeAPIError(w, req, http.StatusBadRequest,
+				fmt.Sprintf("limit must be between 1 and %d", maxPageLimit))
+			return
+		}
+	}
+	if val := query.Get("cursor"); val != "" {
+		cursor, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			writeAPIError(w, req, http.StatusBadRequest, "Invalid cursor: "+val)
+			return
+		}
+		begin = time.Unix(cursor, 0)
+	}
+
+	// Ask for one extra record to find out if there is another page
+	tlList, err := tlweb.Tldb.RetrieveRecordsLimit(sensor, begin, end, limit+1)
+	if err != nil {
+		log.Println("APIReadings:", err.Error())
+		writeAPIError(w, req, http.StatusInternalServerError, "Error retrieving readings")
+		return
+	}
+	resp := apiReadings{Sensor: sensor, Readings: []types.THData{}}
+	if len(tlList) > limit {
+		tlList = tlList[:limit]
+		last, err := time.Parse(time.RFC3339, tlList[limit-1].TimeStamp)
+		if err == nil {
+			resp.Next = strconv.FormatInt(last.Unix(), 10)
+		}
+	}
+	resp.Readings = append(resp.Readings, tlList...)
+	writeJSON(w, req, http.StatusOK, resp)
+}
+
+// APISummaries handles GET /api/v1/summaries?sensor=&site=&from=&to=&units=.
+// The sensor parameter may be repeated and defaults to every sensor, or
+// every sensor at site.
+func (tlweb TLWeb) APISummaries(w http.ResponseWriter, req *http.Request) {
+	begin, end, err := parseRangeParams(req)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	unit, err := tlweb.RequestUnits(w, req)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	wanted := req.URL.Query()["sensor"]
+	for _, sensor := range wanted {
+		if !tlweb.Tldb.HasTable(sensor) {
+			writeAPIError(w, req, http.StatusNotFound, "Unknown sensor: "+sensor)
+			return
+		}
+	}
+	all := tlweb.SensorList()
+	site, err := requestSite(req, all)
+	if err != nil {
+		writeAPIError(w, req, http.StatusNotFound, err.Error())
+		return
+	}
+	summaries := []types.TLSummary{}
+	for _, sensor := range filterSite(all, site) {
+		if !tlweb.Tldb.HasTable(sensor.ID) || (len(wanted) > 0 && !slices.Contains(wanted, sensor.ID)) {
+			continue
+		}
+		tlData, err := tlweb.Tldb.RetrieveRecords(sensor.ID, begin, end)
+		if err != nil {
+			log.Println("APISummaries:", err.Error())
+			writeAPIError(w, req, http.StatusInternalServerError, "Error retrieving readings")
+			return
+		}
+		interval, learned := tlweb.Tldb.SensorInterval(sensor)
+		summary := NewSensorSummary(sensor, tlData, unit, begin, end, interval)
+		tlweb.addFreshness(&summary, sensor, interval, learned, begin, end, 0, time.Now())
+		summaries = append(summaries, summary)
+	}
+	writeJSON(w, req, http.StatusOK, summaries)
+}
+
+// APILatest handles GET /api/v1/latest?site=
+func (tlweb TLWeb) APILatest(w http.ResponseWriter, req *http.Request) {
+	all := tlweb.SensorList()
+	site, err := requestSite(req, all)
+	if err != nil {
+		writeAPIError(w, req, http.StatusNotFound, err.Error())
+		return
+	}
+	latest := []types.THData{}
+	for _, sensor := range filterSite(all, site) {
+		if !tlweb.Tldb.HasTable(sensor.ID) {
+			continue
+		}
+		thd, found, err := tlweb.Tldb.LatestRecord(sensor.ID)
+		if err != nil {
+			log.Println("APILatest:", err.Error())
+			writeAPIError(w, req, http.StatusInternalServerError, "Error retrieving readings")
+			return
+		}
+		if found {
+			thd.Site = sensor.Site
+			latest = append(latest, thd)
+		}
+	}
+	writeJSON(w, req, http.StatusOK, latest)
+}
+
+// OpenAPI serves the API description embedded in the binary.
+func (tlweb TLWeb) OpenAPI(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeContent(w, req, "openapi.json", time.Time{}, bytes.NewReader(openAPISpec))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tempLogger/types"
+	"testing"
+)
+
+func TestAPIReadingsPagination(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	total := 0
+	cursor := ""
+	for pages := 0; pages < 10; pages++ {
+		url := "/api/v1/readings?sensor=sensor1&from=1705298580&to=1705300900&limit=5"
+		if cursor != "" {
+			url += "&cursor=" + cursor
+		}
+		w := httptest.NewRecorder()
+		tlWeb.APIReadings(w, httptest.NewRequest("GET", url, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("Unexpected status: %d: %s", w.Code, w.Body.String())
+		}
+		var resp apiReadings
+		if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("Could not parse response: %s", err.Error())
+		}
+		total += len(resp.Readings)
+		cursor = resp.Next
+		if cursor == "" {
+			break
+		}
+	}
+	if total != 19 {
+		t.Errorf("Incorrect number of paged records: Expected %d, Actual %d", 19, total)
+	}
+}
+
+func TestAPIETag(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	w := httptest.NewRecorder()
+	tlWeb.APISensors(w, httptest.NewRequest("GET", "/api/v1/sensors", nil))
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("Expected 200 with an ETag, got %d %q", w.Code, etag)
+	}
+	var sensors []types.SensorCfg
+	if err := json.Unmarshal(w.Body.Bytes(), &sensors); err != nil {
+		t.Fatalf("Could not parse response: %s", err.Error())
+	}
+	if len(sensors) != 1 || sensors[0].ID != "sensor1" {
+		t.Errorf("Unexpected sensors: %v", sensors)
+	}
+
+	req := httptest.NewRequest("GET", "/api/v1/sensors", nil)
+	req.Header.Set("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	tlWeb.APISensors(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	for header, match := range map[string]bool{
+		`"a", ` + etag + `, "b"`: true,
+		`"a","b"`:                false,
+		`W/` + etag:              true,
+		`"x,y", W/` + etag:       true,
+		`*`:                      true,
+		`"` + etag:               false,
+		strings.Trim(etag, `"`):  false,
+	} {
+		req = httptest.NewRequest("GET", "/api/v1/sensors", nil)
+		req.Header.Set("If-None-Match", header)
+		w = httptest.NewRecorder()
+		tlWeb.APISensors(w, req)
+		if (w.Code == http.StatusNotModified) != match {
+			t.Errorf("If-None-Match %s: Expected match %v, got %d", header, match, w.Code)
+		}
+	}
+	// Tags may also come in several header fields
+	req = httptest.NewRequest("GET", "/api/v1/sensors", nil)
+	req.Header.Add("If-None-Match", `"a"`)
+	req.Header.Add("If-None-Match", etag)
+	w = httptest.NewRecorder()
+	tlWeb.APISensors(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected %d for a tag in a second field, got %d", http.StatusNotModified, w.Code)
+	}
+}
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec map[string]any
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("Embedded OpenAPI spec is not valid JSON: %s", err.Error())
+	}
+}
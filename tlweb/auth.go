@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"tempLogger/types"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	sessionCookie   = "tlweb_session"
+	sessionLifetime = 30 * 24 * time.Hour
+	// tokenPrefix marks API tokens so they are easy to spot in logs and
+	// configuration files.
+	tokenPrefix = "tlw_"
+	minPassword = 8
+	// loginDelay slows down password guessing.
+	loginDelay = time.Second
+)
+
+// errBadLogin is returned for both unknown users and wrong passwords.
+var errBadLogin = errors.New("Invalid name or password")
+
+// dummyHash is compared against when the user does not exist, so the
+// response takes as long as for a wrong password.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("tempLogger"), bcrypt.DefaultCost)
+	return hash
+})
+
+func validRole(role string) bool {
+	return role == types.RoleViewer || role == types.RoleAdmin || role == types.RoleIngest
+}
+
+// roleAllows reports whether role has at least the rights of required.
+func roleAllows(role string, required string) bool {
+	switch required {
+	case "":
+		return true
+	case types.RoleViewer:
+		return role == types.RoleViewer || role == types.RoleAdmin
+	case types.RoleIngest:
+		return role == types.RoleIngest || role == types.RoleAdmin
+	}
+	return role == types.RoleAdmin
+}
+
+func (tldb TLDB) migrateAuth() (err error) {
+	for _, sqlStmt := range []string{
+		"create table if not exists tluser (name text not null primary key, hash text not null, role text not null, created integer not null)",
+		"create table if not exists tlsession (id text not null primary key, user text not null, expires integer not null)",
+		"create table if not exists tltoken (id integer not null primary key, name text not null, hash text not null unique, role text not null, created integer not null, last_used integer not null default 0)",
+	} {
+		if _, err = tldb.DB.Exec(sqlStmt); err != nil {
+			err = fmt.Errorf("migrateAuth: Error creating table: %s: %w", sqlStmt, err)
+			return
+		}
+	}
+	if err = tldb.addColumns("tltoken", []column{{"site", "text not null default ''"}}); err != nil {
+		err = fmt.Errorf("migrateAuth: %w", err)
+	}
+	return
+}
+
+// randomSecret returns 32 random bytes, encoded for use in a cookie or
+// header.
+func randomSecret() (secret string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		err = fmt.Errorf("randomSecret: %w", err)
+		return
+	}
+	secret = base64.RawURLEncoding.EncodeToString(b)
+	return
+}
+
+// hashSecret is how session ids and tokens are stored, so a copy of the
+// database does not let anyone sign in.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func hashPassword(password string) (hash []byte, err error) {
+	if len(password) < minPassword {
+		err = fmt.Errorf("hashPassword: Passwords must be at least %d characters", minPassword)
+		return
+	}
+	hash, err = bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		err = fmt.Errorf("hashPassword: %w", err)
+	}
+	return
+}
+
+// AddUser creates a user with a bcrypt hash of password.
+func (tldb TLDB) AddUser(name string, password string, role string) (err error) {
+	if name == "" {
+		err = errors.New("AddUser: A name is required")
+		return
+	}
+	if !validRole(role) {
+		err = fmt.Errorf("AddUser: Invalid role %q; must be %s, %s or %s", role, types.RoleViewer, types.RoleIngest, types.RoleAdmin)
+		return
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		err = fmt.Errorf("AddUser: %w", err)
+		return
+	}
+	_, err = tldb.DB.Exec("insert into tluser(name, hash, role, created) values(?, ?, ?, ?)", name, string(hash), role, time.Now().Unix())
+	if err != nil {
+		err = fmt.Errorf("AddUser: Error adding %s: %w", name, err)
+	}
+	return
+}
+
+// SetPassword changes the password of a user and signs them out everywhere.
+func (tldb TLDB) SetPassword(name string, password string) (err error) {
+	hash, err := hashPassword(password)
+	if err != nil {
+		err = fmt.Errorf("SetPassword: %w", err)
+		return
+	}
+	res, err := tldb.DB.Exec("update tluser set hash = ? where name = ?", string(hash), name)
+	if err != nil {
+		err = fmt.Errorf("SetPassword: Error updating %s: %w", name, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = fmt.Errorf("SetPassword: No user %s", name)
+		return
+	}
+	if _, err = tldb.DB.Exec("delete from tlsession where user = ?", name); err != nil {
+		err = fmt.Errorf("SetPassword: Error ending sessions of %s: %w", name, err)
+	}
+	return
+}
+
+// DeleteUser removes a user and their sessions.
+func (tldb TLDB) DeleteUser(name string) (err error) {
+	res, err := tldb.DB.Exec("delete from tluser where name = ?", name)
+	if err != nil {
+		err = fmt.Errorf("DeleteUser: Error deleting %s: %w", name, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = fmt.Errorf("DeleteUser: No user %s", name)
+		return
+	}
+	if _, err = tldb.DB.Exec("delete from tlsession where user = ?", name); err != nil {
+		err = fmt.Errorf("DeleteUser: Error ending sessions of %s: %w", name, err)
+	}
+	return
+}
+
+// Users lists the users by name.
+func (tldb TLDB) Users() (users []types.User, err error) {
+	rows, err := tldb.DB.Query("select name, role, created from tluser order by name")
+	if err != nil {
+		err = fmt.Errorf("Users: Error querying tluser: %w", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var user types.User
+		var created int64
+		if err = rows.Scan(&user.Name, &user.Role, &created); err != nil {
+			err = fmt.Errorf("Users: Error reading query of tluser: %w", err)
+			return
+		}
+		user.Created = time.Unix(created, 0)
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("Users: General error reading query of tluser: %w", err)
+	}
+	return
+}
+
+// CheckPassword returns the user if password is theirs, or errBadLogin.
+func (tldb TLDB) CheckPassword(name string, password string) (user types.User, err error) {
+	var hash string
+	var created int64
+	err = tldb.DB.QueryRow("select hash, role, created from tluser where name = ?", name).Scan(&hash, &user.Role, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		err = errBadLogin
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("CheckPassword: Error querying %s: %w", name, err)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) != nil {
+		err = errBadLogin
+		return
+	}
+	user.Name = name
+	user.Created = time.Unix(created, 0)
+	return
+}
+
+// NewSession starts a session for a user, returning the id for the cookie.
+// Expired sessions are removed.
+func (tldb TLDB) NewSession(name string, now time.Time) (id string, err error) {
+	if id, err = randomSecret(); err != nil {
+		err = fmt.Errorf("NewSession: %w", err)
+		return
+	}
+	if _, err = tldb.DB.Exec("delete from tlsession where expires < ?", now.Unix()); err != nil {
+		err = fmt.Errorf("NewSession: Error removing expired sessions: %w", err)
+		return
+	}
+	_, err = tldb.DB.Exec("insert into tlsession(id, user, expires) values(?, ?, ?)", hashSecret(id), name, now.Add(sessionLifetime).Unix())
+	if err != nil {
+		err = fmt.Errorf("NewSession: Error saving session of %s: %w", name, err)
+	}
+	return
+}
+
+// SessionUser returns the user of an unexpired session.
+func (tldb TLDB) SessionUser(id string, now time.Time) (user types.User, found bool, err error) {
+	var created int64
+	err = tldb.DB.QueryRow("select tluser.name, tluser.role, tluser.created from tlsession join tluser on tlsession.user = tluser.name where tlsession.id = ? and tlsession.expires >= ?",
+		hashSecret(id), now.Unix()).Scan(&user.Name, &user.Role, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("SessionUser: Error querying tlsession: %w", err)
+		return
+	}
+	user.Created = time.Unix(created, 0)
+	found = true
+	return
+}
+
+// DeleteSession ends a session.
+func (tldb TLDB) DeleteSession(id string) (err error) {
+	if _, err = tldb.DB.Exec("delete from tlsession where id = ?", hashSecret(id)); err != nil {
+		err = fmt.Errorf("DeleteSession: %w", err)
+	}
+	return
+}
+
+// AddToken creates an API token, limited to sending the readings of site if
+// it is not empty.  Only its hash is kept, so token must be saved by the
+// caller.
+func (tldb TLDB) AddToken(name string, role string, site string) (token string, id int64, err error) {
+	if name == "" {
+		err = errors.New("AddToken: A name is required")
+		return
+	}
+	if !validRole(role) {
+		err = fmt.Errorf("AddToken: Invalid role %q; must be %s, %s or %s", role, types.RoleViewer, types.RoleIngest, types.RoleAdmin)
+		return
+	}
+	if site != "" && !types.ValidSite(site) {
+		err = fmt.Errorf("AddToken: Invalid site %q; must be letters, digits and single underscores", site)
+		return
+	}
+	secret, err := randomSecret()
+	if err != nil {
+		err = fmt.Errorf("AddToken: %w", err)
+		return
+	}
+	token = tokenPrefix + secret
+	res, err := tldb.DB.Exec("insert into tltoken(name, hash, role, site, created) values(?, ?, ?, ?, ?)", name, hashSecret(token), role, site, time.Now().Unix())
+	if err != nil {
+		err = fmt.Errorf("AddToken: Error saving %s: %w", name, err)
+		return
+	}
+	id, err = res.LastInsertId()
+	if err != nil {
+		err = fmt.Errorf("AddToken: %w", err)
+	}
+	return
+}
+
+// Tokens lists the API tokens.
+func (tldb TLDB) Tokens() (tokens []types.APIToken, err error) {
+	rows, err := tldb.DB.Query("select id, name, role, site, created, last_used from tltoken order by id")
+	if err != nil {
+		err = fmt.Errorf("Tokens: Error querying tltoken: %w", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var token types.APIToken
+		var created, lastUsed int64
+		if err = rows.Scan(&token.ID, &token.Name, &token.Role, &token.Site, &created, &lastUsed); err != nil {
+			err = fmt.Errorf("Tokens: Error reading query of tltoken: %w", err)
+			return
+		}
+		token.Created = time.Unix(created, 0)
+		if lastUsed > 0 {
+			token.LastUsed = time.Unix(lastUsed, 0)
+		}
+		tokens = append(tokens, token)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("Tokens: General error reading query of tltoken: %w", err)
+	}
+	return
+}
+
+// RevokeToken deletes an API token.
+func (tldb TLDB) RevokeToken(id int64) (err error) {
+	res, err := tldb.DB.Exec("delete from tltoken where id = ?", id)
+	if err != nil {
+		err = fmt.Errorf("RevokeToken: Error deleting %d: %w", id, err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		err = fmt.Errorf("RevokeToken: No token %d", id)
+	}
+	return
+}
+
+// TokenUser returns the client of an API token and records its use.
+func (tldb TLDB) TokenUser(token string, now time.Time) (user types.User, found bool, err error) {
+	var id, created int64
+	err = tldb.DB.QueryRow("select id, name, role, site, created from tltoken where hash = ?", hashSecret(token)).Scan(&id, &user.Name, &user.Role, &user.Site, &created)
+	if errors.Is(err, sql.ErrNoRows) {
+		err = nil
+		return
+	}
+	if err != nil {
+		err = fmt.Errorf("TokenUser: Error querying tltoken: %w", err)
+		return
+	}
+	if _, err = tldb.DB.Exec("update tltoken set last_used = ? where id = ?", now.Unix(), id); err != nil {
+		err = fmt.Errorf("TokenUser: Error recording use of %s: %w", user.Name, err)
+		return
+	}
+	user.Token = true
+	user.Created = time.Unix(created, 0)
+	found = true
+	return
+}
+
+type userKey struct{}
+
+// requestUser returns the signed in user, or nil if there is none or
+// authentication is off.
+func requestUser(req *http.Request) *types.User {
+	user, _ := req.Context().Value(userKey{}).(*types.User)
+	return user
+}
+
+// authenticate finds the user of a request from its client certificate,
+// bearer token or session cookie.
+func (tlweb TLWeb) authenticate(req *http.Request, now time.Time) (user types.User, found bool, err error) {
+	if name, ok := clientCertName(req); ok && tlweb.ClientCertRole != "" {
+		user = types.User{Name: name, Role: tlweb.ClientCertRole, Token: true}
+		found = true
+		return
+	}
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		token, ok := strings.CutPrefix(auth, "Bearer ")
+		if !ok {
+			return
+		}
+		return tlweb.Tldb.TokenUser(strings.TrimSpace(token), now)
+	}
+	cookie, cerr := req.Cookie(sessionCookie)
+	if cerr != nil {
+		return
+	}
+	return tlweb.Tldb.SessionUser(cookie.Value, now)
+}
+
+// isAPIRequest reports whether the response should be JSON rather than a
+// page.
+func isAPIRequest(req *http.Request) bool {
+	return strings.HasPrefix(req.URL.Path, "/api/") || req.URL.Path == "/metrics"
+}
+
+// sameOrigin reports whether a browser request came from one of our pages.
+// Requests without an Origin header are not from a cross-site form.
+func sameOrigin(req *http.Request) bool {
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == req.Host
+}
+
+// Authorize requires the signed in user to have role to read, and the admin
+// role to change anything, when authentication is on.  Routes for the
+// ingest role take writes from it too.
+func (tlweb TLWeb) Authorize(role string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if !tlweb.AuthRequired || role == "" {
+			fn(w, req)
+			return
+		}
+		user, found, err := tlweb.authenticate(req, time.Now())
+		if err != nil {
+			log.Println("Authorize:", err.Error())
+			tlweb.authError(w, req, http.StatusInternalServerError, "Error checking credentials")
+			return
+		}
+		if !found {
+			tlweb.authError(w, req, http.StatusUnauthorized, "Sign in or send an API token")
+			return
+		}
+		required := role
+		switch req.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if role != types.RoleIngest {
+				required = types.RoleAdmin
+			}
+			if !user.Token && !sameOrigin(req) {
+				tlweb.authError(w, req, http.StatusForbidden, "Cross-site request refused")
+				return
+			}
+		}
+		if !roleAllows(user.Role, required) {
+			tlweb.authError(w, req, http.StatusForbidden, "This needs the "+required+" role")
+			return
+		}
+		fn(w, req.WithContext(context.WithValue(req.Context(), userKey{}, &user)))
+	}
+}
+
+// authError refuses a request, sending people to the sign in page.
+func (tlweb TLWeb) authError(w http.ResponseWriter, req *http.Request, status int, msg string) {
+	if isAPIRequest(req) {
+		if status == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="tlweb"`)
+		}
+		writeAPIError(w, req, status, msg)
+		return
+	}
+	if status == http.StatusUnauthorized {
+		http.Redirect(w, req, "/login?next="+url.QueryEscape(req.URL.RequestURI()), http.StatusSeeOther)
+		return
+	}
+	tlweb.templates().Error(w, req, status, msg)
+}
+
+// safeNext keeps the redirect after signing in on this site.
+func safeNext(next string) string {
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	return next
+}
+
+// Login shows the sign in form and starts a session.
+func (tlweb TLWeb) Login(w http.ResponseWriter, req *http.Request) {
+	page := types.LoginPage{Next: safeNext(req.FormValue("next"))}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead:
+		tlweb.templates().Render(w, req, http.StatusOK, "login", page)
+		return
+	case http.MethodPost:
+	default:
+		tlweb.templates().Error(w, req, http.StatusMethodNotAllowed, "Method not allowed: "+req.Method)
+		return
+	}
+	if !sameOrigin(req) {
+		tlweb.templates().Error(w, req, http.StatusForbidden, "Cross-site request refused")
+		return
+	}
+	page.Name = req.PostFormValue("name")
+	user, err := tlweb.Tldb.CheckPassword(page.Name, req.PostFormValue("password"))
+	if err != nil {
+		if !errors.Is(err, errBadLogin) {
+			log.Println("Login:", err.Error())
+		}
+		time.Sleep(loginDelay)
+		page.Error = errBadLogin.Error()
+		tlweb.templates().Render(w, req, http.StatusUnauthorized, "login", page)
+		return
+	}
+	id, err := tlweb.Tldb.NewSession(user.Name, time.Now())
+	if err != nil {
+		log.Println("Login:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusInternalServerError, "Could not sign in")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		MaxAge:   int(sessionLifetime / time.Second),
+		HttpOnly: true,
+		Secure:   req.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, req, page.Next, http.StatusSeeOther)
+}
+
+// Logout ends the session.
+func (tlweb TLWeb) Logout(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		tlweb.templates().Error(w, req, http.StatusMethodNotAllowed, "Method not allowed: "+req.Method)
+		return
+	}
+	if cookie, err := req.Cookie(sessionCookie); err == nil {
+		if err = tlweb.Tldb.DeleteSession(cookie.Value); err != nil {
+			log.Println("Logout:", err.Error())
+		}
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1, HttpOnly: true, SameSite: http.SameSiteLaxMode})
+	http.Redirect(w, req, "/login", http.StatusSeeOther)
+}
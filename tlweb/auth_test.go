@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestUsersAndSessions(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	if err := tldb.AddUser("alice", "short", types.RoleAdmin); err == nil {
+		t.Error("Expected a short password to fail")
+	}
+	if err := tldb.AddUser("alice", "correct horse", "owner"); err == nil {
+		t.Error("Expected an unknown role to fail")
+	}
+	if err := tldb.AddUser("alice", "correct horse", types.RoleAdmin); err != nil {
+		t.Fatalf("AddUser: %s", err.Error())
+	}
+	if err := tldb.AddUser("alice", "battery staple", types.RoleViewer); err == nil {
+		t.Error("Expected a duplicate user to fail")
+	}
+	if _, err := tldb.CheckPassword("alice", "wrong password"); err != errBadLogin {
+		t.Errorf("Expected errBadLogin, got %v", err)
+	}
+	if _, err := tldb.CheckPassword("bob", "correct horse"); err != errBadLogin {
+		t.Errorf("Expected errBadLogin, got %v", err)
+	}
+	user, err := tldb.CheckPassword("alice", "correct horse")
+	if err != nil || user.Name != "alice" || user.Role != types.RoleAdmin {
+		t.Fatalf("CheckPassword: %+v %v", user, err)
+	}
+
+	now := time.Now()
+	id, err := tldb.NewSession("alice", now)
+	if err != nil {
+		t.Fatalf("NewSession: %s", err.Error())
+	}
+	if user, found, err := tldb.SessionUser(id, now); !found || err != nil || user.Name != "alice" {
+		t.Errorf("SessionUser: %+v %v %v", user, found, err)
+	}
+	if _, found, _ := tldb.SessionUser(id, now.Add(sessionLifetime+time.Minute)); found {
+		t.Error("Expired session still valid")
+	}
+	if _, found, _ := tldb.SessionUser("forged", now); found {
+		t.Error("Unknown session valid")
+	}
+
+	// Changing the password signs out everywhere
+	if err = tldb.SetPassword("alice", "battery staple"); err != nil {
+		t.Fatalf("SetPassword: %s", err.Error())
+	}
+	if _, found, _ := tldb.SessionUser(id, now); found {
+		t.Error("Session survived a password change")
+	}
+	if _, err = tldb.CheckPassword("alice", "battery staple"); err != nil {
+		t.Errorf("New password refused: %s", err.Error())
+	}
+	if err = tldb.DeleteUser("alice"); err != nil {
+		t.Fatalf("DeleteUser: %s", err.Error())
+	}
+	if users, _ := tldb.Users(); len(users) != 0 {
+		t.Errorf("Unexpected users: %+v", users)
+	}
+}
+
+func TestTokens(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	token, id, err := tldb.AddToken("ingest", types.RoleViewer, "")
+	if err != nil || !strings.HasPrefix(token, tokenPrefix) {
+		t.Fatalf("AddToken: %s %v", token, err)
+	}
+	now := time.Unix(1705300000, 0)
+	user, found, err := tldb.TokenUser(token, now)
+	if !found || err != nil || user.Name != "ingest" || !user.Token {
+		t.Errorf("TokenUser: %+v %v %v", user, found, err)
+	}
+	tokens, err := tldb.Tokens()
+	if err != nil || len(tokens) != 1 || !tokens[0].LastUsed.Equal(now) {
+		t.Errorf("Tokens: %+v %v", tokens, err)
+	}
+	if err = tldb.RevokeToken(id); err != nil {
+		t.Fatalf("RevokeToken: %s", err.Error())
+	}
+	if _, found, _ = tldb.TokenUser(token, now); found {
+		t.Error("Revoked token still valid")
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	viewer, _, _ := tldb.AddToken("dashboard", types.RoleViewer, "")
+	admin, _, _ := tldb.AddToken("setup", types.RoleAdmin, "")
+	logger, _, _ := tldb.AddToken("logger", types.RoleIngest, "")
+	tlWeb := TLWeb{Tldb: tldb, AuthRequired: true}
+	ok := func(w http.ResponseWriter, req *http.Request) {
+		if requestUser(req) == nil && !strings.HasPrefix(req.URL.Path, "/static/") {
+			t.Errorf("%s: No user in the request", req.URL.Path)
+		}
+	}
+
+	for _, test := range []struct {
+		method string
+		path   string
+		token  string
+		role   string
+		status int
+	}{
+		{"GET", "/", "", types.RoleViewer, http.StatusSeeOther},
+		{"GET", "/api/v1/sensors", "", types.RoleViewer, http.StatusUnauthorized},
+		{"GET", "/api/v1/sensors", "tlw_forged", types.RoleViewer, http.StatusUnauthorized},
+		{"GET", "/api/v1/sensors", viewer, types.RoleViewer, http.StatusOK},
+		{"PUT", "/api/v1/sensors/sensor1", viewer, types.RoleViewer, http.StatusForbidden},
+		{"PUT", "/api/v1/sensors/sensor1", admin, types.RoleViewer, http.StatusOK},
+		{"GET", "/static/tlweb.css", "", "", http.StatusOK},
+		{"POST", types.IngestPath, logger, types.RoleIngest, http.StatusOK},
+		{"POST", types.IngestPath, admin, types.RoleIngest, http.StatusOK},
+		{"POST", types.IngestPath, viewer, types.RoleIngest, http.StatusForbidden},
+		{"GET", "/api/v1/sensors", logger, types.RoleViewer, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.token != "" {
+			req.Header.Set("Authorization", "Bearer "+test.token)
+		}
+		w := httptest.NewRecorder()
+		tlWeb.Authorize(test.role, ok)(w, req)
+		if w.Code != test.status {
+			t.Errorf("%s %s: Expected %d, got %d", test.method, test.path, test.status, w.Code)
+		}
+	}
+
+	// Everything is open with authentication off
+	w := httptest.NewRecorder()
+	TLWeb{Tldb: tldb}.Authorize(types.RoleViewer, func(w http.ResponseWriter, req *http.Request) {})(w, httptest.NewRequest("PUT", "/api/v1/sensors/sensor1", nil))
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+}
+
+func TestLogin(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	if err := tldb.AddUser("alice", "correct horse", types.RoleAdmin); err != nil {
+		t.Fatalf("AddUser: %s", err.Error())
+	}
+	tlWeb := TLWeb{Tldb: tldb, AuthRequired: true}
+	login := func(password string, next string, origin string) *httptest.ResponseRecorder {
+		form := url.Values{"name": {"alice"}, "password": {password}, "next": {next}}
+		req := httptest.NewRequest("POST", "/login", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		w := httptest.NewRecorder()
+		tlWeb.Login(w, req)
+		return w
+	}
+
+	if w := login("wrong password", "/", ""); w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), errBadLogin.Error()) {
+		t.Errorf("Unexpected response to a wrong password: %d", w.Code)
+	}
+	if w := login("correct horse", "/", "https://evil.example"); w.Code != http.StatusForbidden {
+		t.Errorf("Expected a cross-site login to fail, got %d", w.Code)
+	}
+	w := login("correct horse", "//evil.example/", "")
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/" {
+		t.Errorf("Unexpected redirect: %d %s", w.Code, w.Header().Get("Location"))
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != sessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("Unexpected cookies: %+v", cookies)
+	}
+
+	// The session signs in the pages, and shows who is signed in
+	req := httptest.NewRequest("GET", "/alerts", nil)
+	req.AddCookie(cookies[0])
+	w = httptest.NewRecorder()
+	tlWeb.Authorize(types.RoleViewer, tlWeb.ShowAlerts)(w, req)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "alice") {
+		t.Errorf("Unexpected page: %d", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/logout", nil)
+	req.AddCookie(cookies[0])
+	tlWeb.Logout(httptest.NewRecorder(), req)
+	if _, found, _ := tldb.SessionUser(cookies[0].Value, time.Now()); found {
+		t.Error("Session survived signing out")
+	}
+}
+
+func TestUserAndTokenCmd(t *testing.T) {
+	tldb := newTestDB(t)
+	tldb.Close()
+
+	var out bytes.Buffer
+	err := userCmd([]string{"add", "-db", testDbPath, "-role", "admin", "alice"}, strings.NewReader("correct horse\n"), &out)
+	if err != nil {
+		t.Fatalf("user add: %s", err.Error())
+	}
+	out.Reset()
+	if err = userCmd([]string{"list", "-db", testDbPath}, nil, &out); err != nil || !strings.Contains(out.String(), "alice") {
+		t.Errorf("user list: %v: %s", err, out.String())
+	}
+	if err = userCmd([]string{"del", "-db", testDbPath}, nil, &out); err == nil {
+		t.Error("Expected user del without a name to fail")
+	}
+	out.Reset()
+	if err = tokenCmd([]string{"add", "-db", testDbPath, "ingest"}, &out); err != nil || !strings.Contains(out.String(), tokenPrefix) {
+		t.Errorf("token add: %v: %s", err, out.String())
+	}
+	if err = tokenCmd([]string{"revoke", "-db", testDbPath, "1"}, &out); err != nil {
+		t.Errorf("token revoke: %s", err.Error())
+	}
+	if err = tokenCmd([]string{"revoke", "-db", testDbPath, "1"}, &out); err == nil {
+		t.Error("Expected revoking twice to fail")
+	}
+}
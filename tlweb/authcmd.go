@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"tempLogger/types"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+const userUsage = `usage: tlweb user add [-db PATH] [-role viewer|admin] NAME
+       tlweb user passwd [-db PATH] NAME
+       tlweb user del [-db PATH] NAME
+       tlweb user list [-db PATH]`
+
+const tokenUsage = `usage: tlweb token add [-db PATH] [-role viewer|ingest|admin] [-site SITE] NAME
+       tlweb token list [-db PATH]
+       tlweb token revoke [-db PATH] ID`
+
+// readPassword prompts for a password, twice and without echo on a
+// terminal, or reads a line from in otherwise so scripts can pipe it.
+func readPassword(in io.Reader, out io.Writer) (password string, err error) {
+	if f, ok := in.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		var first, second []byte
+		fmt.Fprint(out, "Password: ")
+		first, err = term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(out)
+		if err != nil {
+			err = fmt.Errorf("readPassword: %w", err)
+			return
+		}
+		fmt.Fprint(out, "Again: ")
+		second, err = term.ReadPassword(int(f.Fd()))
+		fmt.Fprintln(out)
+		if err != nil {
+			err = fmt.Errorf("readPassword: %w", err)
+			return
+		}
+		if string(first) != string(second) {
+			err = errors.New("readPassword: The passwords do not match")
+			return
+		}
+		password = string(first)
+		return
+	}
+	line, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		err = fmt.Errorf("readPassword: %w", err)
+		return
+	}
+	err = nil
+	password = strings.TrimRight(line, "\r\n")
+	return
+}
+
+// authFlags parses the options shared by the user and token commands,
+// returning the one argument after them.
+func authFlags(name string, args []string, usage string, hasRole bool, hasSite bool, hasArg bool) (dbPath string, role string, site string, arg string, err error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	dbFlag := fs.String("db", defaultDB(), "Path to the database")
+	roleFlag := types.RoleViewer
+	if hasRole {
+		fs.StringVar(&roleFlag, "role", types.RoleViewer, "Role: viewer, ingest or admin")
+	}
+	var siteFlag string
+	if hasSite {
+		fs.StringVar(&siteFlag, "site", "", "Site the token may send readings of, any if empty")
+	}
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if (fs.NArg() == 1) != hasArg || fs.NArg() > 1 {
+		err = errors.New(usage)
+		return
+	}
+	dbPath, role, site, arg = *dbFlag, roleFlag, siteFlag, fs.Arg(0)
+	return
+}
+
+// userCmd manages the users who may sign in to the pages.
+func userCmd(args []string, in io.Reader, out io.Writer) (err error) {
+	if len(args) == 0 {
+		err = errors.New(userUsage)
+		return
+	}
+	cmd := args[0]
+	dbPath, role, _, name, err := authFlags("user "+cmd, args[1:], userUsage, cmd == "add", false, cmd != "list")
+	if err != nil {
+		return
+	}
+	tldb, err := NewDB(dbPath)
+	if err != nil {
+		return
+	}
+	defer tldb.Close()
+
+	switch cmd {
+	case "add", "passwd":
+		var password string
+		if password, err = readPassword(in, out); err != nil {
+			return
+		}
+		if cmd == "add" {
+			err = tldb.AddUser(name, password, role)
+		} else {
+			err = tldb.SetPassword(name, password)
+		}
+	case "del":
+		err = tldb.DeleteUser(name)
+	case "list":
+		var users []types.User
+		if users, err = tldb.Users(); err != nil {
+			return
+		}
+		tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "NAME\tROLE\tCREATED")
+		for _, user := range users {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", user.Name, user.Role, user.Created.Format("2006-01-02 15:04"))
+		}
+		err = tw.Flush()
+	default:
+		err = errors.New(userUsage)
+	}
+	return
+}
+
+// tokenCmd manages the API tokens of scripts and other clients.
+func tokenCmd(args []string, out io.Writer) (err error) {
+	if len(args) == 0 {
+		err = errors.New(tokenUsage)
+		return
+	}
+	cmd := args[0]
+	dbPath, role, site, arg, err := authFlags("token "+cmd, args[1:], tokenUsage, cmd == "add", cmd == "add", cmd != "list")
+	if err != nil {
+		return
+	}
+	tldb, err := NewDB(dbPath)
+	if err != nil {
+		return
+	}
+	defer tldb.Close()
+
+	switch cmd {
+	case "add":
+		var token string
+		var id int64
+		if token, id, err = tldb.AddToken(arg, role, site); err != nil {
+			return
+		}
+		fmt.Fprintf(out, "Token %d for %s; it is not shown again:\n%s\n", id, arg, token)
+	case "list":
+		var tokens []types.APIToken
+		if tokens, err = tldb.Tokens(); err != nil {
+			return
+		}
+		tw := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tROLE\tSITE\tCREATED\tLAST USED")
+		for _, token := range tokens {
+			lastUsed := "never"
+			if !token.LastUsed.IsZero() {
+				lastUsed = token.LastUsed.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", token.ID, token.Name, token.Role, token.Site, token.Created.Format("2006-01-02 15:04"), lastUsed)
+		}
+		err = tw.Flush()
+	case "revoke":
+		var id int64
+		if id, err = strconv.ParseInt(arg, 10, 64); err != nil {
+			err = fmt.Errorf("tokenCmd: Invalid token id: %s", arg)
+			return
+		}
+		err = tldb.RevokeToken(id)
+	default:
+		err = errors.New(tokenUsage)
+	}
+	return
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"tempLogger/types"
+)
+
+const defaultAddr = ":8080"
+
+const configUsage = `usage: tlweb config validate [-config PATH]`
+
+// LoadWebCfg reads the tlweb configuration file.  Unknown fields are an
+// error so a misspelled option is not silently ignored.
+func LoadWebCfg(cfgPath string) (cfg types.WebCfg, err error) {
+	cfgBytes, err := os.ReadFile(cfgPath)
+	if err != nil {
+		err = fmt.Errorf("LoadWebCfg: Could not read file %s: %w", cfgPath, err)
+		return
+	}
+	dec := json.NewDecoder(bytes.NewReader(cfgBytes))
+	dec.DisallowUnknownFields()
+	if err = dec.Decode(&cfg); err != nil {
+		err = fmt.Errorf("LoadWebCfg: Could not parse file %s: %w", cfgPath, err)
+		return
+	}
+	return
+}
+
+// webEnv are the environment variables that override the configuration
+// file.
+var webEnv = []struct {
+	name string
+	set  func(cfg *types.WebCfg, value string) error
+}{
+	{"TLWEB_DB", func(cfg *types.WebCfg, value string) error { cfg.DB = value; return nil }},
+	{"TLWEB_ADDR", func(cfg *types.WebCfg, value string) error { cfg.Addr = value; return nil }},
+	{"TLWEB_UNITS", func(cfg *types.WebCfg, value string) error { cfg.Units = value; return nil }},
+	// TLWEB_WATCH is a list of directories separated like PATH, replacing
+	// those of the file along with their options.
+	{"TLWEB_WATCH", func(cfg *types.WebCfg, value string) error {
+		cfg.Watch = nil
+		for _, path := range filepath.SplitList(value) {
+			if path != "" {
+				cfg.Watch = append(cfg.Watch, types.WatchCfg{Path: path})
+			}
+		}
+		return nil
+	}},
+	{"TLWEB_RETENTION_DAYS", func(cfg *types.WebCfg, value string) (err error) {
+		cfg.Retention.Days, err = strconv.Atoi(value)
+		return
+	}},
+	{"TLWEB_AUTH", func(cfg *types.WebCfg, value string) (err error) {
+		cfg.Auth, err = strconv.ParseBool(value)
+		return
+	}},
+	{"TLWEB_TLS_CERT", func(cfg *types.WebCfg, value string) error { cfg.TLS.Cert = value; return nil }},
+	{"TLWEB_TLS_KEY", func(cfg *types.WebCfg, value string) error { cfg.TLS.Key = value; return nil }},
+	{"TLWEB_TLS_CLIENT_CA", func(cfg *types.WebCfg, value string) error { cfg.TLS.ClientCA = value; return nil }},
+	{"TLWEB_TLS_CLIENT_ROLE", func(cfg *types.WebCfg, value string) error { cfg.TLS.ClientRole = value; return nil }},
+	{"TLWEB_REDIRECT_ADDR", func(cfg *types.WebCfg, value string) error { cfg.TLS.RedirectAddr = value; return nil }},
+}
+
+// applyEnv overrides cfg with the variables set in the environment, as
+// found by lookup.
+func applyEnv(cfg *types.WebCfg, lookup func(string) (string, bool)) (err error) {
+	for _, env := range webEnv {
+		value, ok := lookup(env.name)
+		if !ok {
+			continue
+		}
+		if err = env.set(cfg, value); err != nil {
+			err = fmt.Errorf("applyEnv: Invalid %s: %w", env.name, err)
+			return
+		}
+	}
+	return
+}
+
+// loadWebCfg reads the configuration file, if there is one, and applies the
+// environment to it.
+func loadWebCfg(cfgPath string, lookup func(string) (string, bool)) (cfg types.WebCfg, err error) {
+	if cfgPath != "" {
+		if cfg, err = LoadWebCfg(cfgPath); err != nil {
+			return
+		}
+	}
+	err = applyEnv(&cfg, lookup)
+	return
+}
+
+// finishWebCfg fills in the defaults of cfg and checks it.
+func finishWebCfg(cfg *types.WebCfg) (err error) {
+	if cfg.DB == "" {
+		cfg.DB = defaultDbPath
+	}
+	if cfg.Addr == "" {
+		cfg.Addr = defaultAddr
+	}
+	if cfg.Units == "" {
+		cfg.Units = types.UnitF
+	}
+	if cfg.TLS.ClientRole == "" {
+		cfg.TLS.ClientRole = types.RoleViewer
+	}
+	if err = validateWebCfg(cfg); err != nil {
+		err = fmt.Errorf("finishWebCfg: %w", err)
+	}
+	return
+}
+
+// validateWebCfg checks cfg, normalizing its units and filling in the
+// defaults of its alert rules.
+func validateWebCfg(cfg *types.WebCfg) (err error) {
+	if cfg.Units, err = types.ParseUnit(cfg.Units); err != nil {
+		return
+	}
+	if len(cfg.Watch) == 0 {
+		return errors.New("No directories to watch")
+	}
+	watched := make(map[string]bool, len(cfg.Watch))
+	for _, watch := range cfg.Watch {
+		if watch.Path == "" {
+			return errors.New("Watch directory with no path")
+		}
+		if watched[watch.Path] {
+			return fmt.Errorf("Duplicate watch directory %s", watch.Path)
+		}
+		watched[watch.Path] = true
+		if types.IsFilePattern(watch.Pattern) {
+			err = types.ValidateFilePattern(watch.Pattern)
+		} else {
+			_, err = filepath.Match(watch.Pattern, "")
+		}
+		if err != nil {
+			return fmt.Errorf("Watch directory %s pattern %q: %w", watch.Path, watch.Pattern, err)
+		}
+		if watch.Site != "" && !types.ValidSite(watch.Site) {
+			return fmt.Errorf("Watch directory %s site must be letters, digits and single underscores: %s", watch.Path, watch.Site)
+		}
+	}
+	seen := make(map[string]bool, len(cfg.Sensors))
+	for _, sensor := range cfg.Sensors {
+		if seen[sensor.ID] {
+			return fmt.Errorf("Duplicate sensor id %s", sensor.ID)
+		}
+		seen[sensor.ID] = true
+		if err = validateSensorCfg(sensor); err != nil {
+			return
+		}
+	}
+	if cfg.Retention.Days < 0 {
+		return errors.New("Retention days must not be negative")
+	}
+	for sensor, days := range cfg.Retention.Sensors {
+		if days < 0 {
+			return fmt.Errorf("Retention days of %s must not be negative", sensor)
+		}
+	}
+	if cfg.DegreeDays.Units != "" {
+		if cfg.DegreeDays.Units, err = types.ParseUnit(cfg.DegreeDays.Units); err != nil {
+			return fmt.Errorf("Degree day units: %w", err)
+		}
+	}
+	if err = validateAlertCfg(&cfg.Alerts); err != nil {
+		return
+	}
+	if (cfg.TLS.Cert == "") != (cfg.TLS.Key == "") {
+		return errors.New("The TLS cert and key must be set together")
+	}
+	if cfg.TLS.Cert == "" && (cfg.TLS.ClientCA != "" || cfg.TLS.RedirectAddr != "") {
+		return errors.New("The TLS client CA and redirect address need a cert and key")
+	}
+	if !validRole(cfg.TLS.ClientRole) {
+		return fmt.Errorf("Invalid TLS client role %q; must be %s, %s or %s", cfg.TLS.ClientRole, types.RoleViewer, types.RoleIngest, types.RoleAdmin)
+	}
+	return
+}
+
+// checkWebCfgFiles checks that the directories and certificates cfg refers
+// to can be used.
+func checkWebCfgFiles(cfg types.WebCfg) (err error) {
+	for _, watch := range cfg.Watch {
+		info, serr := os.Stat(watch.Path)
+		if serr != nil {
+			return fmt.Errorf("checkWebCfgFiles: Watch directory: %w", serr)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("checkWebCfgFiles: Watch directory %s is not a directory", watch.Path)
+		}
+	}
+	if cfg.TLS.Cert != "" {
+		certs, cerr := NewCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		if cerr != nil {
+			return fmt.Errorf("checkWebCfgFiles: %w", cerr)
+		}
+		if _, err = NewTLSConfig(certs, cfg.TLS.ClientCA); err != nil {
+			return fmt.Errorf("checkWebCfgFiles: %w", err)
+		}
+	}
+	return
+}
+
+// defaultDB is the database of the subcommands when -db is not given.
+func defaultDB() string {
+	if dbPath := os.Getenv("TLWEB_DB"); dbPath != "" {
+		return dbPath
+	}
+	return defaultDbPath
+}
+
+// configCmd implements "tlweb config validate", which checks the
+// configuration tlweb would start with, including the environment.
+func configCmd(args []string, out io.Writer) (err error) {
+	if len(args) == 0 || args[0] != "validate" {
+		err = errors.New(configUsage)
+		return
+	}
+	fs := flag.NewFlagSet("config validate", flag.ContinueOnError)
+	cfgPath := fs.String("config", os.Getenv("TLWEB_CONFIG"), "Path to the configuration file")
+	if err = fs.Parse(args[1:]); err != nil {
+		return
+	}
+	if fs.NArg() != 0 {
+		err = errors.New(configUsage)
+		return
+	}
+	cfg, err := loadWebCfg(*cfgPath, os.LookupEnv)
+	if err != nil {
+		return
+	}
+	if err = finishWebCfg(&cfg); err != nil {
+		return
+	}
+	if err = checkWebCfgFiles(cfg); err != nil {
+		return
+	}
+	var dirs []string
+	for _, watch := range cfg.Watch {
+		dirs = append(dirs, watch.Path)
+	}
+	fmt.Fprintf(out, "Configuration OK: database %s, listening on %s, watching %s\n", cfg.DB, cfg.Addr, strings.Join(dirs, ", "))
+	return
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestLoadWebCfg(t *testing.T) {
+	cfg, err := LoadWebCfg("tlweb.json")
+	if err != nil {
+		t.Fatalf("LoadWebCfg: %s", err.Error())
+	}
+	if err = finishWebCfg(&cfg); err != nil {
+		t.Fatalf("Example configuration invalid: %s", err.Error())
+	}
+	if len(cfg.Watch) != 2 || !cfg.Watch[0].ImportExisting || retentionDays(cfg.Retention, "sensor2") != 365 {
+		t.Errorf("Unexpected configuration: %+v", cfg)
+	}
+
+	bad := filepath.Join(t.TempDir(), "tlweb.json")
+	if err := os.WriteFile(bad, []byte(`{"adr": ":9090"}`), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	if _, err = LoadWebCfg(bad); err == nil {
+		t.Error("Expected a misspelled field to fail")
+	}
+}
+
+func TestWebCfgEnv(t *testing.T) {
+	env := map[string]string{
+		"TLWEB_ADDR":           ":9090",
+		"TLWEB_WATCH":          "logs" + string(os.PathListSeparator) + "logs-USB0",
+		"TLWEB_RETENTION_DAYS": "90",
+		"TLWEB_UNITS":          "c",
+	}
+	lookup := func(name string) (value string, ok bool) {
+		value, ok = env[name]
+		return
+	}
+	cfg, err := loadWebCfg("tlweb.json", lookup)
+	if err != nil {
+		t.Fatalf("loadWebCfg: %s", err.Error())
+	}
+	if err = finishWebCfg(&cfg); err != nil {
+		t.Fatalf("finishWebCfg: %s", err.Error())
+	}
+	if cfg.Addr != ":9090" || cfg.Units != types.UnitC || cfg.Retention.Days != 90 {
+		t.Errorf("Environment not applied: %+v", cfg)
+	}
+	if len(cfg.Watch) != 2 || cfg.Watch[1].Path != "logs-USB0" || cfg.Watch[0].Pattern != "" {
+		t.Errorf("Unexpected watch directories: %+v", cfg.Watch)
+	}
+
+	env["TLWEB_AUTH"] = "maybe"
+	if _, err = loadWebCfg("", lookup); err == nil || !strings.Contains(err.Error(), "TLWEB_AUTH") {
+		t.Errorf("Expected an invalid TLWEB_AUTH to fail, got %v", err)
+	}
+}
+
+func TestValidateWebCfg(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		cfg  types.WebCfg
+	}{
+		{"no watch", types.WebCfg{}},
+		{"duplicate watch", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}, {Path: "logs"}}}},
+		{"bad pattern", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs", Pattern: "[*.log"}}}},
+		{"bad file pattern", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs", Pattern: "{id}.log"}}}},
+		{"bad units", types.WebCfg{Units: "R", Watch: []types.WatchCfg{{Path: "logs"}}}},
+		{"bad sensor id", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, Sensors: []types.SensorCfg{{ID: "crawl space"}}}},
+		{"reserved sensor id", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, Sensors: []types.SensorCfg{{ID: "tltoken"}}}},
+		{"bad sensor", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, Sensors: []types.SensorCfg{{ID: "sensor1", Color: "blue"}}}},
+		{"bad degree day units", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, DegreeDays: types.DegreeDayCfg{Units: "R"}}},
+		{"negative retention", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, Retention: types.RetentionCfg{Sensors: map[string]int{"sensor1": -1}}}},
+		{"unknown channel", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, Alerts: types.AlertCfg{Rules: []types.AlertRule{{Name: "cold", Kind: types.AlertBelow, Channels: []string{"email"}}}}}},
+		{"key without cert", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, TLS: types.TLSCfg{Key: "key.pem"}}},
+		{"redirect without cert", types.WebCfg{Watch: []types.WatchCfg{{Path: "logs"}}, TLS: types.TLSCfg{RedirectAddr: ":80"}}},
+	} {
+		if err := finishWebCfg(&test.cfg); err == nil {
+			t.Errorf("%s: Expected an error", test.name)
+		}
+	}
+}
+
+func TestConfigCmd(t *testing.T) {
+	dir := t.TempDir()
+	cfgPath := filepath.Join(dir, "tlweb.json")
+	if err := os.WriteFile(cfgPath, []byte(`{"watch": [{"path": "test", "pattern": "*.log"}]}`), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	var out bytes.Buffer
+	if err := configCmd([]string{"validate", "-config", cfgPath}, &out); err != nil || !strings.Contains(out.String(), "OK") {
+		t.Errorf("config validate: %v: %s", err, out.String())
+	}
+
+	if err := os.WriteFile(cfgPath, []byte(`{"watch": [{"path": "no-such-dir"}]}`), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	if err := configCmd([]string{"validate", "-config", cfgPath}, &out); err == nil {
+		t.Error("Expected a missing watch directory to fail")
+	}
+	if err := configCmd([]string{"check"}, &out); err == nil {
+		t.Error("Expected an unknown command to fail")
+	}
+}
+
+func TestPruneReadings(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	before, _ := tldb.RecordCount("sensor1")
+	// The test log covers 2024-01-14 in UTC-7, so keeping 1 day at
+	// 2024-01-15 12:00 UTC-7 keeps the readings after 2024-01-14 12:00.
+	now := time.Date(2024, 1, 15, 19, 0, 0, 0, time.UTC)
+	deleted, err := pruneReadings(tldb, types.RetentionCfg{Days: 30, Sensors: map[string]int{"sensor1": 1}}, now)
+	if err != nil {
+		t.Fatalf("pruneReadings: %s", err.Error())
+	}
+	after, _ := tldb.RecordCount("sensor1")
+	if deleted == 0 || int64(before-after) != deleted {
+		t.Errorf("Deleted %d of %d records, leaving %d", deleted, before, after)
+	}
+	if n, _ := tldb.RecordCountTime("sensor1", time.Unix(0, 0), now.AddDate(0, 0, -1)); n != 0 {
+		t.Errorf("%d records older than the retention remain", n)
+	}
+
+	// Zero days keeps everything
+	if deleted, _ = pruneReadings(tldb, types.RetentionCfg{}, now.AddDate(1, 0, 0)); deleted != 0 {
+		t.Errorf("Deleted %d records with no retention", deleted)
+	}
+
+	// Tables that are not registered sensors are never pruned, even if
+	// they are in the registry from an old import
+	if _, _, err = tldb.AddToken("logger", types.RoleIngest, ""); err != nil {
+		t.Fatalf("AddToken: %s", err.Error())
+	}
+	tldb.Tables["tltoken"] = true
+	if _, err = tldb.DeleteBefore("tltoken", now.AddDate(1, 0, 0)); err == nil {
+		t.Error("Expected DeleteBefore to refuse tltoken")
+	}
+	// A table that cannot be pruned does not stop the sensors after it
+	tldb.Tables["attic"] = true
+	if deleted, err = pruneReadings(tldb, types.RetentionCfg{Days: 1}, now.AddDate(1, 0, 0)); err == nil ||
+		!strings.Contains(err.Error(), "attic") || !strings.Contains(err.Error(), "tltoken") || deleted != int64(after) {
+		t.Errorf("Expected errors for attic and tltoken and %d records deleted, got %d: %v", after, deleted, err)
+	}
+	if tokens, _ := tldb.Tokens(); len(tokens) != 1 {
+		t.Errorf("Expected the token to remain, got %v", tokens)
+	}
+	delete(tldb.Tables, "attic")
+	delete(tldb.Tables, "tltoken")
+	if _, err = tldb.DeleteBefore("nosuch", now); err == nil {
+		t.Error("Expected DeleteBefore to refuse an unknown table")
+	}
+}
+
+func TestImportExisting(t *testing.T) {
+	changedFile := make(chan string, 10)
+	watcher := NewWatcher("test")
+	watcher.Pattern = "tempLogger-*.log"
+	if err := watcher.ImportExisting(changedFile); err != nil {
+		t.Fatalf("ImportExisting: %s", err.Error())
+	}
+	close(changedFile)
+	var files []string
+	for file := range changedFile {
+		files = append(files, file)
+	}
+	if len(files) != 2 || files[0] != filepath.Join("test", "tempLogger-20240114-1.log") {
+		t.Errorf("Unexpected files: %v", files)
+	}
+
+	// tempLogger file patterns match what they produce
+	for pattern, match := range map[string]bool{
+		"tempLogger-{date}-1.log": true,
+		"tempLogger-{date}.log":   false,
+		"{id}-{date}-1.log":       true,
+		"{id}-{date}T{hour}.log":  false,
+	} {
+		if matchPattern(pattern, "tempLogger-20240114-1.log") != match {
+			t.Errorf("%s: Expected match %v", pattern, match)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"tempLogger/types"
+	"time"
+
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Export fields.  "temp", "heatIndex" and "dewPoint" are aliases that
+// resolve to the Celsius, Fahrenheit or Kelvin column depending on the
+// requested units.
+var exportFields = []string{"timestamp", "id", "humidity", "tempC", "tempF", "tempK", "heatIndexC", "heatIndexF", "heatIndexK",
+	"dewPointC", "dewPointF", "dewPointK", "absHumidity", "vpd"}
+
+const defaultExportFields = "timestamp,id,humidity,temp,heatIndex"
+
+var exportContentTypes = map[string]string{
+	"csv":     "text/csv; charset=utf-8",
+	"ndjson":  "application/x-ndjson",
+	"parquet": "application/vnd.apache.parquet",
+}
+
+// resolveFields turns a comma separated field list into export column names.
+func resolveFields(fieldList string, units string) (fields []string, err error) {
+	if fieldList == "" {
+		fieldList = defaultExportFields
+	}
+	if units == "" {
+		units = types.UnitF
+	}
+	units, err = types.ParseUnit(units)
+	if err != nil {
+		err = fmt.Errorf("resolveFields: %w", err)
+		return
+	}
+	for _, field := range strings.Split(fieldList, ",") {
+		field = strings.TrimSpace(field)
+		switch field {
+		case "temp", "heatIndex", "dewPoint":
+			field += units
+		}
+		known := false
+		for _, val := range exportFields {
+			if val == field {
+				known = true
+				break
+			}
+		}
+		if !known {
+			err = fmt.Errorf("resolveFields: Unknown field: %s", field)
+			return
+		}
+		fields = append(fields, field)
+	}
+	return
+}
+
+// parseTimeParam accepts RFC3339, a plain date, a date and minute, or Unix
+// seconds.  An empty string returns def.
+func parseTimeParam(s string, def time.Time) (t time.Time, err error) {
+	if s == "" {
+		t = def
+		return
+	}
+	if secs, perr := strconv.ParseInt(s, 10, 64); perr == nil {
+		t = time.Unix(secs, 0)
+		return
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err = time.ParseInLocation(layout, s, time.Local); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("parseTimeParam: Could not parse time: %s", s)
+	return
+}
+
+type recordWriter interface {
+	Write(thd types.THData) error
+	Close() error
+}
+
+func newRecordWriter(format string, w io.Writer, fields []string) (rw recordWriter, err error) {
+	switch format {
+	case "", "csv":
+		cw := csv.NewWriter(w)
+		err = cw.Write(fields)
+		rw = &csvRecordWriter{cw: cw, fields: fields}
+	case "ndjson":
+		bw := bufio.NewWriter(w)
+		rw = &ndjsonRecordWriter{bw: bw, enc: json.NewEncoder(bw), fields: fields}
+	case "parquet":
+		rw, err = newParquetRecordWriter(w, fields)
+	default:
+		err = fmt.Errorf("newRecordWriter: Unknown format: %s", format)
+	}
+	return
+}
+
+func fieldValue(thd types.THData, field string) float32 {
+	switch field {
+	case "humidity":
+		return thd.Humidity
+	case "tempC", "tempF", "tempK":
+		return types.TempIn(thd.TempC, thd.TempF, field[len(field)-1:])
+	case "heatIndexC", "heatIndexF", "heatIndexK":
+		return types.TempIn(thd.HeatIndexC, thd.HeatIndexF, field[len(field)-1:])
+	case "dewPointC", "dewPointF", "dewPointK":
+		return types.MetricValue(thd, types.MetricDewPoint, field[len(field)-1:])
+	case types.MetricAbsHumidity, types.MetricVPD:
+		return types.MetricValue(thd, field, "")
+	}
+	return 0
+}
+
+type csvRecordWriter struct {
+	cw     *csv.Writer
+	fields []string
+	row    []string
+}
+
+func (crw *csvRecordWriter) Write(thd types.THData) error {
+	crw.row = crw.row[:0]
+	for _, field := range crw.fields {
+		switch field {
+		case "timestamp":
+			crw.row = append(crw.row, thd.TimeStamp)
+		case "id":
+			crw.row = append(crw.row, thd.ID)
+		default:
+			crw.row = append(crw.row, strconv.FormatFloat(float64(fieldValue(thd, field)), 'f', -1, 32))
+		}
+	}
+	return crw.cw.Write(crw.row)
+}
+
+func (crw *csvRecordWriter) Close() error {
+	crw.cw.Flush()
+	return crw.cw.Error()
+}
+
+type ndjsonRecordWriter struct {
+	bw     *bufio.Writer
+	enc    *json.Encoder
+	fields []string
+}
+
+func (nrw *ndjsonRecordWriter) Write(thd types.THData) error {
+	row := make(map[string]any, len(nrw.fields))
+	for _, field := range nrw.fields {
+		switch field {
+		case "timestamp":
+			row[field] = thd.TimeStamp
+		case "id":
+			row[field] = thd.ID
+		default:
+			row[field] = fieldValue(thd, field)
+		}
+	}
+	return nrw.enc.Encode(row)
+}
+
+func (nrw *ndjsonRecordWriter) Close() error {
+	return nrw.bw.Flush()
+}
+
+// parquetRowGroupSize bounds the bytes of readings buffered before a row
+// group is written out.
+const parquetRowGroupSize = 8 * 1024 * 1024
+
+type parquetRecordWriter struct {
+	pw     *writer.CSVWriter
+	fields []string
+}
+
+func newParquetRecordWriter(w io.Writer, fields []string) (prw *parquetRecordWriter, err error) {
+	schema := make([]string, len(fields))
+	for i, field := range fields {
+		switch field {
+		case "timestamp":
+			schema[i] = "name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"
+		case "id":
+			schema[i] = "name=id, type=BYTE_ARRAY, convertedtype=UTF8"
+		default:
+			schema[i] = "name=" + field + ", type=FLOAT"
+		}
+	}
+	pw, err := writer.NewCSVWriterFromWriter(schema, w, 1)
+	if err != nil {
+		err = fmt.Errorf("newParquetRecordWriter: %w", err)
+		return
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+	createdBy := "tlweb version " + swVer
+	pw.Footer.CreatedBy = &createdBy
+	prw = &parquetRecordWriter{pw: pw, fields: fields}
+	return
+}
+
+func (prw *parquetRecordWriter) Write(thd types.THData) error {
+	// The writer keeps the rows until their row group is written
+	row := make([]interface{}, len(prw.fields))
+	for i, field := range prw.fields {
+		switch field {
+		case "timestamp":
+			ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+			if err != nil {
+				return fmt.Errorf("parquetRecordWriter: Error parsing timestamp: %s: %w", thd.TimeStamp, err)
+			}
+			row[i] = ts.UnixMilli()
+		case "id":
+			row[i] = thd.ID
+		default:
+			row[i] = fieldValue(thd, field)
+		}
+	}
+	return prw.pw.Write(row)
+}
+
+// Close writes the file footer.  It does not close the underlying writer.
+func (prw *parquetRecordWriter) Close() error {
+	return prw.pw.WriteStop()
+}
+
+// ExportRecords streams the records of sensor between begin and end to w.
+func (tldb TLDB) ExportRecords(w io.Writer, sensor string, begin time.Time, end time.Time, format string, fields []string) (err error) {
+	if !tldb.HasTable(sensor) {
+		err = fmt.Errorf("ExportRecords: Unknown sensor: %s", sensor)
+		return
+	}
+	rw, err := newRecordWriter(format, w, fields)
+	if err != nil {
+		err = fmt.Errorf("ExportRecords: %w", err)
+		return
+	}
+	err = tldb.StreamRecords(sensor, begin, end, rw.Write)
+	if cerr := rw.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		err = fmt.Errorf("ExportRecords: %w", err)
+	}
+	return
+}
+
+// Export handles GET /api/v1/export?sensor=&from=&to=&format=&fields=&units=
+//
+// Without units the temp and heatIndex fields use the caller's preferred
+// units, as on the page.
+func (tlweb TLWeb) Export(w http.ResponseWriter, req *http.Request) {
+	query := req.URL.Query()
+	sensor := query.Get("sensor")
+	format := query.Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	contentType, ok := exportContentTypes[format]
+	if !ok {
+		http.Error(w, "Unknown format: "+format, http.StatusBadRequest)
+		return
+	}
+	if !tlweb.Tldb.HasTable(sensor) {
+		http.Error(w, "Unknown sensor: "+sensor, http.StatusNotFound)
+		return
+	}
+	begin, end, err := parseRangeParams(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	unit, err := tlweb.RequestUnits(w, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fields, err := resolveFields(query.Get("fields"), unit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s-%s-%s.%s\"",
+		sensor, begin.Format("20060102"), end.Format("20060102"), format))
+	err = tlweb.Tldb.ExportRecords(w, sensor, begin, end, format, fields)
+	if err != nil {
+		// The headers are already sent, so all that can be done is log it.
+		log.Println("Export:", err.Error())
+	}
+}
+
+// exportCmd implements "tlweb export", which writes the same output as the
+// export endpoint directly from the database.
+func exportCmd(args []string) (err error) {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dbPath := fs.String("db", defaultDB(), "Path to the database")
+	sensor := fs.String("sensor", "", "Sensor to export")
+	from := fs.String("from", "", "Start time (RFC3339, YYYY-MM-DD or Unix seconds); default 24h before -to")
+	to := fs.String("to", "", "End time; default now")
+	format := fs.String("format", "csv", "Output format: csv, ndjson or parquet")
+	fieldList := fs.String("fields", defaultExportFields, "Comma separated list of fields")
+	units := fs.String("units", "F", "Temperature units for the temp and heatIndex fields: F, C or K")
+	outPath := fs.String("o", "", "Output file; default stdout")
+	if err = fs.Parse(args); err != nil {
+		return
+	}
+	if *sensor == "" {
+		err = errors.New("exportCmd: -sensor is required")
+		return
+	}
+	end, err := parseTimeParam(*to, time.Now())
+	if err != nil {
+		return
+	}
+	begin, err := parseTimeParam(*from, end.Add(-time.Hour*24))
+	if err != nil {
+		return
+	}
+	fields, err := resolveFields(*fieldList, *units)
+	if err != nil {
+		return
+	}
+
+	tldb, err := NewDB(*dbPath)
+	if err != nil {
+		return
+	}
+	defer tldb.Close()
+
+	var out io.Writer = os.Stdout
+	if *outPath != "" {
+		var f *os.File
+		f, err = os.Create(*outPath)
+		if err != nil {
+			err = fmt.Errorf("exportCmd: Error creating %s: %w", *outPath, err)
+			return
+		}
+		defer func() {
+			if cerr := f.Close(); err == nil && cerr != nil {
+				err = fmt.Errorf("exportCmd: Error closing %s: %w", *outPath, cerr)
+			}
+		}()
+		out = f
+	}
+	err = tldb.ExportRecords(out, *sensor, begin, end, *format, fields)
+	return
+}
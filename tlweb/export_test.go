@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xitongsys/parquet-go/common"
+	"github.com/xitongsys/parquet-go/reader"
+	"github.com/xitongsys/parquet-go/source"
+)
+
+// newTestDB creates a fresh test database loaded with the first test log.
+func newTestDB(t *testing.T) TLDB {
+	_, err := os.Stat(testDbPath)
+	if err == nil {
+		err = os.Remove(testDbPath)
+		if err != nil {
+			t.Fatalf("Could not remove file %s: %s", testDbPath, err.Error())
+		}
+	}
+	tldb, err := NewDB(testDbPath)
+	if err != nil {
+		t.Fatalf("Could not create %s: %s", testDbPath, err.Error())
+	}
+	err = tldb.InsertLog("test/tempLogger-20240114-1.log")
+	if err != nil {
+		t.Fatalf("Error inserting log into database: %s", err.Error())
+	}
+	return tldb
+}
+
+func TestExportCSV(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	req := httptest.NewRequest("GET", "/api/v1/export?sensor=sensor1&from=1705298580&to=1705300900&fields=timestamp,temp,humidity&units=C", nil)
+	w := httptest.NewRecorder()
+	tlWeb.Export(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	rows, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Could not parse CSV: %s", err.Error())
+	}
+	if len(rows) != 20 {
+		t.Fatalf("Incorrect number of rows: Expected %d, Actual %d", 20, len(rows))
+	}
+	if strings.Join(rows[0], ",") != "timestamp,tempC,humidity" {
+		t.Errorf("Unexpected header: %v", rows[0])
+	}
+}
+
+func TestExportErrors(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	for _, url := range []string{
+		"/api/v1/export?sensor=nosuchsensor",
+		"/api/v1/export?sensor=sensor1&format=xml",
+		"/api/v1/export?sensor=sensor1&fields=pressure",
+		"/api/v1/export?sensor=sensor1&from=yesterday",
+	} {
+		w := httptest.NewRecorder()
+		tlWeb.Export(w, httptest.NewRequest("GET", url, nil))
+		if w.Code == http.StatusOK {
+			t.Errorf("Expected an error for %s", url)
+		}
+	}
+}
+
+// parquetBuffer lets the parquet reader read an export in memory.  Each
+// column is read through a file of its own.
+type parquetBuffer struct {
+	*bytes.Reader
+	data []byte
+}
+
+func (pb parquetBuffer) Write(p []byte) (int, error) {
+	return 0, os.ErrPermission
+}
+
+func (pb parquetBuffer) Close() error {
+	return nil
+}
+
+func (pb parquetBuffer) Open(name string) (source.ParquetFile, error) {
+	return parquetBuffer{bytes.NewReader(pb.data), pb.data}, nil
+}
+
+func (pb parquetBuffer) Create(name string) (source.ParquetFile, error) {
+	return nil, os.ErrPermission
+}
+
+func TestExportParquet(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	fields, err := resolveFields("timestamp,id,temp,humidity", "F")
+	if err != nil {
+		t.Fatalf("Could not resolve fields: %s", err.Error())
+	}
+	begin := time.Unix(1705298580, 0)
+	end := time.Unix(1705300900, 0)
+	var buf bytes.Buffer
+	err = tldb.ExportRecords(&buf, "sensor1", begin, end, "parquet", fields)
+	if err != nil {
+		t.Fatalf("Could not export parquet: %s", err.Error())
+	}
+	records, err := tldb.RetrieveRecords("sensor1", begin, end)
+	if err != nil || len(records) != 19 {
+		t.Fatalf("Could not read the exported records: %d %v", len(records), err)
+	}
+
+	pr, err := reader.NewParquetColumnReader(parquetBuffer{bytes.NewReader(buf.Bytes()), buf.Bytes()}, 1)
+	if err != nil {
+		t.Fatalf("Could not open the parquet export: %s", err.Error())
+	}
+	defer pr.ReadStop()
+	if rows := pr.GetNumRows(); rows != int64(len(records)) {
+		t.Fatalf("Incorrect number of rows: Expected %d, Actual %d", len(records), rows)
+	}
+	var names []string
+	for _, info := range pr.SchemaHandler.Infos[1:] {
+		names = append(names, info.ExName)
+	}
+	if strings.Join(names, ",") != "timestamp,id,tempF,humidity" {
+		t.Errorf("Unexpected columns: %v", names)
+	}
+	columns := make([][]interface{}, len(fields))
+	for i, field := range fields {
+		columns[i], _, _, err = pr.ReadColumnByPath(common.ReformPathStr(pr.SchemaHandler.GetRootExName()+"."+field), pr.GetNumRows())
+		if err != nil || len(columns[i]) != len(records) {
+			t.Fatalf("Could not read column %s: %d values, %v", fields[i], len(columns[i]), err)
+		}
+	}
+	for i, thd := range records {
+		ts, _ := time.Parse(time.RFC3339, thd.TimeStamp)
+		if columns[0][i] != ts.UnixMilli() || columns[1][i] != "sensor1" ||
+			columns[2][i] != thd.TempF || columns[3][i] != thd.Humidity {
+			t.Errorf("Row %d: Expected %s %g %g, Actual %v %v %v %v", i, thd.TimeStamp, thd.TempF, thd.Humidity,
+				columns[0][i], columns[1][i], columns[2][i], columns[3][i])
+		}
+	}
+}
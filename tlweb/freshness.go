@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	// defaultInterval is assumed until a sensor has enough readings to
+	// learn its interval from.
+	defaultInterval = 2 * time.Minute
+	// learnSamples is the number of recent readings the interval is
+	// learned from.
+	learnSamples = 200
+	// A gap is a silence longer than gapFactor intervals, so a single
+	// missed reading counts.
+	gapFactor = 1.5
+	// A sensor is stale when its newest reading is older than staleFactor
+	// intervals, unless configured otherwise.
+	staleFactor = 3
+)
+
+// LearnInterval returns the median time between the recent readings of
+// sensor.  ok is false if there are too few readings to tell.
+func (tldb TLDB) LearnInterval(sensor string) (interval time.Duration, ok bool, err error) {
+	rows, err := tldb.DB.Query(fmt.Sprintf("select id from %s order by id desc limit %d", sensor, learnSamples+1))
+	if err != nil {
+		err = fmt.Errorf("LearnInterval: Error querying %s: %w", sensor, err)
+		return
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			err = fmt.Errorf("LearnInterval: Error reading query of %s: %w", sensor, err)
+			return
+		}
+		ids = append(ids, id)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("LearnInterval: General error reading query of %s: %w", sensor, err)
+		return
+	}
+	if len(ids) < 3 {
+		return
+	}
+	deltas := make([]int64, len(ids)-1)
+	for i := range deltas {
+		deltas[i] = ids[i] - ids[i+1]
+	}
+	sort.Slice(deltas, func(i, j int) bool { return deltas[i] < deltas[j] })
+	interval = time.Duration(deltas[len(deltas)/2]) * time.Second
+	ok = interval > 0
+	return
+}
+
+// SensorInterval returns the configured reading interval of sensor, or the
+// learned one, or the default.
+func (tldb TLDB) SensorInterval(sensor types.SensorCfg) (interval time.Duration, learned bool) {
+	if sensor.IntervalSeconds > 0 {
+		interval = time.Duration(sensor.IntervalSeconds) * time.Second
+		return
+	}
+	interval, learned, err := tldb.LearnInterval(sensor.ID)
+	if err != nil {
+		log.Println("SensorInterval:", err.Error())
+	}
+	if !learned {
+		interval = defaultInterval
+	}
+	return
+}
+
+// SensorFreshness reports how old the newest reading of sensor is at now.
+func (tldb TLDB) SensorFreshness(sensor types.SensorCfg, now time.Time) types.Freshness {
+	interval, learned := tldb.SensorInterval(sensor)
+	return tldb.freshness(sensor, interval, learned, now)
+}
+
+// freshness is SensorFreshness for a sensor whose interval is known.
+func (tldb TLDB) freshness(sensor types.SensorCfg, interval time.Duration, learned bool, now time.Time) (fresh types.Freshness) {
+	fresh.Interval = int64(interval / time.Second)
+	fresh.Learned = learned
+	fresh.Stale = true
+	if !tldb.HasTable(sensor.ID) {
+		fresh.Age = "never"
+		return
+	}
+	thd, found, err := tldb.LatestRecord(sensor.ID)
+	if err != nil {
+		log.Println("SensorFreshness:", err.Error())
+	}
+	ts, perr := time.Parse(time.RFC3339, thd.TimeStamp)
+	if !found || perr != nil {
+		fresh.Age = "never"
+		return
+	}
+	staleAfter := staleFactor * interval
+	if sensor.StaleAfterMinutes > 0 {
+		staleAfter = time.Duration(sensor.StaleAfterMinutes) * time.Minute
+	}
+	age := now.Sub(ts)
+	fresh.LastSeen = ts.UnixMilli()
+	fresh.Age = formatAge(age)
+	fresh.Stale = age > staleAfter
+	return
+}
+
+// formatAge describes a duration to the minute, such as "2d 3h ago" or
+// "5m ago".
+func formatAge(age time.Duration) string {
+	minutes := int64(age / time.Minute)
+	switch {
+	case minutes < 1:
+		return "just now"
+	case minutes < 60:
+		return fmt.Sprintf("%dm ago", minutes)
+	case minutes < 24*60:
+		return fmt.Sprintf("%dh %dm ago", minutes/60, minutes%60)
+	}
+	return fmt.Sprintf("%dd %dh ago", minutes/(24*60), minutes%(24*60)/60)
+}
+
+// Gaps returns the periods between begin and end, or now if earlier, that
+// have no readings from sensor for longer than minGap.
+func (tldb TLDB) Gaps(sensor string, begin time.Time, end time.Time, minGap time.Duration, now time.Time) (gaps []types.Gap, err error) {
+	if end.After(now) {
+		end = now
+	}
+	addGap := func(from time.Time, to time.Time) {
+		if to.Sub(from) > minGap {
+			gaps = append(gaps, types.Gap{From: from, To: to, Seconds: int64(to.Sub(from) / time.Second)})
+		}
+	}
+	rows, err := tldb.DB.Query(fmt.Sprintf("select id from %s where (id > ? and id < ?) order by id", sensor), begin.Unix(), end.Unix())
+	if err != nil {
+		err = fmt.Errorf("Gaps: Error querying %s: %w", sensor, err)
+		return
+	}
+	defer rows.Close()
+	prev := begin
+	for rows.Next() {
+		var id int64
+		if err = rows.Scan(&id); err != nil {
+			err = fmt.Errorf("Gaps: Error reading query of %s: %w", sensor, err)
+			return
+		}
+		ts := time.Unix(id, 0)
+		addGap(prev, ts)
+		prev = ts
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("Gaps: General error reading query of %s: %w", sensor, err)
+		return
+	}
+	addGap(prev, end)
+	return
+}
+
+// addFreshness fills in the freshness of summary and the gaps in its
+// readings between begin and end, given the interval and learned that
+// SensorInterval returned for sensor.  Gaps shorter than twice step, the
+// spacing of the chart data, are not shown.
+func (tlweb TLWeb) addFreshness(summary *types.TLSummary, sensor types.SensorCfg, interval time.Duration, learned bool, begin time.Time, end time.Time, step time.Duration, now time.Time) {
+	summary.Freshness = tlweb.Tldb.freshness(sensor, interval, learned, now)
+	if !tlweb.Tldb.HasTable(sensor.ID) {
+		return
+	}
+	minGap := max(time.Duration(gapFactor*float64(summary.Freshness.Interval)*float64(time.Second)), 2*step)
+	gaps, err := tlweb.Tldb.Gaps(sensor.ID, begin, end, minGap, now)
+	if err != nil {
+		log.Println("addFreshness:", err.Error())
+	}
+	summary.Gaps = gaps
+}
+
+// APIGaps handles GET /api/v1/gaps?sensor=&from=&to=
+func (tlweb TLWeb) APIGaps(w http.ResponseWriter, req *http.Request) {
+	sensorID := req.URL.Query().Get("sensor")
+	if !tlweb.Tldb.HasTable(sensorID) {
+		writeAPIError(w, req, http.StatusNotFound, "Unknown sensor: "+sensorID)
+		return
+	}
+	begin, end, err := parseRangeParams(req)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	sensor := types.SensorCfg{ID: sensorID}
+	for _, val := range tlweb.SensorList() {
+		if val.ID == sensorID {
+			sensor = val
+		}
+	}
+	interval, _ := tlweb.Tldb.SensorInterval(sensor)
+	resp := types.Gaps{Sensor: sensorID, Interval: int64(interval / time.Second), Gaps: []types.Gap{}}
+	gaps, err := tlweb.Tldb.Gaps(sensorID, begin, end, time.Duration(gapFactor*float64(interval)), time.Now())
+	if err != nil {
+		log.Println("APIGaps:", err.Error())
+		writeAPIError(w, req, http.StatusInternalServerError, "Error retrieving readings")
+		return
+	}
+	resp.Gaps = append(resp.Gaps, gaps...)
+	writeJSON(w, req, http.StatusOK, resp)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestFreshness(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	interval, ok, err := tldb.LearnInterval("sensor1")
+	if err != nil || !ok {
+		t.Fatalf("Could not learn the interval: %v", err)
+	}
+	if interval < 2*time.Minute || interval > 2*time.Minute+10*time.Second {
+		t.Errorf("Unexpected interval: %s", interval)
+	}
+
+	latest, _, _ := tldb.LatestRecord("sensor1")
+	last, _ := time.Parse(time.RFC3339, latest.TimeStamp)
+	fresh := tldb.SensorFreshness(types.SensorCfg{ID: "sensor1"}, last.Add(5*time.Minute))
+	if fresh.Stale || !fresh.Learned || fresh.LastSeen != last.UnixMilli() || fresh.Age != "5m ago" {
+		t.Errorf("Expected a fresh sensor: %+v", fresh)
+	}
+	fresh = tldb.SensorFreshness(types.SensorCfg{ID: "sensor1"}, last.Add(3*time.Hour))
+	if !fresh.Stale || fresh.Age != "3h 0m ago" {
+		t.Errorf("Expected a stale sensor: %+v", fresh)
+	}
+	fresh = tldb.SensorFreshness(types.SensorCfg{ID: "sensor1", IntervalSeconds: 3600, StaleAfterMinutes: 240}, last.Add(3*time.Hour))
+	if fresh.Stale || fresh.Learned || fresh.Interval != 3600 {
+		t.Errorf("Configured interval not used: %+v", fresh)
+	}
+	if fresh := tldb.SensorFreshness(types.SensorCfg{ID: "nosuchsensor"}, last); !fresh.Stale || fresh.Age != "never" {
+		t.Errorf("Expected a sensor with no readings to be stale: %+v", fresh)
+	}
+}
+
+func TestGaps(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	first, err := tldb.RetrieveRecordsLimit("sensor1", time.Unix(0, 0), time.Now(), 1)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("Could not read the first record: %v", err)
+	}
+	start, _ := time.Parse(time.RFC3339, first[0].TimeStamp)
+	latest, _, _ := tldb.LatestRecord("sensor1")
+	last, _ := time.Parse(time.RFC3339, latest.TimeStamp)
+
+	// Remove twenty minutes of readings
+	holeFrom := start.Add(time.Hour)
+	holeTo := holeFrom.Add(20 * time.Minute)
+	if _, err := tldb.DB.Exec("delete from sensor1 where id > ? and id < ?", holeFrom.Unix(), holeTo.Unix()); err != nil {
+		t.Fatalf("Could not delete records: %s", err.Error())
+	}
+
+	begin := start.Add(-time.Hour)
+	end := last.Add(time.Hour)
+	gaps, err := tldb.Gaps("sensor1", begin, end, 3*time.Minute, end)
+	if err != nil {
+		t.Fatalf("Could not find gaps: %s", err.Error())
+	}
+	if len(gaps) != 3 {
+		t.Fatalf("Expected leading, middle and trailing gaps, Actual %+v", gaps)
+	}
+	if !gaps[0].From.Equal(begin) || !gaps[0].To.Equal(start) || !gaps[2].From.Equal(last) || !gaps[2].To.Equal(end) {
+		t.Errorf("Unexpected edge gaps: %+v", gaps)
+	}
+	if gaps[1].From.After(holeFrom) || gaps[1].To.Before(holeTo) || gaps[1].Seconds > 25*60 {
+		t.Errorf("Unexpected middle gap: %+v", gaps[1])
+	}
+
+	tlWeb := TLWeb{Tldb: tldb}
+	w := httptest.NewRecorder()
+	tlWeb.APIGaps(w, httptest.NewRequest("GET", "/api/v1/gaps?sensor=sensor1&from="+start.Format(time.RFC3339)+"&to="+last.Format(time.RFC3339), nil))
+	var resp types.Gaps
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Could not parse response: %s", err.Error())
+	}
+	if resp.Sensor != "sensor1" || resp.Interval < 120 || len(resp.Gaps) != 1 {
+		t.Errorf("Unexpected gaps response: %+v", resp)
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.APIGaps(w, httptest.NewRequest("GET", "/api/v1/gaps?sensor=nosuchsensor", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown sensor, got %d", w.Code)
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	healthTimeout = 2 * time.Second
+	// watcherDownLimit is how long a watcher may stay down before the
+	// service is unhealthy; shorter outages are left to its restarts.
+	watcherDownLimit = 2 * watcherMaxBackoff
+)
+
+// Ping checks that the database answers a query.
+func (tldb TLDB) Ping(ctx context.Context) (err error) {
+	var one int
+	if err = tldb.DB.QueryRowContext(ctx, "select 1").Scan(&one); err != nil {
+		err = fmt.Errorf("Ping: Error querying database: %w", err)
+	}
+	return
+}
+
+// CheckHealth checks the database and the watchers.  With ready set every
+// watcher must be running; otherwise a watcher only fails once it has been
+// down longer than watcherDownLimit.
+func (tlweb TLWeb) CheckHealth(ctx context.Context, ready bool, now time.Time) (health types.Health) {
+	health.Add("database", tlweb.Tldb.Ping(ctx))
+	for _, watcher := range tlweb.Watchers {
+		alive, since, lastErr := watcher.Alive()
+		var err error
+		if !alive && (ready || now.Sub(since) > watcherDownLimit) {
+			err = fmt.Errorf("Down since %s: %v", since.Format(time.RFC3339), lastErr)
+		}
+		health.Add("watcher "+watcher.Path, err)
+	}
+	return
+}
+
+func (tlweb TLWeb) writeHealth(w http.ResponseWriter, req *http.Request, ready bool) {
+	ctx, cancel := context.WithTimeout(req.Context(), healthTimeout)
+	defer cancel()
+	health := tlweb.CheckHealth(ctx, ready, time.Now())
+	status := http.StatusOK
+	if health.Status != types.HealthOK {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, req, status, health)
+}
+
+// Healthz handles GET /healthz, which fails when the database is
+// unreachable or a watcher is not recovering, and the service should be
+// restarted.
+func (tlweb TLWeb) Healthz(w http.ResponseWriter, req *http.Request) {
+	tlweb.writeHealth(w, req, false)
+}
+
+// Readyz handles GET /readyz, which fails whenever the database is
+// unreachable or a watcher is not running, so new readings are not being
+// loaded.
+func (tlweb TLWeb) Readyz(w http.ResponseWriter, req *http.Request) {
+	tlweb.writeHealth(w, req, true)
+}
+
+// healthy is the check of the systemd watchdog.
+func (tlweb TLWeb) healthy() error {
+	ctx, cancel := context.WithTimeout(context.Background(), healthTimeout)
+	defer cancel()
+	return tlweb.CheckHealth(ctx, false, time.Now()).Err()
+}
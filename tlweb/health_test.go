@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestHealth(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	running := NewWatcher("logs")
+	running.setRunning(true, nil)
+	restarting := NewWatcher("logs-USB0")
+	restarting.setRunning(false, errors.New("inotifywait exited"))
+	tlWeb := TLWeb{Tldb: tldb, Watchers: []*Watcher{running, restarting}}
+
+	get := func(handler http.HandlerFunc, path string) (status int, health types.Health) {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+			t.Fatalf("%s: Could not parse response: %s", path, err.Error())
+		}
+		return w.Code, health
+	}
+
+	// A watcher that just exited is still being restarted
+	status, health := get(tlWeb.Healthz, "/healthz")
+	if status != http.StatusOK || health.Status != types.HealthOK || len(health.Checks) != 3 {
+		t.Errorf("Unexpected /healthz: %d %+v", status, health)
+	}
+	status, health = get(tlWeb.Readyz, "/readyz")
+	if status != http.StatusServiceUnavailable || health.Status != types.HealthUnhealthy || health.Checks[2].OK {
+		t.Errorf("Unexpected /readyz: %d %+v", status, health)
+	}
+
+	later := tlWeb.CheckHealth(context.Background(), false, time.Now().Add(watcherDownLimit+time.Second))
+	if later.Err() == nil || !later.Checks[1].OK {
+		t.Errorf("Watcher down too long should be unhealthy: %+v", later)
+	}
+
+	tldb.Close()
+	if tlWeb.healthy() == nil {
+		t.Error("Closed database should be unhealthy")
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"tempLogger/types"
+)
+
+// maxIngestBytes limits the size of a batch of readings.
+const maxIngestBytes = 8 << 20
+
+// ingestRetryAfter is how long, in seconds, a logger is asked to wait
+// before resending a batch that could not be stored.
+const ingestRetryAfter = "30"
+
+// Ingest handles POST /api/v1/ingest, a batch of readings as lines of JSON
+// from a logger.  Readings already stored are counted as duplicates, so a
+// batch that was not acknowledged can be sent again.  A token for one site
+// fills it in on readings without a site and may not send another's.  The
+// lines that are rejected are listed, so the logger can keep them.
+func (tlweb TLWeb) Ingest(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		writeAPIError(w, req, http.StatusMethodNotAllowed, "Method not allowed: "+req.Method)
+		return
+	}
+	var lines int
+	var tlDataList []types.THData
+	// dataLines holds the line number of each of tlDataList
+	var dataLines []int
+	var result types.IngestResult
+	var site string
+	if user := requestUser(req); user != nil {
+		site = user.Site
+	}
+	scanner := bufio.NewScanner(http.MaxBytesReader(w, req.Body, maxIngestBytes))
+	for scanner.Scan() {
+		lines++
+		var tlData types.THData
+		if err := json.Unmarshal(scanner.Bytes(), &tlData); err != nil {
+			log.Println("Ingest: Error parsing line:", scanner.Text())
+			result.RejectedLines = append(result.RejectedLines, lines)
+			parseErrors.Inc()
+			continue
+		}
+		if site != "" {
+			if tlData.Site != "" && tlData.Site != site {
+				log.Println("Ingest: Reading of site", tlData.Site, "refused for a token of", site)
+				result.RejectedLines = append(result.RejectedLines, lines)
+				continue
+			}
+			tlData.Site = site
+		}
+		tlDataList = append(tlDataList, tlData)
+		dataLines = append(dataLines, lines)
+	}
+	if err := scanner.Err(); err != nil {
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			writeAPIError(w, req, http.StatusRequestEntityTooLarge, "Batch larger than the limit; send fewer readings")
+			return
+		}
+		writeAPIError(w, req, http.StatusBadRequest, "Error reading batch: "+err.Error())
+		return
+	}
+
+	imported, err := tlweb.Tldb.ImportRecords(tlDataList)
+	if err != nil {
+		// Nothing is acknowledged; the readings stored so far are
+		// duplicates when the batch is sent again
+		log.Println("Ingest:", err.Error())
+		w.Header().Set("Retry-After", ingestRetryAfter)
+		writeAPIError(w, req, http.StatusServiceUnavailable, "Error storing readings")
+		return
+	}
+	result.Acked = lines
+	result.Inserted = len(imported.Inserted)
+	result.Duplicates = imported.Duplicates
+	for _, i := range imported.Rejected {
+		result.RejectedLines = append(result.RejectedLines, dataLines[i])
+	}
+	sort.Ints(result.RejectedLines)
+	result.Rejected = len(result.RejectedLines)
+	sender := "anonymous"
+	if user := requestUser(req); user != nil {
+		sender = user.Name
+	}
+	log.Println("Ingest:", sender, "sent", result.Inserted, "new records,", result.Duplicates, "duplicates,", result.Rejected, "errors.")
+	if tlweb.Alerts != nil {
+		tlweb.Alerts.Evaluate(imported.Inserted)
+	}
+	if tlweb.LiveBroker != nil {
+		tlweb.LiveBroker.PublishInserted(tlweb.Tldb, imported.Inserted)
+	}
+	writeJSON(w, req, http.StatusOK, result)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"tempLogger/types"
+	"testing"
+)
+
+func TestIngest(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb, LiveBroker: NewLiveBroker()}
+	batch := strings.Join([]string{
+		// Already loaded from the test log
+		`{"id":"sensor1","timestamp":"2024-01-14T00:00:04-07:00","humidity":99.9,"tempC":-2.4,"tempF":27.68}`,
+		`{"id":"sensor3","timestamp":"2024-01-15T00:00:04-07:00","humidity":50,"tempC":20,"tempF":68}`,
+		`{"id":"sensor3","timestamp":"2024-01-15T00:02:04-07:00","humidity":50,"tempC":20.1,"tempF":68.18}`,
+		`not json`,
+		`{"id":"3rd sensor","timestamp":"2024-01-15T00:02:04-07:00"}`,
+	}, "\n") + "\n"
+	send := func(method string, body string) (w *httptest.ResponseRecorder, result types.IngestResult) {
+		w = httptest.NewRecorder()
+		tlWeb.Ingest(w, httptest.NewRequest(method, types.IngestPath, strings.NewReader(body)))
+		json.Unmarshal(w.Body.Bytes(), &result)
+		return
+	}
+
+	w, result := send("POST", batch)
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+	// The bad lines are listed so the logger can keep them
+	expected := types.IngestResult{Acked: 5, Inserted: 2, Duplicates: 1, Rejected: 2, RejectedLines: []int{4, 5}}
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, result)
+	}
+	if n, _ := tldb.RecordCount("sensor3"); n != 2 {
+		t.Errorf("Expected 2 readings of the new sensor, got %d", n)
+	}
+
+	// A batch sent again after a lost acknowledgement stores nothing twice
+	if _, result = send("POST", batch); result.Inserted != 0 || result.Duplicates != 3 || result.Acked != 5 {
+		t.Errorf("Unexpected result of a resent batch: %+v", result)
+	}
+
+	if w, _ = send("GET", ""); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected %d, got %d", http.StatusMethodNotAllowed, w.Code)
+	}
+	if w, _ = send("POST", strings.Repeat(batch, maxIngestBytes/len(batch)+1)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected %d, got %d", http.StatusRequestEntityTooLarge, w.Code)
+	}
+}
+
+func TestIngestReserved(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+	if _, _, err := tldb.AddToken("logger", types.RoleIngest, ""); err != nil {
+		t.Fatalf("AddToken: %s", err.Error())
+	}
+
+	tlWeb := TLWeb{Tldb: tldb}
+	batch := `{"id":"tltoken","timestamp":"2024-01-15T00:00:04-07:00","humidity":50,"tempC":20,"tempF":68}
+{"id":"TLuser","timestamp":"2024-01-15T00:00:04-07:00","humidity":50,"tempC":20,"tempF":68}
+{"id":"sqlite_master","timestamp":"2024-01-15T00:00:04-07:00","humidity":50,"tempC":20,"tempF":68}
+{"id":"master","site":"sqlite","timestamp":"2024-01-15T00:00:04-07:00","humidity":50,"tempC":20,"tempF":68}
+`
+	w := httptest.NewRecorder()
+	tlWeb.Ingest(w, httptest.NewRequest("POST", types.IngestPath, strings.NewReader(batch)))
+	var result types.IngestResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Inserted != 0 || result.Rejected != 4 || len(result.RejectedLines) != 4 {
+		t.Errorf("Expected the reserved ids to be rejected, got %d %+v", w.Code, result)
+	}
+	if tldb.HasTable("tltoken") || len(tldb.Sensors()) != 1 {
+		t.Errorf("Reserved table registered as a sensor: %v", tldb.Sensors())
+	}
+	if tokens, err := tldb.Tokens(); err != nil || len(tokens) != 1 {
+		t.Errorf("Expected the token to remain, got %v %v", tokens, err)
+	}
+	if err := tldb.NewTable("tltoken"); err == nil {
+		t.Error("Expected NewTable to refuse a reserved name")
+	}
+
+	// A registry written before reserved names were refused is ignored,
+	// and its rows still hold their ids when new sensors are registered
+	if _, err := tldb.DB.Exec("insert into tltables(id, name) values(2, 'tltoken')"); err != nil {
+		t.Fatalf("Could not register tltoken: %s", err.Error())
+	}
+	if err := tldb.NewTable("tlkitchen"); err != nil {
+		t.Fatalf("Expected a sensor named like tlweb's tables to be allowed: %s", err.Error())
+	}
+	reopened, err := NewDB(testDbPath)
+	if err != nil {
+		t.Fatalf("NewDB: %s", err.Error())
+	}
+	defer reopened.Close()
+	if reopened.HasTable("tltoken") || !reopened.HasTable("tlkitchen") {
+		t.Errorf("Unexpected tables loaded from tltables: %v", reopened.Sensors())
+	}
+	imported, err := reopened.ImportRecords([]types.THData{{ID: "outside", TimeStamp: "2024-01-15T00:00:04-07:00", TempF: 20}})
+	if err != nil || len(imported.Inserted) != 1 || !reopened.HasTable("outside") {
+		t.Errorf("Could not add a sensor after reopening: %v %+v", err, imported)
+	}
+}
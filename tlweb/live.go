@@ -0,0 +1,230 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	// liveBuffer is the number of readings queued for a client.  A client
+	// that falls further behind is disconnected and backfills when its
+	// browser reconnects.
+	liveBuffer = 1024
+	// maxBackfill limits the readings sent per sensor on reconnection.
+	maxBackfill   = 5000
+	liveKeepAlive = 30 * time.Second
+	liveRetry     = 5 * time.Second
+)
+
+// LiveBroker passes newly inserted readings to the connected live clients.
+type LiveBroker struct {
+	mu      sync.Mutex
+	clients map[chan types.THData]bool
+}
+
+func NewLiveBroker() *LiveBroker {
+	return &LiveBroker{clients: make(map[chan types.THData]bool)}
+}
+
+func (lb *LiveBroker) subscribe() chan types.THData {
+	ch := make(chan types.THData, liveBuffer)
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	lb.clients[ch] = true
+	return ch
+}
+
+func (lb *LiveBroker) unsubscribe(ch chan types.THData) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	if lb.clients[ch] {
+		delete(lb.clients, ch)
+		close(ch)
+	}
+}
+
+// Publish sends calibrated readings to every client, dropping clients that
+// cannot keep up.
+func (lb *LiveBroker) Publish(records []types.THData) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	for ch := range lb.clients {
+	records:
+		for _, thd := range records {
+			select {
+			case ch <- thd:
+			default:
+				delete(lb.clients, ch)
+				close(ch)
+				break records
+			}
+		}
+	}
+}
+
+// Clients returns the number of connected clients.
+func (lb *LiveBroker) Clients() int {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+	return len(lb.clients)
+}
+
+// PublishInserted calibrates newly inserted readings and publishes them.
+func (lb *LiveBroker) PublishInserted(tldb TLDB, records []types.THData) {
+	calibrated := make([]types.THData, 0, len(records))
+	for _, thd := range records {
+		ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+		if err != nil {
+			continue
+		}
+		thd.Calibrate(tldb.Calibrations(thd.ID), ts)
+		calibrated = append(calibrated, thd)
+	}
+	lb.Publish(calibrated)
+}
+
+// parseLiveCursor reads the position of a client: the Last-Event-ID header
+// sent by a reconnecting browser, which holds the newest reading time seen
+// from each sensor, or else the since parameter, which applies to every
+// sensor.  Sensors missing from the Last-Event-ID, such as those that first
+// reported while the browser was away, start from its oldest time.
+func parseLiveCursor(req *http.Request, sensors []string) (cursor map[string]int64, err error) {
+	cursor = make(map[string]int64)
+	if lastID := req.Header.Get("Last-Event-ID"); lastID != "" {
+		vals, perr := url.ParseQuery(lastID)
+		if perr != nil {
+			err = fmt.Errorf("parseLiveCursor: Invalid Last-Event-ID: %s", lastID)
+			return
+		}
+		oldest := int64(math.MaxInt64)
+		for sensor := range vals {
+			if cursor[sensor], err = strconv.ParseInt(vals.Get(sensor), 10, 64); err != nil {
+				err = fmt.Errorf("parseLiveCursor: Invalid Last-Event-ID: %s", lastID)
+				return
+			}
+			oldest = min(oldest, cursor[sensor])
+		}
+		if len(cursor) == 0 {
+			return
+		}
+		for _, sensor := range sensors {
+			if _, ok := cursor[sensor]; !ok {
+				cursor[sensor] = oldest
+			}
+		}
+		return
+	}
+	if since := req.URL.Query().Get("since"); since != "" {
+		ts, perr := parseTimeParam(since, time.Time{})
+		if perr != nil {
+			err = fmt.Errorf("parseLiveCursor: %w", perr)
+			return
+		}
+		for _, sensor := range sensors {
+			cursor[sensor] = ts.Unix()
+		}
+	}
+	return
+}
+
+func encodeLiveCursor(cursor map[string]int64) string {
+	vals := make(url.Values, len(cursor))
+	for sensor, ts := range cursor {
+		vals.Set(sensor, strconv.FormatInt(ts, 10))
+	}
+	return vals.Encode()
+}
+
+// APILive handles GET /api/v1/live?units=&since=, a stream of server-sent
+// "reading" events as readings are inserted.  Readings missed since the
+// cursor are sent first.
+func (tlweb TLWeb) APILive(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok || tlweb.LiveBroker == nil {
+		writeAPIError(w, req, http.StatusNotImplemented, "Live updates are not available")
+		return
+	}
+	unit, err := tlweb.RequestUnits(w, req)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	sensors := tlweb.Tldb.Sensors()
+	cursor, err := parseLiveCursor(req, sensors)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// Subscribe before backfilling so nothing inserted in between is lost;
+	// the cursor drops anything sent twice.
+	ch := tlweb.LiveBroker.subscribe()
+	defer tlweb.LiveBroker.unsubscribe(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	fmt.Fprintf(w, "retry: %d\n\n", liveRetry.Milliseconds())
+
+	send := func(thd types.THData) error {
+		ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+		if err != nil || ts.Unix() <= cursor[thd.ID] {
+			return nil
+		}
+		cursor[thd.ID] = ts.Unix()
+		data, err := json.Marshal(types.LiveReading{Sensor: thd.ID, Point: types.NewChartPoint(ts, thd, unit)})
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(w, "id: %s\nevent: reading\ndata: %s\n\n", encodeLiveCursor(cursor), data)
+		return err
+	}
+
+	for sensor, since := range cursor {
+		if !tlweb.Tldb.HasTable(sensor) {
+			continue
+		}
+		records, err := tlweb.Tldb.RetrieveRecordsLimit(sensor, time.Unix(since, 0), time.Now().Add(time.Hour), maxBackfill)
+		if err != nil {
+			log.Println("APILive:", err.Error())
+			continue
+		}
+		for _, thd := range records {
+			if err = send(thd); err != nil {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(liveKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case thd, ok := <-ch:
+			if !ok {
+				// Too far behind; the browser reconnects and backfills
+				return
+			}
+			if err := send(thd); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-req.Context().Done():
+			return
+		}
+	}
+}
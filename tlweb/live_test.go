@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+// readEvent returns the id and data of the next reading event.
+func readEvent(t *testing.T, scanner *bufio.Scanner) (id string, reading types.LiveReading) {
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "id: "):
+			id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "data: "):
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &reading); err != nil {
+				t.Fatalf("Could not parse event: %s", err.Error())
+			}
+			return
+		}
+	}
+	t.Fatalf("Stream ended: %v", scanner.Err())
+	return
+}
+
+func TestLive(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	broker := NewLiveBroker()
+	tlWeb := TLWeb{Tldb: tldb, LiveBroker: broker}
+	server := httptest.NewServer(http.HandlerFunc(tlWeb.APILive))
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "?units=C")
+	if err != nil {
+		t.Fatalf("Could not connect: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("Unexpected content type: %s", ct)
+	}
+	for broker.Clients() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	thd := types.THData{ID: "sensor1", TimeStamp: "2024-01-15T12:00:00Z", TempC: 1.5, TempF: 34.7, Humidity: 80}
+	broker.Publish([]types.THData{thd, thd})
+	scanner := bufio.NewScanner(resp.Body)
+	id, reading := readEvent(t, scanner)
+	if reading.Sensor != "sensor1" || reading.Point.Temp != 1.5 || reading.Point.Date != 1705320000000 {
+		t.Errorf("Unexpected reading: %+v", reading)
+	}
+	cursor, _ := url.ParseQuery(id)
+	if cursor.Get("sensor1") != "1705320000" {
+		t.Errorf("Unexpected event id: %s", id)
+	}
+	resp.Body.Close()
+
+	// A reconnecting browser gets the readings after its last event id
+	records, _ := tldb.RetrieveRecordsLimit("sensor1", time.Unix(0, 0), time.Now(), 10)
+	last, _ := time.Parse(time.RFC3339, records[7].TimeStamp)
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	req.Header.Set("Last-Event-ID", "sensor1="+strconv.FormatInt(last.Unix(), 10))
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Could not reconnect: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	_, reading = readEvent(t, bufio.NewScanner(resp.Body))
+	next, _ := time.Parse(time.RFC3339, records[8].TimeStamp)
+	if reading.Point.Date != next.UnixMilli() {
+		t.Errorf("Backfill started at %d, Expected %d", reading.Point.Date, next.UnixMilli())
+	}
+
+	resp.Body.Close()
+
+	// A sensor that first reported while the browser was away is sent from
+	// the time of the cursor
+	latest, _, _ := tldb.LatestRecord("sensor1")
+	end, _ := time.Parse(time.RFC3339, latest.TimeStamp)
+	next = end.Add(time.Minute)
+	imported, err := tldb.ImportRecords([]types.THData{
+		{ID: "sensor2", TimeStamp: end.Add(-time.Hour).Format(time.RFC3339), TempC: 5, TempF: 41},
+		{ID: "sensor2", TimeStamp: next.Format(time.RFC3339), TempC: 6, TempF: 42.8},
+	})
+	if err != nil || len(imported.Inserted) != 2 {
+		t.Fatalf("ImportRecords: %v %+v", err, imported)
+	}
+	req, _ = http.NewRequest("GET", server.URL+"?units=C", nil)
+	req.Header.Set("Last-Event-ID", "sensor1="+strconv.FormatInt(end.Unix(), 10))
+	// Nothing else is sent, so a missed backfill times out
+	resp, err = (&http.Client{Timeout: 10 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatalf("Could not reconnect: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	_, reading = readEvent(t, bufio.NewScanner(resp.Body))
+	if reading.Sensor != "sensor2" || reading.Point.Date != next.UnixMilli() || reading.Point.Temp != 6 {
+		t.Errorf("Expected the new sensor to be backfilled, got %+v", reading)
+	}
+
+	w := httptest.NewRecorder()
+	tlWeb.APILive(w, httptest.NewRequest("GET", "/api/v1/live?since=yesterday", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid since, got %d", w.Code)
+	}
+}
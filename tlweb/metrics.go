@@ -0,0 +1,104 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"tempLogger/metrics"
+	"tempLogger/types"
+	"time"
+)
+
+// registry holds the internal metrics served on /metrics.
+var registry = metrics.NewRegistry()
+
+var (
+	recordsInserted = registry.NewCounter("tlweb_records_inserted_total",
+		"Readings inserted into the database.", "sensor")
+	recordsDuplicate = registry.NewCounter("tlweb_records_duplicate_total",
+		"Readings skipped because they were already in the database.", "sensor")
+	recordsPruned = registry.NewCounter("tlweb_records_pruned_total",
+		"Readings deleted because they were older than the retention period.", "sensor")
+	parseErrors = registry.NewCounter("tlweb_parse_errors_total",
+		"Log lines that could not be parsed or inserted.")
+	watcherRestarts = registry.NewCounter("tlweb_watcher_restarts_total",
+		"Times a file watcher was restarted after exiting.", "path")
+	queryDuration = registry.NewHistogram("tlweb_db_query_duration_seconds",
+		"Database query latency.", metrics.DefaultBuckets, "op")
+	httpRequests = registry.NewCounter("tlweb_http_requests_total",
+		"HTTP requests by handler and status code.", "handler", "code")
+)
+
+// observeQuery records the latency of a database operation started at
+// start.  It is meant to be deferred.
+func observeQuery(op string, start time.Time) {
+	queryDuration.Observe(time.Since(start).Seconds(), op)
+}
+
+// registerReadingMetrics adds gauges of the newest reading of each sensor,
+// read from the database when scraped.
+func registerReadingMetrics(reg *metrics.Registry, tldb TLDB) {
+	latest := func(value func(thd types.THData, ts time.Time) float64) func() []metrics.Sample {
+		return func() (samples []metrics.Sample) {
+			for _, sensor := range tldb.Sensors() {
+				thd, found, err := tldb.LatestRecord(sensor)
+				if err != nil || !found {
+					continue
+				}
+				ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+				if err != nil {
+					continue
+				}
+				samples = append(samples, metrics.Sample{LabelValues: []string{sensor}, Value: value(thd, ts)})
+			}
+			return
+		}
+	}
+	sensorLabel := []string{"sensor"}
+	reg.NewGaugeFunc("tlweb_temperature_celsius", "Newest temperature reading.", sensorLabel,
+		latest(func(thd types.THData, ts time.Time) float64 { return float64(thd.TempC) }))
+	reg.NewGaugeFunc("tlweb_humidity_percent", "Newest relative humidity reading.", sensorLabel,
+		latest(func(thd types.THData, ts time.Time) float64 { return float64(thd.Humidity) }))
+	reg.NewGaugeFunc("tlweb_heat_index_celsius", "Newest heat index reading.", sensorLabel,
+		latest(func(thd types.THData, ts time.Time) float64 { return float64(thd.HeatIndexC) }))
+	reg.NewGaugeFunc("tlweb_last_reading_timestamp_seconds", "Time of the newest reading.", sensorLabel,
+		latest(func(thd types.THData, ts time.Time) float64 { return float64(ts.Unix()) }))
+}
+
+// statusRecorder remembers the status code written by a handler.  It passes
+// Flush through so streaming handlers still work.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (sr *statusRecorder) Flush() {
+	if flusher, ok := sr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// instrument counts the requests handled by fn under the given name.
+func instrument(name string, fn http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		sr := &statusRecorder{ResponseWriter: w}
+		fn(sr, req)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		httpRequests.Inc(name, strconv.Itoa(sr.status))
+	}
+}
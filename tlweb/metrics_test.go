@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tempLogger/metrics"
+	"testing"
+)
+
+func TestInstrument(t *testing.T) {
+	before := httpRequests.Value("test", "404")
+	handler := instrument("test", func(w http.ResponseWriter, req *http.Request) {
+		http.NotFound(w, req)
+	})
+	handler(httptest.NewRecorder(), httptest.NewRequest("GET", "/missing", nil))
+	if httpRequests.Value("test", "404") != before+1 {
+		t.Error("Request not counted")
+	}
+	before = httpRequests.Value("test", "200")
+	instrument("test", func(w http.ResponseWriter, req *http.Request) {})(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if httpRequests.Value("test", "200") != before+1 {
+		t.Error("Request without a body not counted as 200")
+	}
+}
+
+func TestReadingMetrics(t *testing.T) {
+	inserted := recordsInserted.Value("sensor1")
+	duplicate := recordsDuplicate.Value("sensor1")
+	tldb := newTestDB(t)
+	defer tldb.Close()
+	if recordsInserted.Value("sensor1") != inserted+702 {
+		t.Errorf("Unexpected inserted count: %v", recordsInserted.Value("sensor1")-inserted)
+	}
+	if err := tldb.InsertLog("test/tempLogger-20240114-1.log"); err != nil {
+		t.Fatalf("Error inserting log into database: %s", err.Error())
+	}
+	if recordsDuplicate.Value("sensor1") != duplicate+702 {
+		t.Errorf("Unexpected duplicate count: %v", recordsDuplicate.Value("sensor1")-duplicate)
+	}
+
+	reg := metrics.NewRegistry()
+	registerReadingMetrics(reg, tldb)
+	var buf bytes.Buffer
+	if err := reg.WriteText(&buf); err != nil {
+		t.Fatalf("WriteText: %s", err.Error())
+	}
+	for _, name := range []string{"tlweb_temperature_celsius", "tlweb_humidity_percent",
+		"tlweb_heat_index_celsius", "tlweb_last_reading_timestamp_seconds"} {
+		if !strings.Contains(buf.String(), name+`{sensor="sensor1"} `) {
+			t.Errorf("Missing %s in:\n%s", name, buf.String())
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"tempLogger/types"
+	"time"
+)
+
+const notifyTimeout = 30 * time.Second
+
+// notifier sends an alert event to one destination.
+type notifier interface {
+	Notify(ev types.AlertEvent) error
+}
+
+// newNotifier checks the settings of ch and returns its notifier.
+func newNotifier(ch types.AlertChannel) (n notifier, err error) {
+	switch ch.Type {
+	case types.ChannelWebhook:
+		if ch.URL == "" {
+			err = fmt.Errorf("newNotifier: Channel %s needs a url", ch.Name)
+			return
+		}
+		n = webhookNotifier{url: ch.URL, client: &http.Client{Timeout: notifyTimeout}}
+	case types.ChannelSMTP:
+		if ch.Host == "" || ch.From == "" || len(ch.To) == 0 {
+			err = fmt.Errorf("newNotifier: Channel %s needs a host, from and to", ch.Name)
+			return
+		}
+		if ch.Port == 0 {
+			ch.Port = 587
+		}
+		n = smtpNotifier{ch}
+	case types.ChannelCommand:
+		if ch.Command == "" {
+			err = fmt.Errorf("newNotifier: Channel %s needs a command", ch.Name)
+			return
+		}
+		n = commandNotifier{ch}
+	default:
+		err = fmt.Errorf("newNotifier: Channel %s has unknown type: %s", ch.Name, ch.Type)
+	}
+	return
+}
+
+// webhookNotifier posts the event as JSON.
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+func (wn webhookNotifier) Notify(ev types.AlertEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("Notify: Error encoding event: %w", err)
+	}
+	resp, err := wn.client.Post(wn.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Notify: Error posting to %s: %w", wn.url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("Notify: %s returned %s", wn.url, resp.Status)
+	}
+	return nil
+}
+
+// smtpNotifier mails the event, authenticating if a username is set.
+type smtpNotifier struct {
+	ch types.AlertChannel
+}
+
+func (sn smtpNotifier) Notify(ev types.AlertEvent) error {
+	var auth smtp.Auth
+	if sn.ch.Username != "" {
+		auth = smtp.PlainAuth("", sn.ch.Username, sn.ch.Password, sn.ch.Host)
+	}
+	subject := "tlweb alert " + ev.State + ": " + ev.Rule + " " + ev.Sensor
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", sn.ch.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(sn.ch.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	fmt.Fprintf(&msg, "%s\r\n\r\nAt %s\r\n", ev.Message, time.UnixMilli(ev.Date).Format(time.RFC3339))
+	addr := sn.ch.Host + ":" + strconv.Itoa(sn.ch.Port)
+	if err := smtp.SendMail(addr, auth, sn.ch.From, sn.ch.To, []byte(msg.String())); err != nil {
+		return fmt.Errorf("Notify: Error sending mail through %s: %w", addr, err)
+	}
+	return nil
+}
+
+// commandNotifier runs a local command with the event as JSON on stdin and
+// its fields in TL_ALERT_* environment variables.
+type commandNotifier struct {
+	ch types.AlertChannel
+}
+
+func (cn commandNotifier) Notify(ev types.AlertEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return fmt.Errorf("Notify: Error encoding event: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, cn.ch.Command, cn.ch.Args...)
+	cmd.Stdin = bytes.NewReader(body)
+	cmd.Env = append(os.Environ(),
+		"TL_ALERT_RULE="+ev.Rule,
+		"TL_ALERT_SENSOR="+ev.Sensor,
+		"TL_ALERT_STATE="+ev.State,
+		"TL_ALERT_VALUE="+strconv.FormatFloat(float64(ev.Value), 'f', -1, 32),
+		"TL_ALERT_MESSAGE="+ev.Message,
+	)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("Notify: Error running %s: %w: %s", cn.ch.Command, err, out)
+	}
+	return nil
+}
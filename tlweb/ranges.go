@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	defaultRange = "2d"
+	// maxChartPoints is the most points a chart series should have before
+	// the readings are averaged into coarser buckets.
+	maxChartPoints = 2500
+	inputLayout    = "2006-01-02T15:04"
+)
+
+// rangePresets are the ranges offered as buttons on the page.
+var rangePresets = []types.RangePreset{
+	{Label: "6 Hours", Range: "6h"},
+	{Label: "Daily", Range: "2d"},
+	{Label: "24 Hours", Range: "24h"},
+	{Label: "Weekly", Range: "7d"},
+	{Label: "30 Days", Range: "30d"},
+	{Label: "Year", Range: "1y"},
+	{Label: "Year to Date", Range: "ytd"},
+}
+
+// resolution is a bucket width used to average readings on long ranges.  A
+// zero step means raw readings are used.
+type resolution struct {
+	Step     time.Duration
+	Label    string
+	TimeUnit string
+	Count    int
+}
+
+// The loggers record roughly every two minutes, so raw data is treated as a
+// two minute resolution when deciding whether to average.
+var resolutions = []resolution{
+	{Step: 0, Label: "Raw readings", TimeUnit: "minute", Count: 2},
+	{Step: 5 * time.Minute, Label: "5 minute averages", TimeUnit: "minute", Count: 5},
+	{Step: 15 * time.Minute, Label: "15 minute averages", TimeUnit: "minute", Count: 15},
+	{Step: time.Hour, Label: "Hourly averages", TimeUnit: "hour", Count: 1},
+	{Step: 3 * time.Hour, Label: "3 hour averages", TimeUnit: "hour", Count: 3},
+	{Step: 6 * time.Hour, Label: "6 hour averages", TimeUnit: "hour", Count: 6},
+	{Step: 24 * time.Hour, Label: "Daily averages", TimeUnit: "day", Count: 1},
+}
+
+// chooseResolution returns the finest resolution that keeps the number of
+// chart points for the span under maxChartPoints.
+func chooseResolution(span time.Duration) resolution {
+	for _, res := range resolutions {
+		step := res.Step
+		if step == 0 {
+			step = 2 * time.Minute
+		}
+		if span/step <= maxChartPoints {
+			return res
+		}
+	}
+	return resolutions[len(resolutions)-1]
+}
+
+var relativeRange = regexp.MustCompile(`^([0-9]+)([hdwy])$`)
+
+// pageRange is the period shown on a page.
+type pageRange struct {
+	Begin time.Time
+	End   time.Time
+	Range string
+	Label string
+}
+
+// parseRangeDuration converts a relative range such as 6h, 7d, 2w or 1y,
+// or the special value ytd, into its start time given the end time.
+func parseRangeDuration(rng string, end time.Time) (begin time.Time, err error) {
+	if rng == "ytd" {
+		begin = time.Date(end.Year(), time.January, 1, 0, 0, 0, 0, end.Location())
+		return
+	}
+	match := relativeRange.FindStringSubmatch(rng)
+	if match == nil {
+		err = fmt.Errorf("parseRangeDuration: Unknown range: %s", rng)
+		return
+	}
+	n, err := strconv.Atoi(match[1])
+	if err != nil || n <= 0 {
+		err = fmt.Errorf("parseRangeDuration: Invalid range: %s", rng)
+		return
+	}
+	switch match[2] {
+	case "h":
+		begin = end.Add(-time.Duration(n) * time.Hour)
+	case "d":
+		begin = end.AddDate(0, 0, -n)
+	case "w":
+		begin = end.AddDate(0, 0, -7*n)
+	case "y":
+		begin = end.AddDate(-n, 0, 0)
+	}
+	return
+}
+
+// parsePageRange reads either range, or from and to, from the query.  With
+// neither it returns the default range ending now.
+func parsePageRange(query url.Values, now time.Time) (pr pageRange, err error) {
+	from := query.Get("from")
+	to := query.Get("to")
+	pr.Range = query.Get("range")
+	if pr.Range == "" && from == "" && to == "" {
+		pr.Range = defaultRange
+	}
+	if pr.Range != "" {
+		pr.End = now
+		pr.Begin, err = parseRangeDuration(pr.Range, now)
+		if err != nil {
+			return
+		}
+		pr.Label = pr.Range
+		for _, preset := range rangePresets {
+			if preset.Range == pr.Range {
+				pr.Label = preset.Label
+			}
+		}
+		return
+	}
+	pr.End, err = parseTimeParam(to, now)
+	if err != nil {
+		return
+	}
+	pr.Begin, err = parseTimeParam(from, pr.End.Add(-time.Hour*24))
+	if err != nil {
+		return
+	}
+	if !pr.Begin.Before(pr.End) {
+		err = fmt.Errorf("parsePageRange: from must be before to")
+		return
+	}
+	pr.Label = pr.Begin.Format("Jan 2 2006 15:04") + " to " + pr.End.Format("Jan 2 2006 15:04")
+	return
+}
+
+// rangeURL builds a link to the page for an explicit period.
+func rangeURL(begin time.Time, end time.Time) string {
+	query := url.Values{}
+	query.Set("from", begin.Format(inputLayout))
+	query.Set("to", end.Format(inputLayout))
+	return "/?" + query.Encode()
+}
+
+// fillPageRange copies the period and navigation details into tlPage.
+func fillPageRange(tlPage *types.TLPage, pr pageRange, res resolution, now time.Time) {
+	span := pr.End.Sub(pr.Begin)
+	tlPage.Range = pr.Range
+	tlPage.From = pr.Begin.UnixMilli()
+	tlPage.To = pr.End.UnixMilli()
+	tlPage.FromInput = pr.Begin.Format(inputLayout)
+	tlPage.ToInput = pr.End.Format(inputLayout)
+	tlPage.PrevURL = rangeURL(pr.Begin.Add(-span), pr.Begin)
+	if pr.End.Before(now.Add(-time.Minute)) {
+		tlPage.NextURL = rangeURL(pr.End, pr.End.Add(span))
+	}
+	tlPage.Resolution = res.Label
+	tlPage.BaseInterval = types.BaseInterval{TimeUnit: res.TimeUnit, Count: res.Count}
+	for _, preset := range rangePresets {
+		preset.Active = preset.Range == pr.Range
+		tlPage.Presets = append(tlPage.Presets, preset)
+	}
+}
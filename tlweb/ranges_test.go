@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePageRange(t *testing.T) {
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.Local)
+	tests := []struct {
+		query string
+		begin time.Time
+		end   time.Time
+	}{
+		{"", now.AddDate(0, 0, -2), now},
+		{"range=6h", now.Add(-6 * time.Hour), now},
+		{"range=30d", now.AddDate(0, 0, -30), now},
+		{"range=1y", now.AddDate(-1, 0, 0), now},
+		{"range=ytd", time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local), now},
+		{"from=2024-01-14&to=2024-01-15", time.Date(2024, time.January, 14, 0, 0, 0, 0, time.Local),
+			time.Date(2024, time.January, 15, 0, 0, 0, 0, time.Local)},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		pr, err := parsePageRange(query, now)
+		if err != nil {
+			t.Errorf("%s: Unexpected error: %s", test.query, err.Error())
+			continue
+		}
+		if !pr.Begin.Equal(test.begin) || !pr.End.Equal(test.end) {
+			t.Errorf("%s: Expected %s to %s, Actual %s to %s", test.query, test.begin, test.end, pr.Begin, pr.End)
+		}
+	}
+
+	for _, bad := range []string{"range=5x", "range=0d", "from=2024-01-15&to=2024-01-14", "from=soon"} {
+		query, _ := url.ParseQuery(bad)
+		if _, err := parsePageRange(query, now); err == nil {
+			t.Errorf("%s: Expected an error", bad)
+		}
+	}
+}
+
+func TestChooseResolution(t *testing.T) {
+	tests := []struct {
+		span time.Duration
+		step time.Duration
+	}{
+		{6 * time.Hour, 0},
+		{48 * time.Hour, 0},
+		{7 * 24 * time.Hour, 5 * time.Minute},
+		{30 * 24 * time.Hour, time.Hour},
+		{365 * 24 * time.Hour, 6 * time.Hour},
+		{20 * 365 * 24 * time.Hour, 24 * time.Hour},
+	}
+	for _, test := range tests {
+		if res := chooseResolution(test.span); res.Step != test.step {
+			t.Errorf("%s: Expected step %s, Actual %s", test.span, test.step, res.Step)
+		}
+	}
+}
+
+func TestRetrieveAveraged(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	begin := time.Unix(1705298580, 0)
+	end := time.Unix(1705300900, 0)
+	raw, err := tldb.RetrieveAveraged("sensor1", begin, end, 0)
+	if err != nil {
+		t.Fatalf("Could not read records: %s", err.Error())
+	}
+	if len(raw) != 19 {
+		t.Errorf("Incorrect number of raw records: Expected %d, Actual %d", 19, len(raw))
+	}
+	hourly, err := tldb.RetrieveAveraged("sensor1", begin, end, time.Hour)
+	if err != nil {
+		t.Fatalf("Could not read averaged records: %s", err.Error())
+	}
+	if len(hourly) == 0 || len(hourly) > 2 {
+		t.Errorf("Unexpected number of hourly buckets: %d", len(hourly))
+	}
+}
+
+func TestShowRange(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	w := httptest.NewRecorder()
+	tlWeb.ShowRange(w, httptest.NewRequest("GET", "/?from=2024-01-13&to=2024-01-16", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "Raw readings") {
+		t.Error("Page is missing the resolution")
+	}
+	w = httptest.NewRecorder()
+	tlWeb.ShowRange(w, httptest.NewRequest("GET", "/?range=forever", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected %d, got %d", http.StatusBadRequest, w.Code)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"tempLogger/types"
+	"time"
+)
+
+// column is a column added to a table after it was first created.
+type column struct {
+	name    string
+	colType string
+}
+
+// registryColumns are the sensor metadata columns added to tltables.
+var registryColumns = []column{
+	{"display_name", "text"},
+	{"location", "text"},
+	{"install_date", "text"},
+	{"hardware", "text"},
+	{"color", "text"},
+	{"sort_order", "integer"},
+	{"expected_interval", "integer"},
+	{"stale_after", "integer"},
+	{"site", "text"},
+}
+
+// addColumns adds the columns table does not have yet.
+func (tldb TLDB) addColumns(table string, columns []column) (err error) {
+	rows, err := tldb.DB.Query(fmt.Sprintf("pragma table_info(%s)", table))
+	if err != nil {
+		err = fmt.Errorf("addColumns: Error reading %s columns: %w", table, err)
+		return
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt any
+		err = rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk)
+		if err != nil {
+			rows.Close()
+			err = fmt.Errorf("addColumns: Error reading %s columns: %w", table, err)
+			return
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("addColumns: General error reading %s columns: %w", table, err)
+		return
+	}
+
+	for _, col := range columns {
+		if existing[col.name] {
+			continue
+		}
+		sqlStmt := fmt.Sprintf("alter table %s add column %s %s", table, col.name, col.colType)
+		if _, err = tldb.DB.Exec(sqlStmt); err != nil {
+			err = fmt.Errorf("addColumns: Error adding column: %s: %w", sqlStmt, err)
+			return
+		}
+	}
+	return
+}
+
+// migrateRegistry adds the metadata columns to an existing tltables and
+// creates the calibration table.
+func (tldb TLDB) migrateRegistry() (err error) {
+	if err = tldb.addColumns("tltables", registryColumns); err != nil {
+		err = fmt.Errorf("migrateRegistry: %w", err)
+		return
+	}
+
+	sqlStmt := "create table if not exists tlcalibration (id integer not null primary key, sensor text not null, metric text not null, cal_offset float not null, cal_scale float not null, effective integer not null)"
+	if _, err = tldb.DB.Exec(sqlStmt); err != nil {
+		err = fmt.Errorf("migrateRegistry: Error creating tlcalibration: %s: %w", sqlStmt, err)
+		return
+	}
+	return
+}
+
+// loadCalibrations fills the calibration cache, which must already be
+// allocated, from the database.
+func (tldb TLDB) loadCalibrations() (err error) {
+	rows, err := tldb.DB.Query("select sensor, metric, cal_offset, cal_scale, effective from tlcalibration order by effective, id")
+	if err != nil {
+		err = fmt.Errorf("loadCalibrations: Error querying tlcalibration: %w", err)
+		return
+	}
+	defer rows.Close()
+	calibrations := make(map[string][]types.Calibration)
+	for rows.Next() {
+		var sensor string
+		var cal types.Calibration
+		var effective int64
+		err = rows.Scan(&sensor, &cal.Metric, &cal.Offset, &cal.Scale, &effective)
+		if err != nil {
+			err = fmt.Errorf("loadCalibrations: Error reading query of tlcalibration: %w", err)
+			return
+		}
+		cal.Effective = time.Unix(effective, 0)
+		calibrations[sensor] = append(calibrations[sensor], cal)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("loadCalibrations: General error reading query of tlcalibration: %w", err)
+		return
+	}
+	tldb.mu.Lock()
+	defer tldb.mu.Unlock()
+	for key, val := range calibrations {
+		tldb.calibrations[key] = val
+	}
+	return
+}
+
+// Calibrations returns the calibration history of sensor, oldest first.
+func (tldb TLDB) Calibrations(sensor string) []types.Calibration {
+	tldb.mu.RLock()
+	defer tldb.mu.RUnlock()
+	return tldb.calibrations[sensor]
+}
+
+// AddCalibration records a new calibration for sensor.  Readings taken from
+// cal.Effective onwards are corrected with it; earlier ones keep whatever
+// calibration was in effect when they were taken.
+func (tldb TLDB) AddCalibration(sensor string, cal types.Calibration) (err error) {
+	if !tldb.HasTable(sensor) {
+		err = fmt.Errorf("AddCalibration: Unknown sensor: %s", sensor)
+		return
+	}
+	if cal.Metric != types.MetricTemp && cal.Metric != types.MetricHumidity {
+		err = fmt.Errorf("AddCalibration: Unknown metric: %s", cal.Metric)
+		return
+	}
+	if cal.Scale == 0 {
+		err = fmt.Errorf("AddCalibration: Scale must not be zero")
+		return
+	}
+	sqlStmt := "insert into tlcalibration(sensor, metric, cal_offset, cal_scale, effective) values(?, ?, ?, ?, ?)"
+	_, err = tldb.DB.Exec(sqlStmt, sensor, cal.Metric, cal.Offset, cal.Scale, cal.Effective.Unix())
+	if err != nil {
+		err = fmt.Errorf("AddCalibration: Error inserting calibration for %s: %w", sensor, err)
+		return
+	}
+	cal.Effective = time.Unix(cal.Effective.Unix(), 0)
+
+	tldb.mu.Lock()
+	defer tldb.mu.Unlock()
+	cals := append([]types.Calibration{}, tldb.calibrations[sensor]...)
+	cals = append(cals, cal)
+	types.SortCalibrations(cals)
+	tldb.calibrations[sensor] = cals
+	return
+}
+
+// SensorInfo returns the registry entries of every sensor table in display
+// order.  Sensors without a sort order keep the order they were created in.
+func (tldb TLDB) SensorInfo() (sensors []types.SensorCfg, err error) {
+	rows, err := tldb.DB.Query("select name, coalesce(site, ''), coalesce(display_name, ''), coalesce(location, ''), coalesce(install_date, ''), coalesce(hardware, ''), coalesce(color, ''), coalesce(sort_order, id), coalesce(expected_interval, 0), coalesce(stale_after, 0) from tltables order by coalesce(sort_order, id), id")
+	if err != nil {
+		err = fmt.Errorf("SensorInfo: Error querying tltables: %w", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var sensor types.SensorCfg
+		err = rows.Scan(&sensor.ID, &sensor.Site, &sensor.Name, &sensor.Location, &sensor.InstallDate,
+			&sensor.Hardware, &sensor.Color, &sensor.Order, &sensor.IntervalSeconds, &sensor.StaleAfterMinutes)
+		if err != nil {
+			err = fmt.Errorf("SensorInfo: Error reading query of tltables: %w", err)
+			return
+		}
+		sensor.Calibrations = tldb.Calibrations(sensor.ID)
+		sensors = append(sensors, sensor)
+	}
+	if err = rows.Err(); err != nil {
+		err = fmt.Errorf("SensorInfo: General error reading query of tltables: %w", err)
+		return
+	}
+	return
+}
+
+// UpdateSensor replaces the registry metadata of sensor.ID.  An empty site
+// keeps the current one.  Calibrations are not changed; use AddCalibration.
+func (tldb TLDB) UpdateSensor(sensor types.SensorCfg) (err error) {
+	if !tldb.HasTable(sensor.ID) {
+		err = fmt.Errorf("UpdateSensor: Unknown sensor: %s", sensor.ID)
+		return
+	}
+	sqlStmt := "update tltables set site=coalesce(nullif(?, ''), site), display_name=?, location=?, install_date=?, hardware=?, color=?, sort_order=?, expected_interval=?, stale_after=? where name=?"
+	_, err = tldb.DB.Exec(sqlStmt, sensor.Site, sensor.Name, sensor.Location, sensor.InstallDate,
+		sensor.Hardware, sensor.Color, sensor.Order, sensor.IntervalSeconds, sensor.StaleAfterMinutes, sensor.ID)
+	if err != nil {
+		err = fmt.Errorf("UpdateSensor: Error updating %s: %w", sensor.ID, err)
+		return
+	}
+	return
+}
+
+// SetSite records the site of sensor.
+func (tldb TLDB) SetSite(sensor string, site string) (err error) {
+	if _, err = tldb.DB.Exec("update tltables set site=? where name=?", site, sensor); err != nil {
+		err = fmt.Errorf("SetSite: Error updating %s: %w", sensor, err)
+	}
+	return
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestCalibration(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	begin := time.Unix(1705298580, 0)
+	end := time.Unix(1705300900, 0)
+	raw, err := tldb.RetrieveRecords("sensor1", begin, end)
+	if err != nil {
+		t.Fatalf("Could not read records: %s", err.Error())
+	}
+	// Correct the temperature from the tenth record onwards
+	effective, _ := time.Parse(time.RFC3339, raw[10].TimeStamp)
+	err = tldb.AddCalibration("sensor1", types.Calibration{Metric: "temp", Offset: -1, Scale: 1, Effective: effective})
+	if err != nil {
+		t.Fatalf("Could not add calibration: %s", err.Error())
+	}
+	err = tldb.AddCalibration("sensor1", types.Calibration{Metric: "pressure", Scale: 1})
+	if err == nil {
+		t.Error("Expected an error for an unknown metric")
+	}
+
+	// Reopen the database to check the calibration was stored
+	tldb.Close()
+	tldb, err = NewDB(testDbPath)
+	if err != nil {
+		t.Fatalf("Could not reopen %s: %s", testDbPath, err.Error())
+	}
+	calibrated, err := tldb.RetrieveRecords("sensor1", begin, end)
+	if err != nil {
+		t.Fatalf("Could not read records: %s", err.Error())
+	}
+	for i := range raw {
+		diff := raw[i].TempC - calibrated[i].TempC
+		expected := float32(0)
+		if i >= 10 {
+			expected = 1
+		}
+		if diff < expected-0.001 || diff > expected+0.001 {
+			t.Errorf("Record %d: Expected a correction of %g, Actual %g", i, expected, diff)
+		}
+		if calibrated[i].Humidity != raw[i].Humidity {
+			t.Errorf("Record %d: Humidity should not change", i)
+		}
+		// The heat index follows the corrected temperature
+		hiF, hiC := raw[i].HeatIndexF, raw[i].HeatIndexC
+		if i >= 10 {
+			hi := types.HeatIndexF(float64(calibrated[i].TempF), float64(calibrated[i].Humidity))
+			hiF, hiC = float32(hi), float32((hi-32)*5/9)
+		}
+		if calibrated[i].HeatIndexF != hiF || calibrated[i].HeatIndexC != hiC {
+			t.Errorf("Record %d: Expected a heat index of %gF %gC, Actual %gF %gC", i, hiF, hiC, calibrated[i].HeatIndexF, calibrated[i].HeatIndexC)
+		}
+	}
+}
+
+func TestAPISensorRegistry(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	body := `{"name": "Crawlspace", "location": "Under the kitchen", "installDate": "2023-11-04", "hardware": "DHT22", "color": "#00ff00", "order": 3}`
+	w := httptest.NewRecorder()
+	tlWeb.APISensor(w, httptest.NewRequest("PUT", "/api/v1/sensors/sensor1", strings.NewReader(body)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.APISensor(w, httptest.NewRequest("POST", "/api/v1/sensors/sensor1/calibrations", strings.NewReader(`{"metric": "humidity", "offset": 2.5}`)))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("Unexpected status: %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.APISensor(w, httptest.NewRequest("GET", "/api/v1/sensors/sensor1", nil))
+	var sensor types.SensorCfg
+	if err := json.Unmarshal(w.Body.Bytes(), &sensor); err != nil {
+		t.Fatalf("Could not parse response: %s", err.Error())
+	}
+	if sensor.Name != "Crawlspace" || sensor.Hardware != "DHT22" || sensor.InstallDate != "2023-11-04" {
+		t.Errorf("Registry entry not updated: %+v", sensor)
+	}
+	if len(sensor.Calibrations) != 1 || sensor.Calibrations[0].Scale != 1 {
+		t.Errorf("Unexpected calibrations: %+v", sensor.Calibrations)
+	}
+
+	for _, bad := range []struct{ method, url, body string }{
+		{"PUT", "/api/v1/sensors/sensor1", `{"color": "green"}`},
+		{"PUT", "/api/v1/sensors/sensor1", `{"installDate": "Nov 4"}`},
+		{"POST", "/api/v1/sensors/sensor1/calibrations", `{"metric": "temp", "scale": 0}`},
+		{"GET", "/api/v1/sensors/nosuchsensor", ""},
+		{"DELETE", "/api/v1/sensors/sensor1", ""},
+	} {
+		w = httptest.NewRecorder()
+		tlWeb.APISensor(w, httptest.NewRequest(bad.method, bad.url, strings.NewReader(bad.body)))
+		if w.Code < 400 {
+			t.Errorf("%s %s %s: Expected an error, got %d", bad.method, bad.url, bad.body, w.Code)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"tempLogger/types"
+	"time"
+)
+
+// retentionInterval is how often readings past their retention are deleted.
+const retentionInterval = 6 * time.Hour
+
+// DeleteBefore removes the readings of tableName from before.  Only
+// registered sensor tables hold readings, so any other table is refused.
+func (tldb TLDB) DeleteBefore(tableName string, before time.Time) (deleted int64, err error) {
+	if !tldb.HasTable(tableName) || types.ReservedName(tableName) {
+		err = fmt.Errorf("DeleteBefore: Not a sensor table: %s", tableName)
+		return
+	}
+	defer observeQuery("delete", time.Now())
+	res, err := tldb.DB.Exec(fmt.Sprintf("delete from %s where id < ?", tableName), before.Unix())
+	if err != nil {
+		err = fmt.Errorf("DeleteBefore: Error deleting from %s: %w", tableName, err)
+		return
+	}
+	deleted, err = res.RowsAffected()
+	if err != nil {
+		err = fmt.Errorf("DeleteBefore: %w", err)
+	}
+	return
+}
+
+// retentionDays returns how many days of readings of sensor are kept, zero
+// for all of them.
+func retentionDays(cfg types.RetentionCfg, sensor string) int {
+	if days, ok := cfg.Sensors[sensor]; ok {
+		return days
+	}
+	return cfg.Days
+}
+
+// pruneReadings deletes the readings older than the retention of each
+// registered sensor table.  A sensor that cannot be pruned is logged and
+// skipped, and the errors of all of them are returned together.
+func pruneReadings(tldb TLDB, cfg types.RetentionCfg, now time.Time) (deleted int64, err error) {
+	for _, sensor := range tldb.Sensors() {
+		days := retentionDays(cfg, sensor)
+		if days == 0 {
+			continue
+		}
+		n, derr := tldb.DeleteBefore(sensor, now.AddDate(0, 0, -days))
+		if derr != nil {
+			log.Println("pruneReadings:", derr.Error())
+			err = errors.Join(err, fmt.Errorf("pruneReadings: %w", derr))
+			continue
+		}
+		recordsPruned.Add(float64(n), sensor)
+		deleted += n
+	}
+	return
+}
+
+// runRetention prunes the readings now and every interval after.
+func runRetention(tldb TLDB, cfg types.RetentionCfg, interval time.Duration) {
+	for {
+		// pruneReadings logs the sensors it could not prune
+		deleted, _ := pruneReadings(tldb, cfg, time.Now())
+		if deleted > 0 {
+			log.Println("runRetention: Deleted", deleted, "old records.")
+		}
+		time.Sleep(interval)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"tempLogger/types"
+	"time"
+)
+
+// sensorPalette gives sensors without a configured color a distinct one.
+var sensorPalette = []string{
+	"#6794dc", "#ffa500", "#ff0000", "#2ca02c", "#9467bd", "#8c564b", "#e377c2", "#17becf",
+}
+
+var sensorColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// LoadSensorCfg reads the list of sensor definitions from a JSON file.
+func LoadSensorCfg(cfgPath string) (sensors []types.SensorCfg, err error) {
+	cfgFile, err := os.Open(cfgPath)
+	if err != nil {
+		err = fmt.Errorf("LoadSensorCfg: Could not open file %s: %w", cfgPath, err)
+		return
+	}
+	defer cfgFile.Close()
+	cfgBytes, err := io.ReadAll(cfgFile)
+	if err != nil {
+		err = fmt.Errorf("LoadSensorCfg: Could not read file %s: %w", cfgPath, err)
+		return
+	}
+	err = json.Unmarshal(cfgBytes, &sensors)
+	if err != nil {
+		err = fmt.Errorf("LoadSensorCfg: Could not parse file %s: %w", cfgPath, err)
+		return
+	}
+	seen := make(map[string]bool, len(sensors))
+	for _, sensor := range sensors {
+		if seen[sensor.ID] {
+			err = fmt.Errorf("LoadSensorCfg: %s: Duplicate sensor id %s", cfgPath, sensor.ID)
+			return
+		}
+		seen[sensor.ID] = true
+		if err = validateSensorCfg(sensor); err != nil {
+			err = fmt.Errorf("LoadSensorCfg: %s: %w", cfgPath, err)
+			return
+		}
+	}
+	return
+}
+
+// validateSensorCfg checks the fields of a sensor definition that have a
+// required format.
+func validateSensorCfg(sensor types.SensorCfg) error {
+	if sensor.ID == "" {
+		return fmt.Errorf("Sensor with no id")
+	}
+	if !types.ValidSensorKey(sensor.ID) {
+		return fmt.Errorf("Sensor id must be letters, digits and underscores, after its site and __ if it has one, and not a reserved name: %s", sensor.ID)
+	}
+	if sensor.Site != "" && !types.ValidSite(sensor.Site) {
+		return fmt.Errorf("Sensor %s site must be letters, digits and single underscores: %s", sensor.ID, sensor.Site)
+	}
+	if sensor.Color != "" && !sensorColor.MatchString(sensor.Color) {
+		return fmt.Errorf("Sensor %s color must be #rrggbb: %s", sensor.ID, sensor.Color)
+	}
+	if sensor.IntervalSeconds < 0 || sensor.StaleAfterMinutes < 0 {
+		return fmt.Errorf("Sensor %s interval and stale time must not be negative", sensor.ID)
+	}
+	if sensor.InstallDate != "" {
+		if _, err := time.Parse("2006-01-02", sensor.InstallDate); err != nil {
+			return fmt.Errorf("Sensor %s install date must be YYYY-MM-DD: %s", sensor.ID, sensor.InstallDate)
+		}
+	}
+	return nil
+}
+
+// SensorList returns the sensors in the registry, with any fields set in the
+// sensor config file taking precedence, followed by configured sensors that
+// have no table yet.  They are grouped by site, in display order within
+// each, with every field filled in.
+func (tlweb TLWeb) SensorList() (sensors []types.SensorCfg) {
+	sensors, err := tlweb.Tldb.SensorInfo()
+	if err != nil {
+		log.Println("SensorList:", err.Error())
+	}
+	index := make(map[string]int, len(sensors))
+	for i, sensor := range sensors {
+		index[sensor.ID] = i
+	}
+	for _, cfg := range tlweb.SensorCfg {
+		i, ok := index[cfg.ID]
+		if !ok {
+			sensors = append(sensors, cfg)
+			continue
+		}
+		sensor := &sensors[i]
+		sensor.Order = cfg.Order
+		if cfg.IntervalSeconds != 0 {
+			sensor.IntervalSeconds = cfg.IntervalSeconds
+		}
+		if cfg.StaleAfterMinutes != 0 {
+			sensor.StaleAfterMinutes = cfg.StaleAfterMinutes
+		}
+		for _, field := range []struct{ dst, src *string }{
+			{&sensor.Site, &cfg.Site},
+			{&sensor.Name, &cfg.Name},
+			{&sensor.Location, &cfg.Location},
+			{&sensor.Color, &cfg.Color},
+			{&sensor.InstallDate, &cfg.InstallDate},
+			{&sensor.Hardware, &cfg.Hardware},
+		} {
+			if *field.src != "" {
+				*field.dst = *field.src
+			}
+		}
+	}
+	sort.SliceStable(sensors, func(i, j int) bool {
+		if sensors[i].Site != sensors[j].Site {
+			return sensors[i].Site < sensors[j].Site
+		}
+		return sensors[i].Order < sensors[j].Order
+	})
+	for i := range sensors {
+		if sensors[i].Name == "" {
+			sensors[i].Name = types.SensorName(sensors[i].Site, sensors[i].ID)
+		}
+		if sensors[i].Color == "" {
+			sensors[i].Color = sensorPalette[i%len(sensorPalette)]
+		}
+	}
+	return
+}
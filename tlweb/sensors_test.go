@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLoadSensorCfg(t *testing.T) {
+	sensors, err := LoadSensorCfg("sensors.json")
+	if err != nil {
+		t.Fatalf("Could not load sensors.json: %s", err.Error())
+	}
+	if len(sensors) != 3 {
+		t.Errorf("Incorrect number of sensors: Expected %d, Actual %d", 3, len(sensors))
+	}
+
+	badPath := "test/bad-sensors.json"
+	for _, bad := range []string{
+		`[{"name": "No ID"}]`,
+		`[{"id": "a"}, {"id": "a"}]`,
+		`[{"id": "a", "color": "red"}]`,
+	} {
+		if err = os.WriteFile(badPath, []byte(bad), 0644); err != nil {
+			t.Fatalf("Could not write %s: %s", badPath, err.Error())
+		}
+		if _, err = LoadSensorCfg(badPath); err == nil {
+			t.Errorf("Expected an error for %s", bad)
+		}
+	}
+	os.Remove(badPath)
+}
+
+func TestSensorList(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	sensors, err := LoadSensorCfg("sensors.json")
+	if err != nil {
+		t.Fatalf("Could not load sensors.json: %s", err.Error())
+	}
+	// Put sensor1 last and add one with no data
+	sensors[1].Order = 10
+	sensors = append(sensors, sensors[0])
+	sensors[3].ID = "attic"
+	sensors[3].Name = ""
+	sensors[3].Color = ""
+	sensors[3].Order = 5
+	tlWeb := TLWeb{Tldb: tldb, SensorCfg: sensors}
+
+	var ids []string
+	for _, sensor := range tlWeb.SensorList() {
+		ids = append(ids, sensor.ID)
+		if sensor.Name == "" || sensor.Color == "" {
+			t.Errorf("Sensor %s was not given defaults", sensor.ID)
+		}
+	}
+	if strings.Join(ids, ",") != "outside,sensor2,attic,sensor1" {
+		t.Errorf("Unexpected sensor order: %v", ids)
+	}
+
+	w := httptest.NewRecorder()
+	tlWeb.ShowRange(w, httptest.NewRequest("GET", "/?from=2024-01-13&to=2024-01-16", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Unexpected status: %d", w.Code)
+	}
+	body := w.Body.String()
+	for _, want := range []string{"North wall", "color: #ffa500", "No data"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Page is missing %q", want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"tempLogger/types"
+	"time"
+)
+
+// siteNames returns the sites of sensors, which are grouped by site, in
+// order.  Sensors without a site are not counted.
+func siteNames(sensors []types.SensorCfg) (sites []string) {
+	for _, sensor := range sensors {
+		if sensor.Site != "" && !slices.Contains(sites, sensor.Site) {
+			sites = append(sites, sensor.Site)
+		}
+	}
+	return
+}
+
+// filterSite returns the sensors at site, or all of them if site is empty.
+func filterSite(sensors []types.SensorCfg, site string) []types.SensorCfg {
+	if site == "" {
+		return sensors
+	}
+	var filtered []types.SensorCfg
+	for _, sensor := range sensors {
+		if sensor.Site == site {
+			filtered = append(filtered, sensor)
+		}
+	}
+	return filtered
+}
+
+// requestSite returns the site query parameter of req, which must be one of
+// the sites of sensors if it is set.
+func requestSite(req *http.Request, sensors []types.SensorCfg) (site string, err error) {
+	site = req.URL.Query().Get("site")
+	if site != "" && !slices.Contains(siteNames(sensors), site) {
+		err = fmt.Errorf("Unknown site: %s", site)
+	}
+	return
+}
+
+// SitesPage gathers the newest reading of every sensor, by site, with
+// temperatures in unit.
+func (tlweb TLWeb) SitesPage(unit string, now time.Time) (sitesPage types.SitesPage, err error) {
+	sitesPage.Unit = unit
+	sitesPage.Units = types.Units
+	sitesPage.Sites = []types.SiteOverview{}
+	for _, sensor := range tlweb.SensorList() {
+		if !tlweb.Tldb.HasTable(sensor.ID) {
+			continue
+		}
+		if n := len(sitesPage.Sites); n == 0 || sitesPage.Sites[n-1].Site != sensor.Site {
+			sitesPage.Sites = append(sitesPage.Sites, types.SiteOverview{Site: sensor.Site})
+		}
+		overview := &sitesPage.Sites[len(sitesPage.Sites)-1]
+		siteSensor := types.SiteSensor{
+			ID:        sensor.ID,
+			Name:      sensor.Name,
+			Location:  sensor.Location,
+			Color:     sensor.Color,
+			Freshness: tlweb.Tldb.SensorFreshness(sensor, now),
+		}
+		thd, found, lerr := tlweb.Tldb.LatestRecord(sensor.ID)
+		if lerr != nil {
+			err = fmt.Errorf("SitesPage: %w", lerr)
+			return
+		}
+		if found {
+			thd.Site = sensor.Site
+			siteSensor.Latest = &thd
+			siteSensor.Temp = types.TempIn(thd.TempC, thd.TempF, unit)
+		}
+		if siteSensor.Freshness.Stale {
+			overview.Stale++
+		}
+		overview.Sensors = append(overview.Sensors, siteSensor)
+	}
+	return
+}
+
+// ShowSites renders the latest readings of every location.
+func (tlweb TLWeb) ShowSites(w http.ResponseWriter, req *http.Request) {
+	unit, err := tlweb.RequestUnits(w, req)
+	if err != nil {
+		tlweb.templates().Error(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	sitesPage, err := tlweb.SitesPage(unit, time.Now())
+	if err != nil {
+		log.Println("ShowSites:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusInternalServerError, "The latest readings could not be read.")
+		return
+	}
+	tlweb.templates().Render(w, req, http.StatusOK, "sites", sitesPage)
+}
+
+// APISites handles GET /api/v1/sites?units=
+func (tlweb TLWeb) APISites(w http.ResponseWriter, req *http.Request) {
+	unit, err := tlweb.RequestUnits(w, req)
+	if err != nil {
+		writeAPIError(w, req, http.StatusBadRequest, err.Error())
+		return
+	}
+	sitesPage, err := tlweb.SitesPage(unit, time.Now())
+	if err != nil {
+		log.Println("APISites:", err.Error())
+		writeAPIError(w, req, http.StatusInternalServerError, "Error retrieving readings")
+		return
+	}
+	writeJSON(w, req, http.StatusOK, sitesPage.Sites)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"tempLogger/types"
+	"testing"
+)
+
+func TestSites(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	// The cabin has a sensor1 too, which is kept apart from the one
+	// without a site
+	before, _ := tldb.RecordCount("sensor1")
+	result, err := tldb.ImportRecords([]types.THData{
+		{ID: "sensor1", Site: "cabin", TimeStamp: "2024-01-15T00:00:04-07:00", TempC: -10, TempF: 14},
+		{ID: "sensor1", Site: "cabin", TimeStamp: "2024-01-15T00:02:04-07:00", TempC: -10.5, TempF: 13.1},
+		{ID: "sensor1", Site: "two__parts", TimeStamp: "2024-01-15T00:02:04-07:00"},
+	})
+	if err != nil {
+		t.Fatalf("ImportRecords: %s", err.Error())
+	}
+	if len(result.Inserted) != 2 || result.Inserted[0].ID != "cabin__sensor1" || result.ParseErrors != 1 {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+	if after, _ := tldb.RecordCount("sensor1"); after != before {
+		t.Errorf("Readings of the cabin went into sensor1: %d then %d", before, after)
+	}
+
+	tlWeb := TLWeb{Tldb: tldb}
+	sensors := tlWeb.SensorList()
+	if len(sensors) != 2 || sensors[1].Site != "cabin" || sensors[1].Name != "sensor1" {
+		t.Errorf("Unexpected sensors: %+v", sensors)
+	}
+	if sites := siteNames(sensors); len(sites) != 1 || sites[0] != "cabin" {
+		t.Errorf("Unexpected sites: %v", sites)
+	}
+
+	w := httptest.NewRecorder()
+	tlWeb.APILatest(w, httptest.NewRequest("GET", "/api/v1/latest?site=cabin", nil))
+	var latest []types.THData
+	json.Unmarshal(w.Body.Bytes(), &latest)
+	if len(latest) != 1 || latest[0].Site != "cabin" || latest[0].TempF != 13.1 {
+		t.Errorf("Unexpected latest readings: %d %+v", w.Code, latest)
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.APISites(w, httptest.NewRequest("GET", "/api/v1/sites?units=C", nil))
+	var sites []types.SiteOverview
+	json.Unmarshal(w.Body.Bytes(), &sites)
+	if len(sites) != 2 || sites[0].Site != "" || sites[1].Site != "cabin" || sites[1].Sensors[0].Temp != -10.5 {
+		t.Errorf("Unexpected sites: %d %+v", w.Code, sites)
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.ShowSites(w, httptest.NewRequest("GET", "/sites", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `href="/?site=cabin"`) {
+		t.Errorf("Unexpected sites page: %d: %s", w.Code, w.Body.String())
+	}
+	w = httptest.NewRecorder()
+	tlWeb.ShowRange(w, httptest.NewRequest("GET", "/?range=7d&site=cabin", nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `name="site" value="cabin"`) {
+		t.Errorf("Unexpected range page: %d", w.Code)
+	}
+}
+
+func TestIngestSiteToken(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	token, _, err := tldb.AddToken("cabin logger", types.RoleIngest, "cabin")
+	if err != nil {
+		t.Fatalf("AddToken: %s", err.Error())
+	}
+	if _, _, err = tldb.AddToken("bad", types.RoleIngest, "two__parts"); err == nil {
+		t.Error("Expected an invalid site to fail")
+	}
+	tlWeb := TLWeb{Tldb: tldb, AuthRequired: true}
+	req := httptest.NewRequest("POST", types.IngestPath, strings.NewReader(strings.Join([]string{
+		`{"id":"sensor1","timestamp":"2024-01-15T00:00:04-07:00","tempF":14}`,
+		`{"id":"sensor1","site":"home","timestamp":"2024-01-15T00:02:04-07:00","tempF":60}`,
+	}, "\n")))
+	req.Header.Set("Authorization", "Bearer "+token)
+	w := httptest.NewRecorder()
+	tlWeb.Authorize(types.RoleIngest, tlWeb.Ingest)(w, req)
+	var result types.IngestResult
+	json.Unmarshal(w.Body.Bytes(), &result)
+	if result.Acked != 2 || result.Inserted != 1 || result.Rejected != 1 {
+		t.Errorf("Unexpected result: %d %+v", w.Code, result)
+	}
+	if !tldb.HasTable("cabin__sensor1") || tldb.HasTable("home__sensor1") {
+		t.Errorf("Unexpected tables: %v", tldb.Sensors())
+	}
+}
+
+func TestWatchSite(t *testing.T) {
+	watch := []types.WatchCfg{{Path: "logs"}, {Path: "cabin", Site: "cabin"}}
+	for file, site := range map[string]string{
+		filepath.Join("cabin", "tempLogger-20240114.log"):         "cabin",
+		filepath.Join("cabin", "2024", "tempLogger-20240114.log"): "cabin",
+		filepath.Join("logs", "tempLogger-20240114.log"):          "",
+		filepath.Join("cabin-old", "tempLogger-20240114.log"):     "",
+	} {
+		if got := watchSite(watch, file); got != site {
+			t.Errorf("%s: Expected site %q, got %q", file, site, got)
+		}
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"io"
 	"log"
 	"os"
+	"sort"
+	"sync"
 	"tempLogger/types"
 	"time"
 
@@ -20,6 +22,12 @@ const defaultDbPath = "./tempLogger.db"
 type TLDB struct {
 	DB     *sql.DB
 	Tables map[string]bool
+	// calibrations caches the tlcalibration table by sensor, sorted by
+	// effective time.
+	calibrations map[string][]types.Calibration
+	// mu guards Tables and calibrations, which are updated by the watcher
+	// and the API while the web handlers read them.
+	mu *sync.RWMutex
 }
 
 func NewDB(dbPath string) (tldb TLDB, err error) {
@@ -37,6 +45,28 @@ func NewDB(dbPath string) (tldb TLDB, err error) {
 	}
 
 	tldb.Tables = make(map[string]bool, 1)
+	tldb.calibrations = make(map[string][]types.Calibration)
+	tldb.mu = &sync.RWMutex{}
+	err = tldb.migrateRegistry()
+	if err != nil {
+		err = fmt.Errorf("NewDB: %w", err)
+		return
+	}
+	err = tldb.migrateAlerts()
+	if err != nil {
+		err = fmt.Errorf("NewDB: %w", err)
+		return
+	}
+	err = tldb.migrateAuth()
+	if err != nil {
+		err = fmt.Errorf("NewDB: %w", err)
+		return
+	}
+	err = tldb.loadCalibrations()
+	if err != nil {
+		err = fmt.Errorf("NewDB: %w", err)
+		return
+	}
 	rows, err := tldb.DB.Query("select id, name from tltables")
 	if err != nil {
 		err = fmt.Errorf("NewDB: Error querying tltables: %w", err)
@@ -51,6 +81,12 @@ func NewDB(dbPath string) (tldb TLDB, err error) {
 			err = fmt.Errorf("NewDB: Error reading query of tltables: %w", err)
 			return
 		}
+		if types.ReservedName(name) {
+			// Registered by an import before reserved names were refused;
+			// the table is not a sensor's, so its rows are never touched
+			log.Println("NewDB: Ignoring reserved table in tltables:", name)
+			continue
+		}
 		tldb.Tables[name] = true
 	}
 	err = rows.Err()
@@ -62,8 +98,13 @@ func NewDB(dbPath string) (tldb TLDB, err error) {
 }
 
 // NewTable will create a new table with the name tableName and updates the
-// Tables field to
+// Tables field to include it.  Reserved names, such as those of the tables
+// tlweb keeps for itself, are refused.
 func (tldb *TLDB) NewTable(tableName string) (err error) {
+	if types.ReservedName(tableName) {
+		err = fmt.Errorf("NewTable: Reserved table name: %s", tableName)
+		return
+	}
 	sqlStmt := fmt.Sprint("create table if not exists ", tableName, " (id integer not null primary key, humidity float, tempc float, tempf float, hiC float, hiF float)")
 	_, err = tldb.DB.Exec(sqlStmt)
 	if err != nil {
@@ -71,10 +112,12 @@ func (tldb *TLDB) NewTable(tableName string) (err error) {
 		return
 	}
 
+	tldb.mu.Lock()
+	defer tldb.mu.Unlock()
 	tldb.Tables[tableName] = true
-	id := len(tldb.Tables)
-	sqlStmt = "insert into tltables(id, name) values(?, ?)"
-	_, err = tldb.DB.Exec(sqlStmt, id, tableName)
+	// Tables skips reserved rows of tltables, so the id follows the rows
+	sqlStmt = "insert into tltables(id, name) values((select coalesce(max(id), 0) + 1 from tltables), ?)"
+	_, err = tldb.DB.Exec(sqlStmt, tableName)
 	if err != nil {
 		err = fmt.Errorf("NewTable: Error inserting %s into tltables: %w", tableName, err)
 		// The insertion didn't work, so delete the entry from the map
@@ -85,16 +128,39 @@ func (tldb *TLDB) NewTable(tableName string) (err error) {
 	return
 }
 
+// ImportResult describes the outcome of loading a log file.
+type ImportResult struct {
+	// Inserted holds the records that were new to the database.
+	Inserted    []types.THData
+	Duplicates  int
+	ParseErrors int
+	// Rejected holds the indexes of the records that could not be stored.
+	Rejected []int
+}
+
 func (tldb TLDB) InsertLog(fileName string) (err error) {
+	_, err = tldb.ImportLog(fileName)
+	return
+}
+
+// ImportLog loads a tempLogger file, skipping records that are already in
+// the database.
+func (tldb TLDB) ImportLog(fileName string) (result ImportResult, err error) {
+	return tldb.ImportSiteLog(fileName, "")
+}
+
+// ImportSiteLog loads a tempLogger file like ImportLog, with the records
+// that do not name a site taken to be at site.
+func (tldb TLDB) ImportSiteLog(fileName string, site string) (result ImportResult, err error) {
 	logFile, err := os.Open(fileName)
 	if err != nil {
-		err = fmt.Errorf("InsertLog: Error opening tempLogger file %s: %w",
+		err = fmt.Errorf("ImportLog: Error opening tempLogger file %s: %w",
 			fileName, err)
 		return
 	}
 	logData, err := io.ReadAll(logFile)
 	if err != nil {
-		err = fmt.Errorf("InsertLog: Error reading tempLogger file %s: %w",
+		err = fmt.Errorf("ImportLog: Error reading tempLogger file %s: %w",
 			fileName, err)
 		return
 	}
@@ -107,43 +173,97 @@ func (tldb TLDB) InsertLog(fileName string) (err error) {
 		line := scanner.Bytes()
 		err = json.Unmarshal(line, &tlData)
 		if err != nil {
-			log.Println("InsertLog: Error parsing line:", string(line))
+			log.Println("ImportLog: Error parsing line:", string(line))
+			result.ParseErrors++
+			parseErrors.Inc()
 			continue
 		}
+		if tlData.Site == "" {
+			tlData.Site = site
+		}
 		tlDataList = append(tlDataList, tlData)
 	}
 	if err = scanner.Err(); err != nil {
-		log.Printf("InsertLog: Error parsing tempLogger file %s: %s\n",
+		log.Printf("ImportLog: Error parsing tempLogger file %s: %s\n",
 			fileName, err.Error())
 	}
-	if len(tlDataList) > 0 {
-		if _, ok := tldb.Tables[tlDataList[0].ID]; !ok {
-			err = tldb.NewTable(tlDataList[0].ID)
+	imported, ierr := tldb.ImportRecords(tlDataList)
+	imported.ParseErrors += result.ParseErrors
+	result = imported
+	if ierr != nil {
+		err = fmt.Errorf("ImportLog: %w", ierr)
+	}
+	return
+}
+
+// ImportRecords stores tlDataList, skipping records that are already in the
+// database.  Records at a site go in the table of their key, and the
+// inserted ones are returned with ID set to it.  An error creating a table
+// stops it, with the records before stored.
+func (tldb TLDB) ImportRecords(tlDataList []types.THData) (result ImportResult, err error) {
+	for i, val := range tlDataList {
+		// Files named by pattern and loggers sending readings may hold
+		// several sensors, so each record gets its own table
+		if !types.ValidSensorID(val.ID) || (val.Site != "" && !types.ValidSite(val.Site)) ||
+			types.ReservedName(types.SensorKey(val.Site, val.ID)) {
+			log.Println("ImportRecords: Invalid sensor id:", types.SensorKey(val.Site, val.ID))
+			result.ParseErrors++
+			result.Rejected = append(result.Rejected, i)
+			parseErrors.Inc()
+			continue
+		}
+		val.ID = types.SensorKey(val.Site, val.ID)
+		if !tldb.HasTable(val.ID) {
+			err = tldb.NewTable(val.ID)
 			if err != nil {
-				err = fmt.Errorf("InsertLog: Error creating table: %w", err)
+				err = fmt.Errorf("ImportRecords: Error creating table: %w", err)
 				return
 			}
-		}
-		for _, val := range tlDataList {
-			if err = tldb.InsertRecord(val); err != nil {
-				log.Println("InsertLog:", err.Error())
+			if val.Site != "" {
+				if err = tldb.SetSite(val.ID, val.Site); err != nil {
+					err = fmt.Errorf("ImportRecords: %w", err)
+					return
+				}
 			}
 		}
+		inserted, ierr := tldb.insertRecord(&val)
+		if ierr != nil {
+			log.Println("ImportRecords:", ierr.Error())
+			result.ParseErrors++
+			result.Rejected = append(result.Rejected, i)
+			parseErrors.Inc()
+			continue
+		}
+		if inserted {
+			result.Inserted = append(result.Inserted, val)
+			recordsInserted.Inc(val.ID)
+		} else {
+			result.Duplicates++
+			recordsDuplicate.Inc(val.ID)
+		}
 	}
 	return
 }
 
 func (tldb TLDB) InsertRecord(thd types.THData) (err error) {
+	_, err = tldb.insertRecord(&thd)
+	return
+}
+
+// insertRecord stores thd unless a record with the same timestamp exists,
+// filling in the heat index if the device did not report it.
+func (tldb TLDB) insertRecord(thd *types.THData) (inserted bool, err error) {
+	defer observeQuery("insert", time.Now())
 	ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
 	if err != nil {
-		err = fmt.Errorf("InsertRecord: Error parsing timestamp: %s: %w",
+		err = fmt.Errorf("insertRecord: Error parsing timestamp: %s: %w",
 			thd.TimeStamp, err)
 		return
 	}
 	qStr := fmt.Sprintf("select id from %s where id=?", thd.ID)
 	rows, err := tldb.DB.Query(qStr, ts.Unix())
 	if err != nil {
-		err = fmt.Errorf("InsertRecord: Problem with query: %w", err)
+		err = fmt.Errorf("insertRecord: Problem with query: %w", err)
 		return
 	}
 	defer rows.Close()
@@ -154,13 +274,13 @@ func (tldb TLDB) InsertRecord(thd types.THData) (err error) {
 		var id int64
 		err = rows.Scan(&id)
 		if err != nil {
-			err = fmt.Errorf("InsertRecord: Problem parsing query results: %w", err)
+			err = fmt.Errorf("insertRecord: Problem parsing query results: %w", err)
 			return
 		}
 		exists = true
 	}
 	if err = rows.Err(); err != nil {
-		err = fmt.Errorf("InsertRecord: Additional query problem: %w", err)
+		err = fmt.Errorf("insertRecord: Additional query problem: %w", err)
 		return
 	}
 	if exists {
@@ -168,12 +288,14 @@ func (tldb TLDB) InsertRecord(thd types.THData) (err error) {
 		return
 	}
 	// Put the record into the database
+	thd.FillHeatIndex()
 	stmtStr := fmt.Sprintf("insert into %s(id, humidity, tempc, tempf, hiC, hiF) values(?, ?, ?, ?, ?, ?)", thd.ID)
 	_, err = tldb.DB.Exec(stmtStr, ts.Unix(), thd.Humidity, thd.TempC, thd.TempF, thd.HeatIndexC, thd.HeatIndexF)
 	if err != nil {
-		err = fmt.Errorf("InsertRecord: Error inserting record into table %s: %w", thd.ID, err)
+		err = fmt.Errorf("insertRecord: Error inserting record into table %s: %w", thd.ID, err)
 		return
 	}
+	inserted = true
 	return
 }
 
@@ -228,43 +350,155 @@ func (tldb TLDB) RecordCountTime(tableName string, begin time.Time, end time.Tim
 }
 
 func (tldb TLDB) RetrieveRecords(tableName string, begin time.Time, end time.Time) (tlList []types.THData, err error) {
+	err = tldb.StreamRecords(tableName, begin, end, func(thd types.THData) error {
+		tlList = append(tlList, thd)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("RetrieveRecords: %w", err)
+		return
+	}
+	return
+}
+
+// StreamRecords calls fn for each record in tableName between begin and end,
+// in time order, without holding the full result set in memory.  Iteration
+// stops at the first error returned by fn.
+func (tldb TLDB) StreamRecords(tableName string, begin time.Time, end time.Time, fn func(types.THData) error) (err error) {
+	err = tldb.streamRecords(tableName, begin, end, 0, fn)
+	if err != nil {
+		err = fmt.Errorf("StreamRecords: %w", err)
+	}
+	return
+}
+
+// RetrieveRecordsLimit returns at most limit records from tableName between
+// begin and end.
+func (tldb TLDB) RetrieveRecordsLimit(tableName string, begin time.Time, end time.Time, limit int) (tlList []types.THData, err error) {
+	err = tldb.streamRecords(tableName, begin, end, limit, func(thd types.THData) error {
+		tlList = append(tlList, thd)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("RetrieveRecordsLimit: %w", err)
+		return
+	}
+	return
+}
+
+// RetrieveAveraged returns the records of tableName between begin and end
+// averaged into buckets of width step, each stamped with the bucket start.
+// A step under one second returns the raw records.
+func (tldb TLDB) RetrieveAveraged(tableName string, begin time.Time, end time.Time, step time.Duration) (tlList []types.THData, err error) {
+	stepU := int64(step / time.Second)
+	if stepU < 1 {
+		return tldb.RetrieveRecords(tableName, begin, end)
+	}
+	queryStr := fmt.Sprintf("select (id / %d) * %d as bucket, avg(humidity), avg(tempc), avg(tempf), avg(hiC), avg(hiF) from %s where (id > %d and id < %d) group by bucket order by bucket",
+		stepU, stepU, tableName, begin.Unix(), end.Unix())
+	err = tldb.scanRecords(tableName, queryStr, func(thd types.THData) error {
+		tlList = append(tlList, thd)
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("RetrieveAveraged: %w", err)
+		return
+	}
+	return
+}
+
+// LatestRecord returns the newest record in tableName.  found is false if
+// the table is empty.
+func (tldb TLDB) LatestRecord(tableName string) (thd types.THData, found bool, err error) {
+	queryStr := fmt.Sprintf("select id, humidity, tempc, tempf, hiC, hiF from %s order by id desc limit 1", tableName)
+	err = tldb.scanRecords(tableName, queryStr, func(rec types.THData) error {
+		thd = rec
+		found = true
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("LatestRecord: %w", err)
+		return
+	}
+	return
+}
+
+// streamRecords is the common implementation of the time range queries.  A
+// limit of zero or less means no limit.
+func (tldb TLDB) streamRecords(tableName string, begin time.Time, end time.Time, limit int, fn func(types.THData) error) (err error) {
 	beginU := begin.Unix()
 	endU := end.Unix()
-	queryStr := fmt.Sprintf("select id, humidity, tempc, tempf, hiC, hiF from %s where (id > %d and id < %d)",
+	queryStr := fmt.Sprintf("select id, humidity, tempc, tempf, hiC, hiF from %s where (id > %d and id < %d) order by id",
 		tableName, beginU, endU)
+	if limit > 0 {
+		queryStr += fmt.Sprintf(" limit %d", limit)
+	}
+	return tldb.scanRecords(tableName, queryStr, fn)
+}
+
+// scanRecords runs queryStr, which must select the record columns in table
+// order, and calls fn for each resulting record after calibrating it.
+func (tldb TLDB) scanRecords(tableName string, queryStr string, fn func(types.THData) error) (err error) {
+	defer observeQuery("read", time.Now())
+	cals := tldb.Calibrations(tableName)
 	rows, err := tldb.DB.Query(queryStr)
 	if err != nil {
-		err = fmt.Errorf("RetrieveRecords: Error querying %s: %w", tableName, err)
+		err = fmt.Errorf("Error querying %s: %w", tableName, err)
 		return
 	}
 	defer rows.Close()
-	// Should only be one result
 	for rows.Next() {
 		var id int64
 		var humidity, tempc, tempf, hiC, hiF float32
 		err = rows.Scan(&id, &humidity, &tempc, &tempf, &hiC, &hiF)
 		if err != nil {
-			err = fmt.Errorf("RetrieveRecords: Error reading count query of %s: %w", tableName, err)
+			err = fmt.Errorf("Error reading query of %s: %w", tableName, err)
+			return
+		}
+		ts := time.Unix(id, 0)
+		thd := types.THData{ID: tableName,
+			TimeStamp:  ts.Format(time.RFC3339),
+			Humidity:   humidity,
+			TempC:      tempc,
+			TempF:      tempf,
+			HeatIndexC: hiC,
+			HeatIndexF: hiF,
+		}
+		if len(cals) > 0 {
+			thd.Calibrate(cals, ts)
+		}
+		err = fn(thd)
+		if err != nil {
 			return
 		}
-		tlList = append(tlList,
-			types.THData{ID: tableName,
-				TimeStamp:  time.Unix(id, 0).Format(time.RFC3339),
-				Humidity:   humidity,
-				TempC:      tempc,
-				TempF:      tempf,
-				HeatIndexC: hiC,
-				HeatIndexF: hiF,
-			})
 	}
 	err = rows.Err()
 	if err != nil {
-		err = fmt.Errorf("RetrieveRecords: General error reading query of tltables: %w", err)
+		err = fmt.Errorf("General error reading query of %s: %w", tableName, err)
 		return
 	}
 	return
 }
 
+// HasTable reports whether tableName is a known sensor table.  Table names
+// are interpolated into queries, so callers must check user input with it.
+func (tldb TLDB) HasTable(tableName string) bool {
+	tldb.mu.RLock()
+	defer tldb.mu.RUnlock()
+	return tldb.Tables[tableName]
+}
+
+// Sensors returns the sorted names of the sensor tables.
+func (tldb TLDB) Sensors() (sensors []string) {
+	tldb.mu.RLock()
+	defer tldb.mu.RUnlock()
+	for key := range tldb.Tables {
+		sensors = append(sensors, key)
+	}
+	sort.Strings(sensors)
+	return
+}
+
 func (tldb *TLDB) Close() {
 	tldb.DB.Close()
 }
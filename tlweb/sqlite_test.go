@@ -1,7 +1,11 @@
 package main
 
 import (
+	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"tempLogger/types"
 	"testing"
 	"time"
 )
@@ -119,3 +123,55 @@ func TestInsertLog2(t *testing.T) {
 		t.Errorf("Incorrect number of records: Expected %d, Actual %d", 702, rowCnt)
 	}
 }
+
+func TestImportMixedLog(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	logPath := filepath.Join(t.TempDir(), "pi-20240115.log")
+	if err := os.WriteFile(logPath, []byte(`{"id":"sensor1","timestamp":"2024-01-15T00:00:04-07:00","humidity":99.9,"tempC":-2.4,"tempF":27.68}
+{"id":"outside","timestamp":"2024-01-15T00:00:05-07:00","humidity":80,"tempC":-10,"tempF":14}
+{"id":"x; drop table sensor1","timestamp":"2024-01-15T00:00:06-07:00","humidity":80,"tempC":-10,"tempF":14}
+`), 0644); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	result, err := tldb.ImportLog(logPath)
+	if err != nil {
+		t.Fatalf("ImportLog: %s", err.Error())
+	}
+	if len(result.Inserted) != 2 || result.ParseErrors != 1 {
+		t.Errorf("Unexpected result: %d inserted, %d errors", len(result.Inserted), result.ParseErrors)
+	}
+	if rowCnt, err := tldb.RecordCount("outside"); err != nil || rowCnt != 1 {
+		t.Errorf("Expected 1 outside record, got %d %v", rowCnt, err)
+	}
+	if rowCnt, _ := tldb.RecordCount("sensor1"); rowCnt != 703 {
+		t.Errorf("Expected 703 sensor1 records, got %d", rowCnt)
+	}
+}
+
+func TestTablesConcurrent(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	// The watcher creates tables while the web handlers look them up
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			tldb.ImportRecords([]types.THData{{ID: fmt.Sprintf("sensor%d", i+2), TimeStamp: "2024-01-15T00:00:04-07:00", TempF: 68}})
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			tldb.HasTable(fmt.Sprintf("sensor%d", i%22))
+			tldb.Sensors()
+		}
+	}()
+	wg.Wait()
+	if len(tldb.Sensors()) != 21 {
+		t.Errorf("Expected 21 sensors, got %v", tldb.Sensors())
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// static holds the stylesheets and scripts of the pages, so they work
+// without internet access.
+//
+//go:embed static
+var static embed.FS
+
+// staticAsset is an embedded file and the ETag of its content.
+type staticAsset struct {
+	name    string
+	content []byte
+	etag    string
+	// immutable is set when the asset was requested by its hashed name,
+	// which changes whenever the content does.
+	immutable bool
+}
+
+// staticAssets maps both the plain and the hashed name of each file to it,
+// and staticPaths maps the plain name to the URL of the hashed name.
+var staticAssets, staticPaths = loadStatic(static)
+
+// loadStatic names each file of fsys after the hash of its content, such as
+// tlchart.0123456789.js for tlchart.js.
+func loadStatic(fsys fs.FS) (assets map[string]staticAsset, paths map[string]string) {
+	assets = make(map[string]staticAsset)
+	paths = make(map[string]string)
+	entries, err := fs.ReadDir(fsys, "static")
+	if err != nil {
+		log.Fatalln("loadStatic: Error reading embedded files:", err.Error())
+	}
+	for _, entry := range entries {
+		content, err := fs.ReadFile(fsys, "static/"+entry.Name())
+		if err != nil {
+			log.Fatalln("loadStatic: Error reading embedded file:", err.Error())
+		}
+		sum := sha256.Sum256(content)
+		hash := fmt.Sprintf("%x", sum[:5])
+		name := entry.Name()
+		ext := path.Ext(name)
+		hashed := strings.TrimSuffix(name, ext) + "." + hash + ext
+		asset := staticAsset{name: name, content: content, etag: `"` + hash + `"`}
+		assets[name] = asset
+		asset.immutable = true
+		assets[hashed] = asset
+		paths[name] = "/static/" + hashed
+	}
+	return
+}
+
+// staticPath returns the URL of an embedded file for the templates.
+func staticPath(name string) string {
+	if p, ok := staticPaths[name]; ok {
+		return p
+	}
+	log.Println("staticPath: No embedded file", name)
+	return "/static/" + name
+}
+
+// ServeStatic handles GET /static/<name>.  Hashed names are cached for a
+// year; plain names are revalidated on every use.
+func ServeStatic(w http.ResponseWriter, req *http.Request) {
+	asset, ok := staticAssets[strings.TrimPrefix(req.URL.Path, "/static/")]
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	if asset.immutable {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	w.Header().Set("ETag", asset.etag)
+	http.ServeContent(w, req, asset.name, time.Time{}, bytes.NewReader(asset.content))
+}
@@ -0,0 +1,506 @@
+// tlchart draws the time series charts of the tempLogger pages on a canvas,
+// with an axis per unit, gaps where readings are missing, a hover tooltip,
+// a clickable legend and drag to zoom.  Double click resets the zoom.
+(function(window) {
+    "use strict";
+
+    var MINUTE = 60 * 1000;
+    var HOUR = 60 * MINUTE;
+    var DAY = 24 * HOUR;
+    var TIME_STEPS = [MINUTE, 5 * MINUTE, 15 * MINUTE, 30 * MINUTE, HOUR, 3 * HOUR, 6 * HOUR,
+        12 * HOUR, DAY, 2 * DAY, 7 * DAY, 14 * DAY, 28 * DAY];
+    var MONTHS = ["Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"];
+    var AXIS_WIDTH = 60;
+    var PAD_TOP = 10;
+    var PAD_RIGHT = 10;
+    var PAD_BOTTOM = 28;
+    // HOVER_PIXELS is how close a reading must be to the cursor to appear
+    // in the tooltip.
+    var HOVER_PIXELS = 20;
+    var FONT = "12px system-ui, -apple-system, sans-serif";
+    var TEXT_COLOR = "#6c757d";
+    var GRID_COLOR = "#e9ecef";
+
+    function pad2(n) {
+        return n < 10 ? "0" + n : "" + n;
+    }
+
+    function formatTime(t) {
+        var d = new Date(t);
+        return pad2(d.getHours()) + ":" + pad2(d.getMinutes());
+    }
+
+    function formatDay(t) {
+        var d = new Date(t);
+        return MONTHS[d.getMonth()] + " " + d.getDate();
+    }
+
+    function formatDateTime(t) {
+        var d = new Date(t);
+        return d.getFullYear() + "-" + pad2(d.getMonth() + 1) + "-" + pad2(d.getDate()) + " " + formatTime(t);
+    }
+
+    // niceStep rounds a tick spacing up to 1, 2 or 5 times a power of ten.
+    function niceStep(raw) {
+        var exp = Math.pow(10, Math.floor(Math.log(raw) / Math.LN10));
+        var f = raw / exp;
+        return (f <= 1 ? 1 : f <= 2 ? 2 : f <= 5 ? 5 : 10) * exp;
+    }
+
+    // valueTicks spreads about count ticks over [min, max], widening the
+    // range to whole ticks.
+    function valueTicks(min, max, count) {
+        if (min == max) {
+            min -= 1;
+            max += 1;
+        }
+        var step = niceStep((max - min) / count);
+        var lo = Math.floor(min / step) * step;
+        var hi = Math.ceil(max / step) * step;
+        var ticks = [];
+        for (var v = lo; v <= hi + step / 2; v += step) {
+            ticks.push(Math.round(v / step) * step);
+        }
+        var decimals = Math.max(0, -Math.floor(Math.log(step) / Math.LN10));
+        return { min: lo, max: hi, ticks: ticks, decimals: decimals };
+    }
+
+    // timeTicks places ticks at round local times at least minSpacing
+    // apart.
+    function timeTicks(from, to, minSpacing) {
+        var step = TIME_STEPS[TIME_STEPS.length - 1];
+        for (var i = 0; i < TIME_STEPS.length; i++) {
+            if (TIME_STEPS[i] >= minSpacing) {
+                step = TIME_STEPS[i];
+                break;
+            }
+        }
+        var d = new Date(from);
+        var midnight = new Date(d.getFullYear(), d.getMonth(), d.getDate()).getTime();
+        var ticks = [];
+        for (var t = midnight + Math.ceil((from - midnight) / step) * step; t <= to; t += step) {
+            var day = new Date(t);
+            var atMidnight = day.getHours() == 0 && day.getMinutes() == 0;
+            ticks.push({ t: t, label: step >= DAY || atMidnight ? formatDay(t) : formatTime(t) });
+        }
+        return ticks;
+    }
+
+    // nearest returns the index of the point of data closest to t, or -1 if
+    // data is empty.
+    function nearest(data, t) {
+        var lo = 0;
+        var hi = data.length - 1;
+        if (hi < 0) {
+            return -1;
+        }
+        while (lo < hi) {
+            var mid = (lo + hi) >> 1;
+            if (data[mid].date < t) {
+                lo = mid + 1;
+            } else {
+                hi = mid;
+            }
+        }
+        if (lo > 0 && t - data[lo - 1].date < data[lo].date - t) {
+            lo--;
+        }
+        return lo;
+    }
+
+    function TLChart(el, options) {
+        var chart = this;
+        this.el = el;
+        this.options = options || {};
+        this.axes = [];
+        this.series = [];
+        this.zoom = null;
+        this.hover = null;
+        this.drag = null;
+        this.pending = false;
+
+        el.classList.add("tlchart");
+        this.canvas = document.createElement("canvas");
+        this.tooltip = document.createElement("div");
+        this.tooltip.className = "tlchart-tooltip";
+        this.tooltip.hidden = true;
+        this.legend = document.createElement("div");
+        this.legend.className = "tlchart-legend";
+        el.appendChild(this.canvas);
+        el.appendChild(this.tooltip);
+        el.appendChild(this.legend);
+
+        this.canvas.addEventListener("mousedown", function(event) {
+            var x = chart.eventX(event);
+            if (chart.layout && x >= chart.layout.left && x <= chart.layout.right) {
+                chart.drag = { from: x, to: x };
+            }
+        });
+        this.canvas.addEventListener("mousemove", function(event) {
+            var x = chart.eventX(event);
+            if (chart.drag) {
+                chart.drag.to = x;
+            }
+            chart.hover = x;
+            chart.update();
+        });
+        this.canvas.addEventListener("mouseup", function() {
+            var drag = chart.drag;
+            chart.drag = null;
+            if (drag && Math.abs(drag.to - drag.from) > 5) {
+                chart.zoom = [chart.timeAt(Math.min(drag.from, drag.to)), chart.timeAt(Math.max(drag.from, drag.to))];
+            }
+            chart.update();
+        });
+        this.canvas.addEventListener("mouseleave", function() {
+            chart.hover = null;
+            chart.drag = null;
+            chart.update();
+        });
+        this.canvas.addEventListener("dblclick", function() {
+            chart.zoom = null;
+            chart.update();
+        });
+        window.addEventListener("resize", function() {
+            chart.update();
+        });
+    }
+
+    // addAxis adds a value axis shared by the series given its key.  The
+    // first axis is drawn on the left and the rest on the right.  Axes with
+    // no series shown are hidden.
+    TLChart.prototype.addAxis = function(key, options) {
+        var axis = { key: key, label: options.label || "", opposite: this.axes.length > 0 };
+        this.axes.push(axis);
+        return axis;
+    };
+
+    // addSeries adds a line of the field values of data, a list of points
+    // sorted by their date in Unix milliseconds.  Points without the field
+    // break the line.
+    TLChart.prototype.addSeries = function(options) {
+        var series = {
+            name: options.name,
+            color: options.color || "#0d6efd",
+            dash: options.dash || [],
+            axis: options.axis,
+            field: options.field,
+            unit: options.unit || "",
+            data: options.data || [],
+            enabled: true,
+            muted: false
+        };
+        this.series.push(series);
+        this.update();
+        return series;
+    };
+
+    // showSeries enables only the series for which show returns true, and
+    // lists them in the legend.
+    TLChart.prototype.showSeries = function(show) {
+        this.series.forEach(function(series) {
+            series.enabled = !!show(series);
+        });
+        this.renderLegend();
+        this.update();
+    };
+
+    // push appends a point to series.
+    TLChart.prototype.push = function(series, point) {
+        series.data.push(point);
+        this.update();
+    };
+
+    // update redraws the chart at the next animation frame.
+    TLChart.prototype.update = function() {
+        var chart = this;
+        if (this.pending) {
+            return;
+        }
+        this.pending = true;
+        window.requestAnimationFrame(function() {
+            chart.pending = false;
+            chart.render();
+        });
+    };
+
+    TLChart.prototype.eventX = function(event) {
+        return event.clientX - this.canvas.getBoundingClientRect().left;
+    };
+
+    TLChart.prototype.timeAt = function(x) {
+        var l = this.layout;
+        return l.from + (x - l.left) / (l.right - l.left) * (l.to - l.from);
+    };
+
+    TLChart.prototype.drawn = function(series) {
+        return series.enabled && !series.muted;
+    };
+
+    TLChart.prototype.renderLegend = function() {
+        var chart = this;
+        this.legend.textContent = "";
+        this.series.forEach(function(series) {
+            if (!series.enabled) {
+                return;
+            }
+            var item = document.createElement("button");
+            item.type = "button";
+            item.className = "tlchart-legend-item" + (series.muted ? " muted" : "");
+            var swatch = document.createElement("span");
+            swatch.className = "tlchart-swatch";
+            swatch.style.background = series.color;
+            item.appendChild(swatch);
+            item.appendChild(document.createTextNode(series.name));
+            item.addEventListener("click", function() {
+                series.muted = !series.muted;
+                item.classList.toggle("muted", series.muted);
+                chart.update();
+            });
+            chart.legend.appendChild(item);
+        });
+    };
+
+    // timeRange returns the period shown: the zoom, or the configured
+    // period widened to include every reading.
+    TLChart.prototype.timeRange = function() {
+        if (this.zoom) {
+            return this.zoom;
+        }
+        var from = this.options.from;
+        var to = this.options.to;
+        this.series.forEach(function(series) {
+            if (series.data.length == 0) {
+                return;
+            }
+            var first = series.data[0].date;
+            var last = series.data[series.data.length - 1].date;
+            from = from === undefined || first < from ? first : from;
+            to = to === undefined || last > to ? last : to;
+        });
+        if (from === undefined) {
+            to = Date.now();
+            from = to - DAY;
+        }
+        if (from == to) {
+            from -= HOUR;
+        }
+        return [from, to];
+    };
+
+    TLChart.prototype.valueRange = function(axis, from, to) {
+        var chart = this;
+        var min = Infinity;
+        var max = -Infinity;
+        this.series.forEach(function(series) {
+            if (series.axis !== axis || !chart.drawn(series)) {
+                return;
+            }
+            series.data.forEach(function(point) {
+                var v = point[series.field];
+                if (v === undefined || v === null || point.date < from || point.date > to) {
+                    return;
+                }
+                min = Math.min(min, v);
+                max = Math.max(max, v);
+            });
+        });
+        if (min > max) {
+            return null;
+        }
+        return { min: min, max: max };
+    };
+
+    TLChart.prototype.render = function() {
+        var chart = this;
+        var dpr = window.devicePixelRatio || 1;
+        var width = this.el.clientWidth;
+        var height = this.options.height || 500;
+        var canvas = this.canvas;
+        canvas.width = width * dpr;
+        canvas.height = height * dpr;
+        canvas.style.width = width + "px";
+        canvas.style.height = height + "px";
+        var ctx = canvas.getContext("2d");
+        ctx.setTransform(dpr, 0, 0, dpr, 0, 0);
+        ctx.clearRect(0, 0, width, height);
+        ctx.font = FONT;
+
+        var range = this.timeRange();
+        var from = range[0];
+        var to = range[1];
+        var shown = this.axes.filter(function(axis) {
+            return chart.series.some(function(series) {
+                return series.axis === axis && chart.drawn(series);
+            });
+        });
+        var left = shown.filter(function(axis) { return !axis.opposite; });
+        var right = shown.filter(function(axis) { return axis.opposite; });
+        var l = {
+            left: Math.max(left.length * AXIS_WIDTH, PAD_RIGHT),
+            right: width - Math.max(right.length * AXIS_WIDTH, PAD_RIGHT),
+            top: PAD_TOP,
+            bottom: height - PAD_BOTTOM,
+            from: from,
+            to: to
+        };
+        this.layout = l;
+        if (l.right <= l.left) {
+            return;
+        }
+        function xOf(t) {
+            return l.left + (t - from) / (to - from) * (l.right - l.left);
+        }
+
+        // Time axis and vertical grid
+        ctx.strokeStyle = GRID_COLOR;
+        ctx.fillStyle = TEXT_COLOR;
+        ctx.textAlign = "center";
+        ctx.textBaseline = "top";
+        ctx.lineWidth = 1;
+        timeTicks(from, to, (to - from) / (l.right - l.left) * 90).forEach(function(tick) {
+            var x = Math.round(xOf(tick.t)) + 0.5;
+            ctx.beginPath();
+            ctx.moveTo(x, l.top);
+            ctx.lineTo(x, l.bottom);
+            ctx.stroke();
+            ctx.fillText(tick.label, x, l.bottom + 8);
+        });
+
+        // Value axes, the first of which draws the horizontal grid
+        var scales = {};
+        var leftIndex = 0;
+        var rightIndex = 0;
+        shown.forEach(function(axis) {
+            var vr = chart.valueRange(axis, from, to) || { min: 0, max: 1 };
+            var vt = valueTicks(vr.min, vr.max, 5);
+            var yOf = function(v) {
+                return l.bottom - (v - vt.min) / (vt.max - vt.min) * (l.bottom - l.top);
+            };
+            scales[axis.key] = yOf;
+            var x = axis.opposite ? l.right + rightIndex++ * AXIS_WIDTH : l.left - leftIndex++ * AXIS_WIDTH;
+            ctx.textAlign = axis.opposite ? "left" : "right";
+            ctx.textBaseline = "middle";
+            vt.ticks.forEach(function(v) {
+                var y = Math.round(yOf(v)) + 0.5;
+                if (axis === shown[0]) {
+                    ctx.strokeStyle = GRID_COLOR;
+                    ctx.beginPath();
+                    ctx.moveTo(l.left, y);
+                    ctx.lineTo(l.right, y);
+                    ctx.stroke();
+                }
+                ctx.fillText(v.toFixed(vt.decimals), axis.opposite ? x + 6 : x - 6, y);
+            });
+            ctx.save();
+            ctx.translate(axis.opposite ? x + AXIS_WIDTH - 8 : x - AXIS_WIDTH + 8, (l.top + l.bottom) / 2);
+            ctx.rotate(-Math.PI / 2);
+            ctx.textAlign = "center";
+            ctx.textBaseline = axis.opposite ? "bottom" : "top";
+            ctx.fillText(axis.label, 0, 0);
+            ctx.restore();
+        });
+
+        // Lines, clipped to the plot
+        ctx.save();
+        ctx.beginPath();
+        ctx.rect(l.left, l.top, l.right - l.left, l.bottom - l.top);
+        ctx.clip();
+        ctx.lineWidth = 1.5;
+        ctx.lineJoin = "round";
+        this.series.forEach(function(series) {
+            if (!chart.drawn(series)) {
+                return;
+            }
+            var yOf = scales[series.axis.key];
+            ctx.strokeStyle = series.color;
+            ctx.setLineDash(series.dash);
+            ctx.beginPath();
+            var penDown = false;
+            series.data.forEach(function(point) {
+                var v = point[series.field];
+                if (v === undefined || v === null) {
+                    penDown = false;
+                    return;
+                }
+                var x = xOf(point.date);
+                var y = yOf(v);
+                if (penDown) {
+                    ctx.lineTo(x, y);
+                } else {
+                    ctx.moveTo(x, y);
+                    penDown = true;
+                }
+            });
+            ctx.stroke();
+        });
+        ctx.setLineDash([]);
+
+        if (this.drag) {
+            ctx.fillStyle = "rgba(13, 110, 253, 0.1)";
+            ctx.fillRect(Math.min(this.drag.from, this.drag.to), l.top, Math.abs(this.drag.to - this.drag.from), l.bottom - l.top);
+        }
+        var hovering = this.hover !== null && this.hover >= l.left && this.hover <= l.right;
+        if (hovering) {
+            ctx.strokeStyle = TEXT_COLOR;
+            ctx.lineWidth = 1;
+            ctx.beginPath();
+            ctx.moveTo(Math.round(this.hover) + 0.5, l.top);
+            ctx.lineTo(Math.round(this.hover) + 0.5, l.bottom);
+            ctx.stroke();
+        }
+        ctx.restore();
+        this.renderTooltip(hovering);
+    };
+
+    TLChart.prototype.renderTooltip = function(hovering) {
+        var chart = this;
+        var tooltip = this.tooltip;
+        tooltip.textContent = "";
+        tooltip.hidden = true;
+        if (!hovering || this.drag) {
+            return;
+        }
+        var l = this.layout;
+        var t = this.timeAt(this.hover);
+        var tolerance = HOVER_PIXELS * (l.to - l.from) / (l.right - l.left);
+        var title = document.createElement("div");
+        title.className = "tlchart-tooltip-title";
+        title.textContent = formatDateTime(t);
+        tooltip.appendChild(title);
+        var rows = 0;
+        this.series.forEach(function(series) {
+            if (!chart.drawn(series)) {
+                return;
+            }
+            var i = nearest(series.data, t);
+            if (i < 0 || Math.abs(series.data[i].date - t) > tolerance) {
+                return;
+            }
+            var v = series.data[i][series.field];
+            if (v === undefined || v === null) {
+                return;
+            }
+            var row = document.createElement("div");
+            var swatch = document.createElement("span");
+            swatch.className = "tlchart-swatch";
+            swatch.style.background = series.color;
+            row.appendChild(swatch);
+            row.appendChild(document.createTextNode(series.name + ": " + v + " " + series.unit));
+            tooltip.appendChild(row);
+            rows++;
+        });
+        if (rows == 0) {
+            return;
+        }
+        tooltip.hidden = false;
+        var x = this.hover + 12;
+        if (x + tooltip.offsetWidth > l.right) {
+            x = this.hover - 12 - tooltip.offsetWidth;
+        }
+        tooltip.style.left = Math.max(0, x) + "px";
+        tooltip.style.top = l.top + "px";
+    };
+
+    window.TLChart = TLChart;
+})(window);
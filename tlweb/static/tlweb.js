@@ -0,0 +1,8 @@
+// Opens and closes the navigation menu on narrow screens.
+document.querySelectorAll(".navbar-toggler").forEach(function(toggler) {
+    toggler.addEventListener("click", function() {
+        var target = document.querySelector(toggler.dataset.bsTarget);
+        var open = target.classList.toggle("show");
+        toggler.setAttribute("aria-expanded", open);
+    });
+});
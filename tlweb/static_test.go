@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestServeStatic(t *testing.T) {
+	hashed := staticPath("tlchart.js")
+	if !regexp.MustCompile(`^/static/tlchart\.[0-9a-f]{10}\.js$`).MatchString(hashed) {
+		t.Fatalf("Unexpected path: %s", hashed)
+	}
+
+	w := httptest.NewRecorder()
+	ServeStatic(w, httptest.NewRequest("GET", hashed, nil))
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "TLChart") {
+		t.Fatalf("Unexpected response: %d", w.Code)
+	}
+	if cc := w.Header().Get("Cache-Control"); !strings.Contains(cc, "immutable") {
+		t.Errorf("Hashed asset not cached: %s", cc)
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/javascript") {
+		t.Errorf("Unexpected content type: %s", ct)
+	}
+
+	req := httptest.NewRequest("GET", hashed, nil)
+	req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	w = httptest.NewRecorder()
+	ServeStatic(w, req)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("Expected %d, got %d", http.StatusNotModified, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	ServeStatic(w, httptest.NewRequest("GET", "/static/tlweb.css", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Unexpected response for plain name: %d %s", w.Code, w.Header().Get("Cache-Control"))
+	}
+
+	w = httptest.NewRecorder()
+	ServeStatic(w, httptest.NewRequest("GET", "/static/missing.js", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected %d, got %d", http.StatusNotFound, w.Code)
+	}
+}
+
+func TestPagesOffline(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	external := regexp.MustCompile(`(src|href)="https?://`)
+	for path, handler := range map[string]http.HandlerFunc{
+		"/?from=2024-01-13&to=2024-01-16": tlWeb.ShowRange,
+		"/alerts":                         tlWeb.ShowAlerts,
+	} {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		body := w.Body.String()
+		if external.MatchString(body) {
+			t.Errorf("%s: Page loads external resources", path)
+		}
+		if !strings.Contains(body, staticPath("tlweb.css")) {
+			t.Errorf("%s: Page is missing the stylesheet", path)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"tempLogger/stats"
+	"tempLogger/types"
+	"time"
+)
+
+const (
+	defaultStatsRange = "30d"
+	// defaultBaseF is the base temperature of heating and cooling degree
+	// days when none is configured.
+	defaultBaseF = 65
+)
+
+// periodStart returns the start of the day, week, month or season that t
+// is in, in the local time zone.  Weeks start on Monday.
+func periodStart(t time.Time, period string) time.Time {
+	t = t.In(time.Local)
+	switch period {
+	case types.PeriodWeek:
+		day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case types.PeriodMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.Local)
+	case types.PeriodSeason:
+		// Month 0 is the December before
+		return time.Date(t.Year(), t.Month()-t.Month()%3, 1, 0, 0, 0, 0, time.Local)
+	}
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+// addPeriods moves the start of a period n periods later, or earlier if n
+// is negative.
+func addPeriods(start time.Time, period string, n int) time.Time {
+	switch period {
+	case types.PeriodWeek:
+		return start.AddDate(0, 0, 7*n)
+	case types.PeriodMonth:
+		return start.AddDate(0, n, 0)
+	case types.PeriodSeason:
+		return start.AddDate(0, 3*n, 0)
+	}
+	return start.AddDate(0, 0, n)
+}
+
+// statsBases are the base temperatures of the degree days and the
+// threshold of the hours below, in Celsius.
+type statsBases struct {
+	heatingC float32
+	coolingC float32
+	belowC   float32
+}
+
+// degreeDayBases returns the configured bases, or the defaults.
+func (tlweb TLWeb) degreeDayBases() (bases statsBases) {
+	cfg := tlweb.DegreeDays
+	if cfg.Units == "" {
+		cfg.Units = types.UnitF
+	}
+	bases.heatingC = types.ToCelsius(defaultBaseF, types.UnitF)
+	if cfg.HeatingBase != nil {
+		bases.heatingC = types.ToCelsius(*cfg.HeatingBase, cfg.Units)
+	}
+	bases.coolingC = types.ToCelsius(defaultBaseF, types.UnitF)
+	if cfg.CoolingBase != nil {
+		bases.coolingC = types.ToCelsius(*cfg.CoolingBase, cfg.Units)
+	}
+	if cfg.Below != nil {
+		bases.belowC = types.ToCelsius(*cfg.Below, cfg.Units)
+	}
+	return
+}
+
+// PeriodStats computes the statistics of sensor between begin and end by
+// period, with temperatures in unit.  Each reading holds until the next one,
+// or for one interval of the sensor when a gap follows it.
+func (tlweb TLWeb) PeriodStats(sensor types.SensorCfg, begin time.Time, end time.Time, period string, unit string, bases statsBases) (periods []types.PeriodStats, err error) {
+	periods = []types.PeriodStats{}
+	for start := periodStart(begin, period); start.Before(end); start = addPeriods(start, period, 1) {
+		periods = append(periods, types.PeriodStats{Start: start, End: addPeriods(start, period, 1)})
+	}
+	if len(periods) == 0 {
+		return
+	}
+	interval, _ := tlweb.Tldb.SensorInterval(sensor)
+	window := stats.NewWindow(periods[0].Start, periods[len(periods)-1].End, interval, time.Duration(gapFactor*float64(interval)))
+	// The range is exclusive, and a reading at the start of the first
+	// period belongs to it
+	err = tlweb.Tldb.StreamRecords(sensor.ID, window.Start.Add(-time.Second), window.End, func(thd types.THData) error {
+		ts, perr := time.Parse(time.RFC3339, thd.TimeStamp)
+		if perr != nil {
+			return perr
+		}
+		window.Add(ts, float64(types.TempIn(thd.TempC, thd.TempF, unit)))
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("PeriodStats: %w", err)
+		return
+	}
+	heating := float64(tempInC(bases.heatingC, unit))
+	cooling := float64(tempInC(bases.coolingC, unit))
+	below := float64(tempInC(bases.belowC, unit))
+	freezing := float64(tempInC(0, unit))
+	// Freezes are found over the whole range, as they may run across
+	// periods
+	freezes := window.Runs(func(v float64) bool { return v < freezing })
+	for i := range periods {
+		ps := &periods[i]
+		slice := window.Slice(ps.Start, ps.End)
+		if ps.Count = slice.Count(); ps.Count == 0 {
+			continue
+		}
+		ps.Min = float32(slice.Min().Value)
+		ps.Max = float32(slice.Max().Value)
+		ps.Mean = types.Round2(slice.Mean())
+		ps.Coverage = types.Round2(slice.Coverage())
+		ps.HeatingDegreeDays = types.Round2(slice.Integral(func(v float64) float64 { return max(0, heating-v) }) / 24)
+		ps.CoolingDegreeDays = types.Round2(slice.Integral(func(v float64) float64 { return max(0, v-cooling) }) / 24)
+		ps.HoursBelow = types.Round2(slice.TimeWhere(func(v float64) bool { return v < below }).Hours())
+		ps.HoursBelowFreezing = types.Round2(slice.TimeWhere(func(v float64) bool { return v < freezing }).Hours())
+		for _, freeze := range freezes {
+			length := freeze.End.Sub(freeze.Start).Hours()
+			if freeze.Start.Before(ps.End) && ps.Start.Before(freeze.End) && float32(length) > ps.LongestFreezeHours {
+				start := freeze.Start
+				ps.LongestFreezeHours = types.Round2(length)
+				ps.LongestFreezeStart = &start
+			}
+		}
+	}
+	return
+}
+
+// SensorStats computes the statistics of sensor, and of the earlier range
+// given by compare if it is set.
+func (tlweb TLWeb) SensorStats(sensor types.SensorCfg, begin time.Time, end time.Time, period string, compare string, unit string, bases statsBases) (stats types.SensorStats, err error) {
+	stats = types.SensorStats{
+		Sensor:      sensor.ID,
+		Site:        sensor.Site,
+		Name:        sensor.Name,
+		Color:       sensor.Color,
+		Unit:        unit,
+		Period:      period,
+		HeatingBase: tempFromC(bases.heatingC, unit),
+		CoolingBase: tempFromC(bases.coolingC, unit),
+		Below:       tempFromC(bases.belowC, unit),
+	}
+	if stats.Periods, err = tlweb.PeriodStats(sensor, begin, end, period, unit, bases); err != nil {
+		err = fmt.Errorf("SensorStats: %w", err)
+		return
+	}
+	switch compare {
+	case types.ComparePrevious:
+		start := periodStart(begin, period)
+		stats.Compare, err = tlweb.PeriodStats(sensor, addPeriods(start, period, -len(stats.Periods)), start, period, unit, bases)
+	case types.CompareYear:
+		stats.Compare, err = tlweb.PeriodStats(sensor, begin.AddDate(-1, 0, 0), end.AddDate(-1, 0, 0), period, unit, bases)
+	}
+	if err != nil {
+		err = fmt.Errorf("SensorStats: %w", err)
+		return
+	}
+	// A year before, weeks fall differently and may add one
+	if len(stats.Compare) > len(stats.Periods) {
+		stats.Compare = stats.Compare[:len(stats.Periods)]
+	}
+	return
+}
+
+// tempInC converts a Celsius temperature to unit.
+func tempInC(c float32, unit string) float32 {
+	return types.TempIn(c, c*9/5+32, unit)
+}
+
+// tempFromC converts a Celsius temperature to unit, rounded.
+func tempFromC(c float32, unit string) float32 {
+	return types.Round2(float64(tempInC(c, unit)))
+}
+
+// statsParams are the options of the statistics page and API.
+type statsParams struct {
+	pr      pageRange
+	period  string
+	compare string
+	unit    string
+	bases   statsBases
+	sensors []types.SensorCfg
+}
+
+// parseStatsParams reads the range, period, comparison, bases and sensors of
+// req.  The bases are in the units of the request and default to the
+// configured ones.  The sensor parameter may be repeated and defaults to
+// every sensor, or every sensor at site.
+func (tlweb TLWeb) parseStatsParams(w http.ResponseWriter, req *http.Request, now time.Time) (sp statsParams, status int, err error) {
+	status = http.StatusBadRequest
+	query := req.URL.Query()
+	if query.Get("range") == "" && query.Get("from") == "" && query.Get("to") == "" {
+		query.Set("range", defaultStatsRange)
+	}
+	if sp.pr, err = parsePageRange(query, now); err != nil {
+		return
+	}
+	sp.period = query.Get("period")
+	if sp.period == "" {
+		sp.period = types.PeriodDay
+	}
+	if !slices.Contains(types.Periods, sp.period) {
+		err = fmt.Errorf("Unknown period: %s", sp.period)
+		return
+	}
+	sp.compare = query.Get("compare")
+	if sp.compare != "" && !slices.Contains(types.Comparisons, sp.compare) {
+		err = fmt.Errorf("Unknown comparison: %s", sp.compare)
+		return
+	}
+	if sp.unit, err = tlweb.RequestUnits(w, req); err != nil {
+		return
+	}
+	sp.bases = tlweb.degreeDayBases()
+	for _, param := range []struct {
+		name string
+		c    *float32
+	}{
+		{"heatingBase", &sp.bases.heatingC},
+		{"coolingBase", &sp.bases.coolingC},
+		{"below", &sp.bases.belowC},
+	} {
+		if val := query.Get(param.name); val != "" {
+			temp, perr := strconv.ParseFloat(val, 32)
+			if perr != nil {
+				err = fmt.Errorf("Invalid %s: %s", param.name, val)
+				return
+			}
+			*param.c = types.ToCelsius(float32(temp), sp.unit)
+		}
+	}
+	status = http.StatusNotFound
+	all := tlweb.SensorList()
+	site, err := requestSite(req, all)
+	if err != nil {
+		return
+	}
+	wanted := query["sensor"]
+	for _, sensor := range wanted {
+		if !tlweb.Tldb.HasTable(sensor) {
+			err = fmt.Errorf("Unknown sensor: %s", sensor)
+			return
+		}
+	}
+	for _, sensor := range filterSite(all, site) {
+		if tlweb.Tldb.HasTable(sensor.ID) && (len(wanted) == 0 || slices.Contains(wanted, sensor.ID)) {
+			sp.sensors = append(sp.sensors, sensor)
+		}
+	}
+	status = http.StatusOK
+	return
+}
+
+// allStats computes the statistics of every sensor of sp.
+func (tlweb TLWeb) allStats(sp statsParams) (stats []types.SensorStats, err error) {
+	stats = []types.SensorStats{}
+	for _, sensor := range sp.sensors {
+		var sensorStats types.SensorStats
+		sensorStats, err = tlweb.SensorStats(sensor, sp.pr.Begin, sp.pr.End, sp.period, sp.compare, sp.unit, sp.bases)
+		if err != nil {
+			return
+		}
+		stats = append(stats, sensorStats)
+	}
+	return
+}
+
+// statsColumns are the columns of a period in the CSV statistics.
+var statsColumns = []string{"start", "end", "count", "min", "max", "mean", "coverage", "heating_degree_days", "cooling_degree_days",
+	"hours_below", "hours_below_freezing", "longest_freeze_hours", "longest_freeze_start"}
+
+// writeStatsCSV writes a row per sensor and period, followed by the period
+// it is compared with if there is one.
+func writeStatsCSV(w io.Writer, stats []types.SensorStats) (err error) {
+	cw := csv.NewWriter(w)
+	header := append([]string{"sensor", "site", "unit"}, statsColumns...)
+	compared := slices.ContainsFunc(stats, func(ss types.SensorStats) bool { return ss.Compare != nil })
+	if compared {
+		for _, col := range statsColumns {
+			header = append(header, "compare_"+col)
+		}
+	}
+	if err = cw.Write(header); err != nil {
+		err = fmt.Errorf("writeStatsCSV: %w", err)
+		return
+	}
+	for _, ss := range stats {
+		for i, ps := range ss.Periods {
+			row := append([]string{ss.Sensor, ss.Site, ss.Unit}, periodRow(ps)...)
+			if compared {
+				if i < len(ss.Compare) {
+					row = append(row, periodRow(ss.Compare[i])...)
+				} else {
+					row = append(row, make([]string, len(statsColumns))...)
+				}
+			}
+			if err = cw.Write(row); err != nil {
+				err = fmt.Errorf("writeStatsCSV: %w", err)
+				return
+			}
+		}
+	}
+	cw.Flush()
+	if err = cw.Error(); err != nil {
+		err = fmt.Errorf("writeStatsCSV: %w", err)
+	}
+	return
+}
+
+// periodRow formats ps as statsColumns, with blank values for a period
+// without readings.
+func periodRow(ps types.PeriodStats) []string {
+	row := make([]string, len(statsColumns))
+	row[0], row[1], row[2] = ps.Start.Format(time.RFC3339), ps.End.Format(time.RFC3339), strconv.Itoa(ps.Count)
+	if ps.Count > 0 {
+		for i, val := range []float32{ps.Min, ps.Max, ps.Mean, ps.Coverage, ps.HeatingDegreeDays, ps.CoolingDegreeDays,
+			ps.HoursBelow, ps.HoursBelowFreezing, ps.LongestFreezeHours} {
+			row[3+i] = strconv.FormatFloat(float64(val), 'f', -1, 32)
+		}
+	}
+	if ps.LongestFreezeStart != nil {
+		row[len(row)-1] = ps.LongestFreezeStart.Format(time.RFC3339)
+	}
+	return row
+}
+
+// APIStats handles GET /api/v1/stats?sensor=&site=&range=&from=&to=&period=&compare=&heatingBase=&coolingBase=&below=&units=&format=
+//
+// The format is json, the default, or csv.
+func (tlweb TLWeb) APIStats(w http.ResponseWriter, req *http.Request) {
+	format := req.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		writeAPIError(w, req, http.StatusBadRequest, "Unknown format: "+format)
+		return
+	}
+	sp, status, err := tlweb.parseStatsParams(w, req, time.Now())
+	if err != nil {
+		writeAPIError(w, req, status, err.Error())
+		return
+	}
+	stats, err := tlweb.allStats(sp)
+	if err != nil {
+		log.Println("APIStats:", err.Error())
+		writeAPIError(w, req, http.StatusInternalServerError, "Error computing statistics")
+		return
+	}
+	if format != "csv" {
+		writeJSON(w, req, http.StatusOK, stats)
+		return
+	}
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"stats-%s-%s-%s.csv\"",
+		sp.period, sp.pr.Begin.Format("20060102"), sp.pr.End.Format("20060102")))
+	if err = writeStatsCSV(w, stats); err != nil {
+		log.Println("APIStats:", err.Error())
+	}
+}
+
+// ShowStats renders the statistics page.
+func (tlweb TLWeb) ShowStats(w http.ResponseWriter, req *http.Request) {
+	now := time.Now()
+	sp, status, err := tlweb.parseStatsParams(w, req, now)
+	if err != nil {
+		tlweb.templates().Error(w, req, status, err.Error())
+		return
+	}
+	stats, err := tlweb.allStats(sp)
+	if err != nil {
+		log.Println("ShowStats:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusInternalServerError, "The statistics could not be computed.")
+		return
+	}
+	statsPage := types.StatsPage{
+		Label:       sp.pr.Label,
+		Range:       sp.pr.Range,
+		FromInput:   sp.pr.Begin.Format(inputLayout),
+		ToInput:     sp.pr.End.Format(inputLayout),
+		Period:      sp.period,
+		Periods:     types.Periods,
+		Compare:     sp.compare,
+		Comparisons: types.Comparisons,
+		HeatingBase: tempFromC(sp.bases.heatingC, sp.unit),
+		CoolingBase: tempFromC(sp.bases.coolingC, sp.unit),
+		Below:       tempFromC(sp.bases.belowC, sp.unit),
+		Sensor:      req.URL.Query().Get("sensor"),
+		Unit:        sp.unit,
+		Units:       types.Units,
+		Stats:       stats,
+	}
+	for _, sensor := range tlweb.SensorList() {
+		if tlweb.Tldb.HasTable(sensor.ID) {
+			statsPage.Sensors = append(statsPage.Sensors, sensor)
+		}
+	}
+	for _, preset := range rangePresets {
+		preset.Active = preset.Range == sp.pr.Range
+		statsPage.Presets = append(statsPage.Presets, preset)
+	}
+	query := req.URL.Query()
+	query.Set("format", "csv")
+	query.Set("units", sp.unit)
+	statsPage.CSVURL = "/api/v1/stats?" + query.Encode()
+	tlweb.templates().Render(w, req, http.StatusOK, "stats", statsPage)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestPeriodStart(t *testing.T) {
+	ts := time.Date(2024, time.January, 10, 15, 30, 0, 0, time.Local)
+	tests := []struct {
+		period string
+		start  time.Time
+		next   time.Time
+	}{
+		{types.PeriodDay, time.Date(2024, time.January, 10, 0, 0, 0, 0, time.Local), time.Date(2024, time.January, 11, 0, 0, 0, 0, time.Local)},
+		{types.PeriodWeek, time.Date(2024, time.January, 8, 0, 0, 0, 0, time.Local), time.Date(2024, time.January, 15, 0, 0, 0, 0, time.Local)},
+		{types.PeriodMonth, time.Date(2024, time.January, 1, 0, 0, 0, 0, time.Local), time.Date(2024, time.February, 1, 0, 0, 0, 0, time.Local)},
+		{types.PeriodSeason, time.Date(2023, time.December, 1, 0, 0, 0, 0, time.Local), time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local)},
+	}
+	for _, test := range tests {
+		start := periodStart(ts, test.period)
+		if !start.Equal(test.start) {
+			t.Errorf("periodStart %s: expected %s, got %s", test.period, test.start, start)
+		}
+		if next := addPeriods(start, test.period, 1); !next.Equal(test.next) {
+			t.Errorf("addPeriods %s: expected %s, got %s", test.period, test.next, next)
+		}
+	}
+}
+
+// statsReading is a reading of the stats test sensor at a local time.
+func statsReading(year int, month time.Month, day int, hour int, minute int, tempC float32) types.THData {
+	return types.THData{
+		ID:        "stats1",
+		TimeStamp: time.Date(year, month, day, hour, minute, 0, 0, time.Local).Format(time.RFC3339),
+		TempC:     tempC,
+		TempF:     tempC*9/5 + 32,
+	}
+}
+
+func TestStats(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+	// Hourly readings, with a burst at 01:00 and a gap after 03:00
+	_, err := tldb.ImportRecords([]types.THData{
+		statsReading(2023, time.January, 8, 12, 0, 0),
+		statsReading(2024, time.January, 8, 0, 0, -4),
+		statsReading(2024, time.January, 8, 1, 0, -4),
+		statsReading(2024, time.January, 8, 1, 30, -2),
+		statsReading(2024, time.January, 8, 2, 0, 8),
+		statsReading(2024, time.January, 8, 3, 0, 32),
+		statsReading(2024, time.January, 8, 12, 0, 20),
+		statsReading(2024, time.January, 9, 23, 0, -1),
+		statsReading(2024, time.January, 10, 0, 0, -1),
+		statsReading(2024, time.January, 10, 1, 0, -1),
+	})
+	if err != nil {
+		t.Fatalf("ImportRecords: %s", err.Error())
+	}
+	tlWeb := TLWeb{Tldb: tldb}
+	sensor := types.SensorCfg{ID: "stats1", IntervalSeconds: 3600}
+	bases := statsBases{heatingC: 20, coolingC: 25, belowC: 5}
+	begin := time.Date(2024, time.January, 8, 0, 0, 0, 0, time.Local)
+	end := time.Date(2024, time.January, 11, 0, 0, 0, 0, time.Local)
+
+	stats, err := tlWeb.SensorStats(sensor, begin, end, types.PeriodDay, types.CompareYear, types.UnitC, bases)
+	if err != nil {
+		t.Fatalf("SensorStats: %s", err.Error())
+	}
+	if stats.HeatingBase != 20 || stats.CoolingBase != 25 || stats.Below != 5 {
+		t.Errorf("Unexpected bases: %+v", stats)
+	}
+	if len(stats.Periods) != 3 {
+		t.Fatalf("Expected 3 periods, got %+v", stats.Periods)
+	}
+	// -4 holds for 1.5 hours, -2 for 0.5, 8 and 32 for one each, the
+	// gap after 32 not counting, and 20 for one: five of the 24 hours
+	day := stats.Periods[0]
+	freezeStart := begin
+	expected := types.PeriodStats{
+		Start:              begin,
+		End:                begin.AddDate(0, 0, 1),
+		Count:              6,
+		Min:                -4,
+		Max:                32,
+		Mean:               10.6,
+		Coverage:           20.83,
+		HeatingDegreeDays:  2.46,
+		CoolingDegreeDays:  0.29,
+		HoursBelow:         2,
+		HoursBelowFreezing: 2,
+		LongestFreezeHours: 2,
+		LongestFreezeStart: &freezeStart,
+	}
+	if !day.Start.Equal(expected.Start) || !day.End.Equal(expected.End) || !day.LongestFreezeStart.Equal(freezeStart) {
+		t.Errorf("Expected %s to %s, got %+v", expected.Start, expected.End, day)
+	}
+	day.Start, day.End, day.LongestFreezeStart = expected.Start, expected.End, expected.LongestFreezeStart
+	if day != expected {
+		t.Errorf("Expected %+v, got %+v", expected, day)
+	}
+	// The freeze from 23:00 runs into the next day
+	for _, day := range stats.Periods[1:] {
+		if day.LongestFreezeHours != 3 || day.LongestFreezeStart == nil || day.LongestFreezeStart.Hour() != 23 {
+			t.Errorf("Unexpected freeze: %+v", day)
+		}
+	}
+	if len(stats.Compare) != 3 || stats.Compare[0].Count != 1 || stats.Compare[0].Mean != 0 || stats.Compare[1].Count != 0 {
+		t.Errorf("Unexpected year comparison: %+v", stats.Compare)
+	}
+
+	stats, err = tlWeb.SensorStats(sensor, begin, end, types.PeriodWeek, types.ComparePrevious, types.UnitF, bases)
+	if err != nil {
+		t.Fatalf("SensorStats: %s", err.Error())
+	}
+	// Degree days of Fahrenheit are larger: (59 + 3 * 21) / 24 * 1.8
+	if len(stats.Periods) != 1 || stats.Periods[0].Count != 9 || stats.Periods[0].HeatingDegreeDays != 9.15 ||
+		stats.Periods[0].HoursBelowFreezing != 5 || stats.HeatingBase != 68 {
+		t.Errorf("Unexpected weekly statistics: %+v %+v", stats, stats.Periods)
+	}
+	if len(stats.Compare) != 1 || !stats.Compare[0].Start.Equal(begin.AddDate(0, 0, -7)) || stats.Compare[0].Count != 0 {
+		t.Errorf("Unexpected previous week: %+v", stats.Compare)
+	}
+}
+
+func TestAPIStats(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+	_, err := tldb.ImportRecords([]types.THData{
+		statsReading(2024, time.January, 8, 0, 0, -2),
+		statsReading(2024, time.January, 9, 12, 0, 10),
+	})
+	if err != nil {
+		t.Fatalf("ImportRecords: %s", err.Error())
+	}
+	heating := float32(18)
+	tlWeb := TLWeb{Tldb: tldb, DegreeDays: types.DegreeDayCfg{Units: types.UnitC, HeatingBase: &heating}}
+	const query = "sensor=stats1&from=2024-01-08&to=2024-01-10&units=C"
+
+	w := httptest.NewRecorder()
+	tlWeb.APIStats(w, httptest.NewRequest("GET", "/api/v1/stats?"+query, nil))
+	var stats []types.SensorStats
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != 200 || len(stats) != 1 || len(stats[0].Periods) != 2 || stats[0].Periods[1].Max != 10 || stats[0].Compare != nil ||
+		stats[0].HeatingBase != 18 || stats[0].CoolingBase != 18.33 || stats[0].Below != 0 {
+		t.Errorf("Unexpected statistics: %d %+v", w.Code, stats)
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.APIStats(w, httptest.NewRequest("GET", "/api/v1/stats?heatingBase=50&below=40&units=F&sensor=stats1&from=2024-01-08&to=2024-01-10", nil))
+	stats = nil
+	json.Unmarshal(w.Body.Bytes(), &stats)
+	if w.Code != 200 || len(stats) != 1 || stats[0].HeatingBase != 50 || stats[0].Below != 40 || stats[0].Unit != types.UnitF {
+		t.Errorf("Unexpected statistics with bases: %d %+v", w.Code, stats)
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.APIStats(w, httptest.NewRequest("GET", "/api/v1/stats?format=csv&compare=previous&"+query, nil))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	if w.Code != 200 || len(lines) != 3 || !strings.HasPrefix(lines[0], "sensor,site,unit,start,") ||
+		!strings.Contains(lines[0], ",longest_freeze_start,compare_start,") || !strings.HasPrefix(lines[1], "stats1,,C,") {
+		t.Errorf("Unexpected CSV: %d %q", w.Code, lines)
+	}
+	if disposition := w.Header().Get("Content-Disposition"); !strings.Contains(disposition, "stats-day-20240108-20240110.csv") {
+		t.Errorf("Unexpected Content-Disposition: %s", disposition)
+	}
+
+	for _, test := range []struct {
+		query string
+		code  int
+	}{
+		{"period=year", 400},
+		{"below=cold", 400},
+		{"compare=decade", 400},
+		{"format=xml", 400},
+		{"sensor=nosuch", 404},
+		{"site=nowhere", 404},
+	} {
+		w = httptest.NewRecorder()
+		tlWeb.APIStats(w, httptest.NewRequest("GET", "/api/v1/stats?"+test.query, nil))
+		if w.Code != test.code {
+			t.Errorf("%s: expected %d, got %d", test.query, test.code, w.Code)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	tlWeb.ShowStats(w, httptest.NewRequest("GET", "/stats?compare=year&"+query, nil))
+	if w.Code != 200 || !strings.Contains(w.Body.String(), "Download CSV") || !strings.Contains(w.Body.String(), "2023-01-08") {
+		t.Errorf("Unexpected statistics page: %d", w.Code)
+	}
+}
+
+func TestDegreeDayBases(t *testing.T) {
+	// A configured 0 is a base, not a missing one
+	var cfg types.DegreeDayCfg
+	if err := json.Unmarshal([]byte(`{"units": "F", "heatingBase": 0, "below": 0}`), &cfg); err != nil {
+		t.Fatalf("Unmarshal: %s", err.Error())
+	}
+	bases := TLWeb{DegreeDays: cfg}.degreeDayBases()
+	zeroF := types.ToCelsius(0, types.UnitF)
+	if bases.heatingC != zeroF || bases.belowC != zeroF || bases.coolingC != types.ToCelsius(defaultBaseF, types.UnitF) {
+		t.Errorf("Unexpected bases for 0°F: %+v", bases)
+	}
+
+	var below float32
+	bases = TLWeb{DegreeDays: types.DegreeDayCfg{Units: types.UnitC, Below: &below}}.degreeDayBases()
+	if bases.belowC != 0 || bases.heatingC != types.ToCelsius(defaultBaseF, types.UnitF) {
+		t.Errorf("Unexpected bases for 0°C: %+v", bases)
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"tempLogger/types"
+	"time"
+)
+
+// templateFS holds base.html, the layout every page shares, and one file
+// per page that defines its title, content and any of the optional blocks
+// of the layout.
+//
+//go:embed templates
+var templateFS embed.FS
+
+// templateFuncs are the functions available to every page template.
+var templateFuncs = template.FuncMap{
+	"static": staticPath,
+	"msTime": func(ms int64) string {
+		return time.UnixMilli(ms).Format("2006-01-02 15:04")
+	},
+	// user is replaced when rendering with the signed in user.
+	"user": func() *types.User { return nil },
+}
+
+// Templates renders the pages.
+type Templates struct {
+	pages map[string]*template.Template
+	// dir, if set, is reparsed on every request so template changes show
+	// without restarting.
+	dir string
+}
+
+// pageTemplates are the embedded templates, used when TLWeb has none set.
+var pageTemplates = mustParseTemplates()
+
+func mustParseTemplates() *Templates {
+	tmpl, err := NewTemplates("")
+	if err != nil {
+		log.Fatalln("Error parsing embedded templates:", err.Error())
+	}
+	return tmpl
+}
+
+// NewTemplates parses the embedded templates, or those in dir if it is not
+// empty, which are then reloaded on every request.
+func NewTemplates(dir string) (tmpl *Templates, err error) {
+	tmpl = &Templates{dir: dir}
+	if dir == "" {
+		tmpl.pages, err = parseTemplates(templateFS, "templates")
+	} else {
+		tmpl.pages, err = parseTemplates(os.DirFS(dir), ".")
+	}
+	if err != nil {
+		err = fmt.Errorf("NewTemplates: %w", err)
+	}
+	return
+}
+
+// parseTemplates parses each page of dir in fsys with the layout, keyed by
+// its name without the extension.
+func parseTemplates(fsys fs.FS, dir string) (pages map[string]*template.Template, err error) {
+	base, err := template.New("base.html").Funcs(templateFuncs).ParseFS(fsys, path.Join(dir, "base.html"))
+	if err != nil {
+		err = fmt.Errorf("parseTemplates: Error parsing layout: %w", err)
+		return
+	}
+	names, err := fs.Glob(fsys, path.Join(dir, "*.html"))
+	if err != nil {
+		err = fmt.Errorf("parseTemplates: Error listing templates: %w", err)
+		return
+	}
+	pages = make(map[string]*template.Template)
+	for _, name := range names {
+		page := strings.TrimSuffix(path.Base(name), ".html")
+		if page == "base" {
+			continue
+		}
+		t, cerr := base.Clone()
+		if cerr != nil {
+			err = fmt.Errorf("parseTemplates: Error copying layout: %w", cerr)
+			return
+		}
+		if pages[page], err = t.ParseFS(fsys, name); err != nil {
+			err = fmt.Errorf("parseTemplates: Error parsing %s: %w", name, err)
+			return
+		}
+	}
+	if pages["error"] == nil {
+		err = fmt.Errorf("parseTemplates: No error page in %s", dir)
+	}
+	return
+}
+
+// Render writes the page called name with data, or an error page if it
+// cannot be rendered.  Nothing is written until the page is complete, so a
+// failure is never sent as a successful half page.
+func (tmpl *Templates) Render(w http.ResponseWriter, req *http.Request, status int, name string, data any) {
+	pages := tmpl.pages
+	if tmpl.dir != "" {
+		reloaded, err := parseTemplates(os.DirFS(tmpl.dir), ".")
+		if err != nil {
+			log.Println("Render: Error reloading templates:", err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		pages = reloaded
+	}
+	t, ok := pages[name]
+	if !ok {
+		log.Println("Render: No template", name)
+		tmpl.renderError(w, req, pages, http.StatusInternalServerError, "The page could not be displayed.")
+		return
+	}
+	body, err := execute(t, req, data)
+	if err != nil {
+		log.Printf("Render: Error executing template %s: %s\n", name, err.Error())
+		tmpl.renderError(w, req, pages, http.StatusInternalServerError, "The page could not be displayed.")
+		return
+	}
+	writeHTML(w, status, body)
+}
+
+// execute runs a copy of a page for the user of req, leaving the parsed
+// page unexecuted so it can be copied again.
+func execute(t *template.Template, req *http.Request, data any) (body []byte, err error) {
+	t, err = t.Clone()
+	if err != nil {
+		err = fmt.Errorf("execute: Error copying template: %w", err)
+		return
+	}
+	t.Funcs(template.FuncMap{"user": func() *types.User { return requestUser(req) }})
+	var buf bytes.Buffer
+	if err = t.ExecuteTemplate(&buf, "base", data); err != nil {
+		err = fmt.Errorf("execute: %w", err)
+		return
+	}
+	body = buf.Bytes()
+	return
+}
+
+// Error writes the error page.
+func (tmpl *Templates) Error(w http.ResponseWriter, req *http.Request, status int, msg string) {
+	tmpl.Render(w, req, status, "error", types.ErrorPage{Status: status, Title: http.StatusText(status), Message: msg})
+}
+
+// renderError writes the error page without reloading, falling back to
+// plain text if even that fails.
+func (tmpl *Templates) renderError(w http.ResponseWriter, req *http.Request, pages map[string]*template.Template, status int, msg string) {
+	data := types.ErrorPage{Status: status, Title: http.StatusText(status), Message: msg}
+	body, err := execute(pages["error"], req, data)
+	if err != nil {
+		log.Println("renderError:", err.Error())
+		http.Error(w, msg, status)
+		return
+	}
+	writeHTML(w, status, body)
+}
+
+func writeHTML(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// templates returns the templates of the server, or the embedded ones.
+func (tlweb TLWeb) templates() *Templates {
+	if tlweb.Templates != nil {
+		return tlweb.Templates
+	}
+	return pageTemplates
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// copyTemplates copies the embedded templates to a new directory.
+func copyTemplates(t *testing.T) string {
+	dir := t.TempDir()
+	names, err := fs.Glob(templateFS, "templates/*.html")
+	if err != nil {
+		t.Fatalf("Could not list templates: %s", err.Error())
+	}
+	for _, name := range names {
+		content, err := templateFS.ReadFile(name)
+		if err != nil {
+			t.Fatalf("Could not read %s: %s", name, err.Error())
+		}
+		if err = os.WriteFile(filepath.Join(dir, filepath.Base(name)), content, 0644); err != nil {
+			t.Fatalf("Could not write %s: %s", name, err.Error())
+		}
+	}
+	return dir
+}
+
+func TestTemplates(t *testing.T) {
+	dir := copyTemplates(t)
+	tmpl, err := NewTemplates(dir)
+	if err != nil {
+		t.Fatalf("NewTemplates: %s", err.Error())
+	}
+
+	// Pages are reloaded from the directory
+	err = os.WriteFile(filepath.Join(dir, "hello.html"), []byte(`{{ define "title" }}Hello{{ end }}{{ define "content" }}Hello, {{ . }}{{ end }}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not write template: %s", err.Error())
+	}
+	w := httptest.NewRecorder()
+	tmpl.Render(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "hello", "world")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "Hello, world") || !strings.Contains(w.Body.String(), "<title>tempLogger Hello</title>") {
+		t.Errorf("Unexpected page: %d: %s", w.Code, w.Body.String())
+	}
+
+	// A template that fails part way through is an error page, not half of
+	// the page
+	err = os.WriteFile(filepath.Join(dir, "hello.html"), []byte(`{{ define "title" }}Hello{{ end }}{{ define "content" }}Hello, {{ .Missing }}{{ end }}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not write template: %s", err.Error())
+	}
+	w = httptest.NewRecorder()
+	tmpl.Render(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "hello", "world")
+	if w.Code != http.StatusInternalServerError || strings.Contains(w.Body.String(), "Hello,") || !strings.Contains(w.Body.String(), "500 Internal Server Error") {
+		t.Errorf("Unexpected page: %d: %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	tmpl.Render(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "missing", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+
+	// A template that does not parse fails at startup, or in development
+	// with a plain error
+	err = os.WriteFile(filepath.Join(dir, "hello.html"), []byte(`{{ define "content" }}{{ if }}{{ end }}`), 0644)
+	if err != nil {
+		t.Fatalf("Could not write template: %s", err.Error())
+	}
+	if _, err = NewTemplates(dir); err == nil {
+		t.Error("Expected a parse error")
+	}
+	w = httptest.NewRecorder()
+	tmpl.Render(w, httptest.NewRequest("GET", "/", nil), http.StatusOK, "range", nil)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestErrorPages(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	tlWeb := TLWeb{Tldb: tldb}
+	for path, status := range map[string]int{
+		"/missing":        http.StatusNotFound,
+		"/?range=forever": http.StatusBadRequest,
+		"/?site=nowhere":  http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		tlWeb.ShowRange(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != status || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("%s: Unexpected response %d %s", path, w.Code, w.Header().Get("Content-Type"))
+		}
+		if !strings.Contains(w.Body.String(), http.StatusText(status)) {
+			t.Errorf("%s: Missing error page", path)
+		}
+	}
+}
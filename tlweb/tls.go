@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"tempLogger/metrics"
+	"time"
+)
+
+// certReloadInterval is how often the certificate files are checked for
+// changes, such as a renewal by certbot.
+const certReloadInterval = 30 * time.Second
+
+// CertReloader serves a certificate and key pair, reloading them when the
+// files change so a renewed certificate is used without a restart.
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	// mu guards the fields below.
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	leaf    *x509.Certificate
+	certMod time.Time
+	keyMod  time.Time
+}
+
+// NewCertReloader loads the pair, failing if it is not valid.
+func NewCertReloader(certFile string, keyFile string) (cr *CertReloader, err error) {
+	cr = &CertReloader{certFile: certFile, keyFile: keyFile}
+	if _, err = cr.Reload(); err != nil {
+		err = fmt.Errorf("NewCertReloader: %w", err)
+	}
+	return
+}
+
+// modTimes returns when the certificate and key files last changed.
+func (cr *CertReloader) modTimes() (certMod time.Time, keyMod time.Time, err error) {
+	certInfo, err := os.Stat(cr.certFile)
+	if err != nil {
+		err = fmt.Errorf("modTimes: %w", err)
+		return
+	}
+	keyInfo, err := os.Stat(cr.keyFile)
+	if err != nil {
+		err = fmt.Errorf("modTimes: %w", err)
+		return
+	}
+	return certInfo.ModTime(), keyInfo.ModTime(), nil
+}
+
+// Reload loads the pair if either file changed since it was last loaded,
+// reporting whether it did.  The pair in use is kept if the new one is not
+// valid, as happens when only one of the files has been replaced yet.
+func (cr *CertReloader) Reload() (reloaded bool, err error) {
+	certMod, keyMod, err := cr.modTimes()
+	if err != nil {
+		err = fmt.Errorf("Reload: %w", err)
+		return
+	}
+	cr.mu.RLock()
+	unchanged := cr.cert != nil && certMod.Equal(cr.certMod) && keyMod.Equal(cr.keyMod)
+	cr.mu.RUnlock()
+	if unchanged {
+		return
+	}
+	cert, err := tls.LoadX509KeyPair(cr.certFile, cr.keyFile)
+	if err != nil {
+		err = fmt.Errorf("Reload: Error loading %s: %w", cr.certFile, err)
+		return
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		err = fmt.Errorf("Reload: Error parsing %s: %w", cr.certFile, err)
+		return
+	}
+	cr.mu.Lock()
+	cr.cert, cr.leaf, cr.certMod, cr.keyMod = &cert, leaf, certMod, keyMod
+	cr.mu.Unlock()
+	reloaded = true
+	return
+}
+
+// Run checks for a changed pair every interval, forever.
+func (cr *CertReloader) Run(interval time.Duration) {
+	for range time.Tick(interval) {
+		reloaded, err := cr.Reload()
+		if err != nil {
+			log.Println("CertReloader:", err.Error())
+		} else if reloaded {
+			log.Println("CertReloader: Loaded new certificate", cr.certFile, "valid until", cr.NotAfter().Format(time.RFC3339))
+		}
+	}
+}
+
+// GetCertificate returns the current pair, for tls.Config.
+func (cr *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.cert, nil
+}
+
+// NotAfter returns when the current certificate expires.
+func (cr *CertReloader) NotAfter() time.Time {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+	return cr.leaf.NotAfter
+}
+
+// NewTLSConfig serves the certificates of cr.  If clientCAFile is set,
+// clients may also present a certificate signed by one of its CAs, which
+// authenticates them like an API token.  Browsers without one still reach
+// the sign in page.
+func NewTLSConfig(cr *CertReloader, clientCAFile string) (cfg *tls.Config, err error) {
+	cfg = &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cr.GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+	if clientCAFile == "" {
+		return
+	}
+	pem, err := os.ReadFile(clientCAFile)
+	if err != nil {
+		err = fmt.Errorf("NewTLSConfig: Error reading client CAs: %w", err)
+		return
+	}
+	cfg.ClientCAs = x509.NewCertPool()
+	if !cfg.ClientCAs.AppendCertsFromPEM(pem) {
+		err = fmt.Errorf("NewTLSConfig: No certificates in %s", clientCAFile)
+		return
+	}
+	cfg.ClientAuth = tls.VerifyClientCertIfGiven
+	return
+}
+
+// clientCertName returns the common name of a verified client certificate,
+// if the request came with one.
+func clientCertName(req *http.Request) (name string, found bool) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return
+	}
+	name = req.TLS.VerifiedChains[0][0].Subject.CommonName
+	return name, name != ""
+}
+
+// redirectHTTPS sends plain HTTP requests to the same path on the HTTPS
+// listener at tlsAddr.
+func redirectHTTPS(tlsAddr string) http.HandlerFunc {
+	_, port, err := net.SplitHostPort(tlsAddr)
+	if err != nil || port == "443" {
+		port = ""
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host == "" {
+			http.Error(w, "Use HTTPS", http.StatusBadRequest)
+			return
+		}
+		if port != "" {
+			host = net.JoinHostPort(host, port)
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusMovedPermanently)
+	}
+}
+
+// registerCertMetrics adds a gauge of when the served certificate expires.
+func registerCertMetrics(reg *metrics.Registry, cr *CertReloader) {
+	reg.NewGaugeFunc("tlweb_tls_cert_expiry_timestamp_seconds",
+		"When the served TLS certificate expires, in Unix seconds.", nil,
+		func() []metrics.Sample {
+			return []metrics.Sample{{Value: float64(cr.NotAfter().Unix())}}
+		})
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+// testCert is a generated certificate and key, signed by parent or
+// self-signed if parent is nil.
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+func newTestCert(t *testing.T, name string, notAfter time.Time, isCA bool, parent *testCert) testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %s", err.Error())
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	signer, signerKey := tmpl, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %s", err.Error())
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return testCert{cert: cert, key: key, der: der}
+}
+
+// write saves the certificate and key as PEM files in dir.
+func (tc testCert) write(t *testing.T, dir string) (certFile string, keyFile string) {
+	keyDer, err := x509.MarshalECPrivateKey(tc.key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey: %s", err.Error())
+	}
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: tc.der}), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	return
+}
+
+func (tc testCert) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{tc.der}, PrivateKey: tc.key}
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := newTestCert(t, "tlweb", time.Now().Add(24*time.Hour), false, nil)
+	certFile, keyFile := first.write(t, dir)
+	cr, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %s", err.Error())
+	}
+	if reloaded, err := cr.Reload(); reloaded || err != nil {
+		t.Errorf("Unchanged files reloaded: %v %v", reloaded, err)
+	}
+
+	// A renewed certificate is picked up
+	renewed := newTestCert(t, "tlweb", time.Now().Add(90*24*time.Hour), false, nil)
+	renewed.write(t, dir)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if reloaded, err := cr.Reload(); !reloaded || err != nil {
+		t.Fatalf("Renewed certificate not reloaded: %v %v", reloaded, err)
+	}
+	if !cr.NotAfter().Equal(renewed.cert.NotAfter) {
+		t.Errorf("Expected expiry %s, got %s", renewed.cert.NotAfter, cr.NotAfter())
+	}
+
+	// A half written pair keeps the one in use
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+	later = later.Add(time.Minute)
+	os.Chtimes(keyFile, later, later)
+	if _, err := cr.Reload(); err == nil {
+		t.Error("Expected an invalid key to fail")
+	}
+	if cert, _ := cr.GetCertificate(nil); cert == nil || !cr.NotAfter().Equal(renewed.cert.NotAfter) {
+		t.Error("Certificate in use was dropped")
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "tempLogger CA", time.Now().Add(time.Hour), true, nil)
+	server := newTestCert(t, "tlweb", time.Now().Add(time.Hour), false, &ca)
+	logger := newTestCert(t, "logger1", time.Now().Add(time.Hour), false, &ca)
+	certFile, keyFile := server.write(t, dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.der}), 0600); err != nil {
+		t.Fatalf("WriteFile: %s", err.Error())
+	}
+
+	cr, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatalf("NewCertReloader: %s", err.Error())
+	}
+	cfg, err := NewTLSConfig(cr, caFile)
+	if err != nil {
+		t.Fatalf("NewTLSConfig: %s", err.Error())
+	}
+	tlWeb := TLWeb{AuthRequired: true, ClientCertRole: types.RoleViewer}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %s", err.Error())
+	}
+	srv := &http.Server{TLSConfig: cfg, Handler: tlWeb.Authorize(types.RoleViewer, func(w http.ResponseWriter, req *http.Request) {
+		if user := requestUser(req); user == nil || user.Name != "logger1" {
+			t.Errorf("Unexpected user: %+v", user)
+		}
+	})}
+	go srv.ServeTLS(listener, "", "")
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certs []tls.Certificate) int {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}}
+		resp, err := client.Get("https://" + listener.Addr().String() + "/api/v1/sensors")
+		if err != nil {
+			t.Fatalf("Get: %s", err.Error())
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := get([]tls.Certificate{logger.tlsCert()}); status != http.StatusOK {
+		t.Errorf("Expected %d with a client certificate, got %d", http.StatusOK, status)
+	}
+	if status := get(nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected %d without a client certificate, got %d", http.StatusUnauthorized, status)
+	}
+}
+
+func TestRedirectHTTPS(t *testing.T) {
+	for _, test := range []struct {
+		tlsAddr  string
+		host     string
+		location string
+	}{
+		{":443", "example.com", "https://example.com/weekly?sensor=sensor1"},
+		{":443", "example.com:80", "https://example.com/weekly?sensor=sensor1"},
+		{":8443", "example.com:8080", "https://example.com:8443/weekly?sensor=sensor1"},
+		{"[::]:8443", "[fe80::1]", "https://[fe80::1]:8443/weekly?sensor=sensor1"},
+		{":443", "[fe80::1]:80", "https://[fe80::1]/weekly?sensor=sensor1"},
+	} {
+		req := httptest.NewRequest("GET", "/weekly?sensor=sensor1", nil)
+		req.Host = test.host
+		w := httptest.NewRecorder()
+		redirectHTTPS(test.tlsAddr)(w, req)
+		if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != test.location {
+			t.Errorf("%s %s: Unexpected redirect: %d %s", test.tlsAddr, test.host, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
@@ -1,160 +1,316 @@
 package main
 
 import (
-	_ "embed"
 	"encoding/csv"
+	"errors"
 	"flag"
 	"fmt"
-	"html/template"
 	"io"
+	"io/fs"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"tempLogger/sdnotify"
+	"tempLogger/stats"
 	"tempLogger/types"
 	"time"
 )
 
 type TLWeb struct {
-	Tldb TLDB
-}
-
-//go:embed page.html
-var page string
-
-func NewSummary(tlData []types.THData) (summary types.TLSummary) {
-	tlDataCount := len(tlData)
-	var maxIndex, minIndex int
-	var maxValue, minValue float32
-	maxValue = -1000.0
-	minValue = 1000.0
-	if tlDataCount > 0 {
-		for i := 0; i < tlDataCount; i++ {
-			var tmpTemp types.TempRecord
-			err := tmpTemp.FromTHData(tlData[i])
-			if err != nil {
-				log.Println("NewTLPage: Error converting temp:", err.Error())
-			} else {
-				summary.TLData = append(summary.TLData, tmpTemp)
+	Tldb      TLDB
+	SensorCfg []types.SensorCfg
+	// Units is the default temperature unit, F if empty.
+	Units string
+	// Alerts evaluates the alert rules, if any are configured.
+	Alerts *AlertEngine
+	// LiveBroker pushes new readings to the page.
+	LiveBroker *LiveBroker
+	// Watchers follow the log directories.
+	Watchers []*Watcher
+	// Templates renders the pages, the embedded ones if nil.
+	Templates *Templates
+	// AuthRequired makes every page and API call need a signed in user or
+	// an API token.
+	AuthRequired bool
+	// DegreeDays are the bases of the statistics.
+	DegreeDays types.DegreeDayCfg
+	// ClientCertRole is the role of clients presenting a certificate signed
+	// by one of the -tls-client-ca authorities, such as loggers.
+	ClientCertRole string
+}
+
+// NewSummary computes the statistics and chart data of tlData, the
+// readings from begin to end, each standing for up to interval, with
+// temperatures in unit.
+func NewSummary(tlData []types.THData, unit string, begin time.Time, end time.Time, interval time.Duration) (summary types.TLSummary) {
+	windows := newSummaryWindows(begin, end, interval)
+	for _, thd := range tlData {
+		ts, err := time.Parse(time.RFC3339, thd.TimeStamp)
+		if err != nil {
+			log.Println("NewSummary: Error parsing timestamp:", err.Error())
+			continue
+		}
+		summary.TLData = append(summary.TLData, types.NewChartPoint(ts, thd, unit))
+		windows.add(ts, thd, unit)
+	}
+	windows.fill(&summary)
+	return
+}
+
+// summaryWindows hold the readings of each of types.SummaryMetrics.
+type summaryWindows []*stats.Window
+
+func newSummaryWindows(begin time.Time, end time.Time, interval time.Duration) summaryWindows {
+	windows := make(summaryWindows, len(types.SummaryMetrics))
+	for i := range windows {
+		windows[i] = stats.NewWindow(begin, end, interval, time.Duration(gapFactor*float64(interval)))
+	}
+	return windows
+}
+
+func (windows summaryWindows) add(ts time.Time, thd types.THData, unit string) {
+	for i, metric := range types.SummaryMetrics {
+		windows[i].Add(ts, float64(types.MetricValue(thd, metric.Name, unit)))
+	}
+}
+
+// fill sets the statistics of summary, which has none if there were no
+// readings.
+func (windows summaryWindows) fill(summary *types.TLSummary) {
+	summary.Metrics = make(map[string]types.MetricStats, len(types.SummaryMetrics))
+	if windows[0].Count() == 0 {
+		return
+	}
+	summary.Coverage = types.Round2(windows[0].Coverage())
+	for i, metric := range types.SummaryMetrics {
+		window := windows[i]
+		percentiles := window.Percentiles(5, 50, 95)
+		summary.Metrics[metric.Name] = types.MetricStats{
+			Max:    tempRecord(window.Max()),
+			Min:    tempRecord(window.Min()),
+			Last:   tempRecord(window.Last()),
+			Mean:   types.Round2(window.Mean()),
+			StdDev: types.Round2(window.StdDev()),
+			P5:     types.Round2(percentiles[0]),
+			Median: types.Round2(percentiles[1]),
+			P95:    types.Round2(percentiles[2]),
+		}
+	}
+}
+
+func tempRecord(sample stats.Sample) types.TempRecord {
+	return types.TempRecord{Date: sample.Time.UnixMilli(), Value: float32(sample.Value)}
+}
+
+// NewSensorSummary summarizes tlData and labels it with the sensor details.
+func NewSensorSummary(sensor types.SensorCfg, tlData []types.THData, unit string, begin time.Time, end time.Time, interval time.Duration) (summary types.TLSummary) {
+	summary = NewSummary(tlData, unit, begin, end, interval)
+	labelSummary(&summary, sensor)
+	return
+}
+
+func labelSummary(summary *types.TLSummary, sensor types.SensorCfg) {
+	summary.ID = sensor.ID
+	summary.Site = sensor.Site
+	summary.Name = sensor.Name
+	summary.Location = sensor.Location
+	summary.Color = sensor.Color
+}
+
+// RangeSummary summarizes the readings of sensor, taken every interval,
+// from begin to end.  The statistics are of every reading, so a short spike
+// is not lost, while the chart averages them into buckets of width step.
+func (tlweb TLWeb) RangeSummary(sensor types.SensorCfg, interval time.Duration, begin time.Time, end time.Time, step time.Duration, unit string) (summary types.TLSummary, err error) {
+	windows := newSummaryWindows(begin, end, interval)
+	raw := step < time.Second
+	if tlweb.Tldb.HasTable(sensor.ID) {
+		err = tlweb.Tldb.StreamRecords(sensor.ID, begin, end, func(thd types.THData) error {
+			ts, perr := time.Parse(time.RFC3339, thd.TimeStamp)
+			if perr != nil {
+				return perr
 			}
-			if tlData[i].TempF > maxValue {
-				maxValue = tlData[i].TempF
-				maxIndex = i
+			windows.add(ts, thd, unit)
+			if raw {
+				summary.TLData = append(summary.TLData, types.NewChartPoint(ts, thd, unit))
 			}
-			if tlData[i].TempF < minValue {
-				minValue = tlData[i].TempF
-				minIndex = i
+			return nil
+		})
+		if err == nil && !raw {
+			var chart []types.THData
+			chart, err = tlweb.Tldb.RetrieveAveraged(sensor.ID, begin, end, step)
+			for _, thd := range chart {
+				if ts, perr := time.Parse(time.RFC3339, thd.TimeStamp); perr == nil {
+					summary.TLData = append(summary.TLData, types.NewChartPoint(ts, thd, unit))
+				}
 			}
 		}
-		summary.MinTemp.FromTHData(tlData[minIndex])
-		summary.MaxTemp.FromTHData(tlData[maxIndex])
-		summary.LastTemp.FromTHData(tlData[tlDataCount-1])
+		if err != nil {
+			err = fmt.Errorf("RangeSummary: %w", err)
+		}
 	}
+	windows.fill(&summary)
+	labelSummary(&summary, sensor)
 	return
 }
 
-func NewTLPage(tldata []types.THData, tl2data []types.THData, outsideData []types.THData, page string) (tlPage types.TLPage) {
+// NewTLPage builds the page of the summaries of its sensors.
+func NewTLPage(summaries []types.TLSummary, page string, unit string) (tlPage types.TLPage) {
 	tlPage.Page = page
-	tlPage.Summaries = append(tlPage.Summaries, NewSummary(outsideData))
-	tlPage.Summaries = append(tlPage.Summaries, NewSummary(tldata))
-	tlPage.Summaries = append(tlPage.Summaries, NewSummary(tl2data))
+	tlPage.Unit = unit
+	tlPage.Units = types.Units
+	tlPage.Metrics = types.MetricsIn(unit)
+	tlPage.Summaries = summaries
 	return
 }
 
-func (tlweb TLWeb) ShowDB(w http.ResponseWriter, req *http.Request) {
-	end := time.Now()
-	begin := end.Add(-time.Hour * 24 * 2)
-	tlData, err := tlweb.Tldb.RetrieveRecords("sensor1", begin, end)
-	if err != nil {
-		log.Println("ShowDB: Error retrieving sensor1 data:", err.Error())
-	}
-	tl2Data, err := tlweb.Tldb.RetrieveRecords("sensor2", begin, end)
-	if err != nil {
-		log.Println("ShowDB: Error retrieving sensor2 data:", err.Error())
-	}
-	outsideData, err := tlweb.Tldb.RetrieveRecords("outside", begin, end)
-	if err != nil {
-		log.Println("ShowDB: Error retrieving outside data:", err.Error())
+// RequestUnits returns the temperature unit for req: the units query
+// parameter, then the units cookie, then the server default.  A units
+// parameter is remembered in the cookie.
+func (tlweb TLWeb) RequestUnits(w http.ResponseWriter, req *http.Request) (unit string, err error) {
+	if val := req.URL.Query().Get("units"); val != "" {
+		unit, err = types.ParseUnit(val)
+		if err != nil {
+			return
+		}
+		http.SetCookie(w, &http.Cookie{Name: "units", Value: unit, Path: "/",
+			MaxAge: 365 * 24 * 60 * 60, SameSite: http.SameSiteLaxMode})
+		return
 	}
-	log.Println("Daily", len(tlData), len(tl2Data), len(outsideData))
-	tlPage := NewTLPage(tlData, tl2Data, outsideData, "Daily")
-	//simple := "Hello, World!"
-	t, err := template.New("simple").Parse(page)
-	if err != nil {
-		log.Println("ShowDB: Error parsing template:", err.Error())
+	if cookie, cerr := req.Cookie("units"); cerr == nil {
+		if unit, cerr = types.ParseUnit(cookie.Value); cerr == nil {
+			return
+		}
 	}
-	err = t.Execute(w, tlPage)
-	if err != nil {
-		log.Println("ShowDB: Error executing template:", err.Error())
+	unit = tlweb.Units
+	if unit == "" {
+		unit = types.UnitF
 	}
+	return
 }
 
-func (tlweb TLWeb) ShowDBWeek(w http.ResponseWriter, req *http.Request) {
-	end := time.Now()
-	begin := end.Add(-time.Hour * 24 * 7)
-	tlData, err := tlweb.Tldb.RetrieveRecords("sensor1", begin, end)
-	if err != nil {
-		log.Println("ShowDBWeek: Error retrieving sensor1 data:", err.Error())
+// ShowRange renders the page for the period given by the range query
+// parameter, or by from and to, of the sensors at the site parameter or
+// every one.
+func (tlweb TLWeb) ShowRange(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path != "/" {
+		tlweb.templates().Error(w, req, http.StatusNotFound, "There is no page at "+req.URL.Path+".")
+		return
 	}
-	tl2Data, err := tlweb.Tldb.RetrieveRecords("sensor2", begin, end)
+	now := time.Now()
+	pr, err := parsePageRange(req.URL.Query(), now)
 	if err != nil {
-		log.Println("ShowDBWeek: Error retrieving sensor2 data:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusBadRequest, err.Error())
+		return
 	}
-	outsideData, err := tlweb.Tldb.RetrieveRecords("outside", begin, end)
+	unit, err := tlweb.RequestUnits(w, req)
 	if err != nil {
-		log.Println("ShowDBWeek: Error retrieving outside data:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusBadRequest, err.Error())
+		return
 	}
-	log.Println("Weekly", len(tlData), len(tl2Data), len(outsideData))
-	tlPage := NewTLPage(tlData, tl2Data, outsideData, "Weekly")
-	//simple := "Hello, World!"
-	t, err := template.New("simple").Parse(page)
+	res := chooseResolution(pr.End.Sub(pr.Begin))
+	all := tlweb.SensorList()
+	site, err := requestSite(req, all)
 	if err != nil {
-		log.Println("ShowDBWeek: Error parsing template:", err.Error())
+		tlweb.templates().Error(w, req, http.StatusNotFound, err.Error())
+		return
 	}
-	err = t.Execute(w, tlPage)
-	if err != nil {
-		log.Println("ShowDBWeek: Error executing template:", err.Error())
+	sensors := filterSite(all, site)
+	summaries := make([]types.TLSummary, len(sensors))
+	// Learning an interval reads the sensor's table, so it is done once
+	intervals := make([]time.Duration, len(sensors))
+	learned := make([]bool, len(sensors))
+	for i, sensor := range sensors {
+		intervals[i], learned[i] = tlweb.Tldb.SensorInterval(sensor)
+		summaries[i], err = tlweb.RangeSummary(sensor, intervals[i], pr.Begin, pr.End, res.Step, unit)
+		if err != nil {
+			log.Printf("ShowRange: Error retrieving %s data: %s\n", sensor.ID, err.Error())
+		}
+	}
+	log.Println(pr.Label, len(sensors), "sensors")
+	tlPage := NewTLPage(summaries, pr.Label, unit)
+	for i, sensor := range sensors {
+		tlweb.addFreshness(&tlPage.Summaries[i], sensor, intervals[i], learned[i], pr.Begin, pr.End, res.Step, now)
+	}
+	fillPageRange(&tlPage, pr, res, now)
+	tlPage.Site = site
+	tlPage.Sites = siteNames(all)
+	if site != "" {
+		tlPage.PrevURL += "&site=" + url.QueryEscape(site)
+		if tlPage.NextURL != "" {
+			tlPage.NextURL += "&site=" + url.QueryEscape(site)
+		}
 	}
+	tlweb.templates().Render(w, req, http.StatusOK, "range", tlPage)
 }
 
-func watchFiles(watchPath string, changedFile chan string, done chan bool) {
+// ShowWeekly keeps the old weekly page address working.
+func (tlweb TLWeb) ShowWeekly(w http.ResponseWriter, req *http.Request) {
+	http.Redirect(w, req, "/?range=7d", http.StatusMovedPermanently)
+}
+
+// matchPattern reports whether the file name matches pattern, a glob or a
+// tempLogger file pattern, which matches everything if empty.
+func matchPattern(pattern string, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	if types.IsFilePattern(pattern) {
+		re, err := types.FilePatternRegexp(pattern)
+		return err == nil && re.MatchString(name)
+	}
+	matched, _ := filepath.Match(pattern, name)
+	return matched
+}
+
+// watchFiles sends the path of each file moved into watchPath whose name
+// matches pattern to changedFile until inotifywait exits.
+func watchFiles(watchPath string, pattern string, changedFile chan string) (err error) {
 	cmd := exec.Command("/usr/bin/inotifywait", "-qmrc", "-e", "moved_to", watchPath)
 
 	sout, err := cmd.StdoutPipe()
 	if err != nil {
-		log.Println("watchFiles: Error establishing stdout pipe:", err.Error())
-		done <- true
-		close(changedFile)
+		err = fmt.Errorf("watchFiles: Error establishing stdout pipe: %w", err)
 		return
 	}
 
 	serr, err := cmd.StderrPipe()
 	if err != nil {
-		log.Println("watchFiles: Error establishing stderr pipe:", err.Error())
-		done <- true
-		close(changedFile)
+		err = fmt.Errorf("watchFiles: Error establishing stderr pipe: %w", err)
 		return
 	}
 
 	err = cmd.Start()
 	if err != nil {
-		log.Println("watchFiles: Error starting inotifywait:", err.Error())
-		done <- true
-		close(changedFile)
+		err = fmt.Errorf("watchFiles: Error starting inotifywait: %w", err)
 		return
 	}
 
 	cReader := csv.NewReader(sout)
-	for err == nil {
-		fields, err := cReader.Read()
-		if err != nil {
-			continue
+	cReader.FieldsPerRecord = -1
+	for {
+		fields, rerr := cReader.Read()
+		if rerr != nil {
+			var parseErr *csv.ParseError
+			if errors.As(rerr, &parseErr) {
+				log.Println("watchFiles: Unexpected output:", rerr.Error())
+				continue
+			}
+			err = rerr
+			break
 		}
 		if len(fields) != 3 {
 			log.Println("watchFiles: Unexpected record:", fields)
 			continue
 		}
-		changedFile <- fields[0] + fields[2]
+		if matchPattern(pattern, fields[2]) {
+			changedFile <- fields[0] + fields[2]
+		}
 	}
 	if err == io.EOF {
 		log.Println("watchFiles: inotifywait completed with an unknown error.")
@@ -162,72 +318,347 @@ func watchFiles(watchPath string, changedFile chan string, done chan bool) {
 		log.Println("watchFiles: inotifywait error:", err.Error())
 	}
 
-	serrData, err := io.ReadAll(serr)
-	if err != nil {
-		log.Println("watchFiles: Error reading stderr:", err.Error())
+	serrData, rerr := io.ReadAll(serr)
+	if rerr != nil {
+		log.Println("watchFiles: Error reading stderr:", rerr.Error())
 	}
-	if err := cmd.Wait(); err != nil {
-		log.Println("watchFiles: Error with inotifywait execution:", err.Error())
+	if werr := cmd.Wait(); werr != nil {
 		log.Println("StdErr:", string(serrData))
+		err = fmt.Errorf("watchFiles: Error with inotifywait execution: %w", werr)
+		return
 	}
+	err = fmt.Errorf("watchFiles: inotifywait exited: %w", err)
+	return
+}
+
+const (
+	watcherMinBackoff = time.Second
+	watcherMaxBackoff = time.Minute
+)
+
+// Watcher keeps watchFiles running on one path, restarting it with a
+// growing delay when it exits.
+type Watcher struct {
+	Path string
+	// Pattern is a glob the names of the files loaded must match, all of
+	// them if empty.
+	Pattern string
+	// mu guards the fields below, which the health checks read.
+	mu      sync.Mutex
+	running bool
+	// since is when running last changed.
+	since    time.Time
+	restarts int
+	lastErr  error
+}
 
-	done <- true
-	close(changedFile)
+func NewWatcher(path string) *Watcher {
+	return &Watcher{Path: path, since: time.Now()}
 }
 
-func updateDatabase(changedFile chan string, done chan bool, tldb TLDB) {
+// Run watches the path forever.
+func (wt *Watcher) Run(changedFile chan string) {
+	backoff := watcherMinBackoff
 	for {
-		select {
-		case file := <-changedFile:
-			log.Println("File", file, "has been modified.")
-			err := tldb.InsertLog(file)
+		wt.setRunning(true, nil)
+		started := time.Now()
+		err := watchFiles(wt.Path, wt.Pattern, changedFile)
+		wt.setRunning(false, err)
+		log.Printf("Watcher: %s: %s\n", wt.Path, err.Error())
+		if time.Since(started) > watcherMaxBackoff {
+			backoff = watcherMinBackoff
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, watcherMaxBackoff)
+		watcherRestarts.Inc(wt.Path)
+		wt.mu.Lock()
+		wt.restarts++
+		wt.mu.Unlock()
+	}
+}
+
+// ImportExisting sends the files already in the path whose names match
+// the pattern to changedFile, in name order.
+func (wt *Watcher) ImportExisting(changedFile chan string) (err error) {
+	err = filepath.WalkDir(wt.Path, func(path string, d fs.DirEntry, werr error) error {
+		if werr != nil {
+			return werr
+		}
+		if !d.IsDir() && matchPattern(wt.Pattern, d.Name()) {
+			changedFile <- path
+		}
+		return nil
+	})
+	if err != nil {
+		err = fmt.Errorf("ImportExisting: %w", err)
+	}
+	return
+}
+
+func (wt *Watcher) setRunning(running bool, err error) {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	wt.running = running
+	wt.since = time.Now()
+	if err != nil {
+		wt.lastErr = err
+	}
+}
+
+// Alive reports whether inotifywait is running, since when it has been
+// running or stopped, and the error it last exited with.
+func (wt *Watcher) Alive() (alive bool, since time.Time, lastErr error) {
+	wt.mu.Lock()
+	defer wt.mu.Unlock()
+	return wt.running, wt.since, wt.lastErr
+}
+
+func updateDatabase(changedFile chan string, tldb TLDB, alerts *AlertEngine, live *LiveBroker, watch []types.WatchCfg) {
+	for file := range changedFile {
+		log.Println("File", file, "has been modified.")
+		result, err := tldb.ImportSiteLog(file, watchSite(watch, file))
+		if err != nil {
+			log.Printf("updateDatabase: Error loading log: %s: %s\n", file, err.Error())
+		}
+		log.Println(len(result.Inserted), "new records,", result.Duplicates, "duplicates,", result.ParseErrors, "errors.")
+		alerts.Evaluate(result.Inserted)
+		live.PublishInserted(tldb, result.Inserted)
+		for _, key := range tldb.Sensors() {
+			rowCnt, err := tldb.RecordCount(key)
 			if err != nil {
-				log.Printf("updateDatabase: Error loading log: %s: %s\n", file, err.Error())
-			}
-			for key := range tldb.Tables {
-				rowCnt, err := tldb.RecordCount(key)
-				if err != nil {
-					log.Printf("updateDatabase: %s\n", err.Error())
-				} else {
-					log.Println(key, "has", rowCnt, "records.")
-				}
+				log.Printf("updateDatabase: %s\n", err.Error())
+			} else {
+				log.Println(key, "has", rowCnt, "records.")
 			}
-		case <-done:
-			return
 		}
 	}
 }
 
+// watchSite returns the site of the watch directory file is in, if it has
+// one.
+func watchSite(watch []types.WatchCfg, file string) string {
+	for _, wc := range watch {
+		rel, err := filepath.Rel(wc.Path, file)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return wc.Site
+		}
+	}
+	return ""
+}
+
 const swVer = "4"
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		if err := exportCmd(os.Args[2:]); err != nil {
+			log.Fatalln("Error exporting records:", err.Error())
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		if err := userCmd(os.Args[2:], os.Stdin, os.Stdout); err != nil {
+			log.Fatalln("Error managing users:", err.Error())
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "token" {
+		if err := tokenCmd(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalln("Error managing API tokens:", err.Error())
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "config" {
+		if err := configCmd(os.Args[2:], os.Stdout); err != nil {
+			log.Fatalln("Error checking configuration:", err.Error())
+		}
+		return
+	}
+
 	fmt.Println("tlweb, Version", swVer)
-	addr := flag.String("addr", ":8080", "http service address")
+	cfgPath := flag.String("config", os.Getenv("TLWEB_CONFIG"), "Path to a JSON configuration file; TLWEB_* variables and these flags override it")
+	dbPath := flag.String("db", defaultDbPath, "Path to the database")
+	addr := flag.String("addr", defaultAddr, "http service address")
+	units := flag.String("units", types.UnitF, "Default temperature units: F, C or K")
+	sensorCfg := flag.String("sensors", "", "Path to a JSON file of sensor names, locations, colors and order")
+	alertCfg := flag.String("alerts", "", "Path to a JSON file of alert rules and notification channels")
+	auth := flag.Bool("auth", false, "Require users to sign in, or API clients to send a token; manage them with tlweb user and tlweb token")
+	devTemplates := flag.String("dev-templates", "", "Directory to reload page templates from on every request, such as tlweb/templates, for UI work")
+	tlsCert := flag.String("tls-cert", "", "Path to a PEM certificate chain to serve HTTPS with; reloaded when it changes")
+	tlsKey := flag.String("tls-key", "", "Path to the PEM private key of -tls-cert")
+	tlsClientCA := flag.String("tls-client-ca", "", "Path to PEM CA certificates whose client certificates authenticate like an API token")
+	tlsClientRole := flag.String("tls-client-role", types.RoleViewer, "Role of clients authenticated by a certificate: viewer, ingest or admin")
+	redirectAddr := flag.String("redirect-addr", "", "Address to redirect plain HTTP from to the HTTPS -addr, such as :80")
 	flag.Parse()
 
-	args := flag.Args()
-	if len(args) == 0 {
-		log.Fatalln("Must have at least one datapath as an argument")
-		os.Exit(1)
+	cfg, err := loadWebCfg(*cfgPath, os.LookupEnv)
+	if err != nil {
+		log.Fatalln("Error loading configuration:", err.Error())
+	}
+	// Flags given on the command line override the file and environment
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "db":
+			cfg.DB = *dbPath
+		case "addr":
+			cfg.Addr = *addr
+		case "units":
+			cfg.Units = *units
+		case "auth":
+			cfg.Auth = *auth
+		case "tls-cert":
+			cfg.TLS.Cert = *tlsCert
+		case "tls-key":
+			cfg.TLS.Key = *tlsKey
+		case "tls-client-ca":
+			cfg.TLS.ClientCA = *tlsClientCA
+		case "tls-client-role":
+			cfg.TLS.ClientRole = *tlsClientRole
+		case "redirect-addr":
+			cfg.TLS.RedirectAddr = *redirectAddr
+		}
+	})
+	if *sensorCfg != "" {
+		cfg.Sensors, err = LoadSensorCfg(*sensorCfg)
+		if err != nil {
+			log.Fatalln("Error loading sensor configuration:", err.Error())
+		}
+	}
+	if *alertCfg != "" {
+		cfg.Alerts, err = LoadAlertCfg(*alertCfg)
+		if err != nil {
+			log.Fatalln("Error loading alert configuration:", err.Error())
+		}
+	}
+	if args := flag.Args(); len(args) > 0 {
+		cfg.Watch = nil
+		for _, path := range args {
+			cfg.Watch = append(cfg.Watch, types.WatchCfg{Path: path})
+		}
+	}
+	if err = finishWebCfg(&cfg); err != nil {
+		log.Fatalln("Invalid configuration:", err.Error())
 	}
-	done := make(chan bool, 1)
 	changedFile := make(chan string, 10)
 
-	tldb, err := NewDB(defaultDbPath)
+	tldb, err := NewDB(cfg.DB)
 	if err != nil {
 		log.Fatalln("Error opening database:", err.Error())
 	}
+	alertEngine, err := NewAlertEngine(tldb, cfg.Alerts)
+	if err != nil {
+		log.Fatalln("Error starting alerts:", err.Error())
+	}
 	// Watch files from multiple paths
-	for _, val := range args {
-		go watchFiles(val, changedFile, done)
+	var watchers []*Watcher
+	for _, watch := range cfg.Watch {
+		watcher := NewWatcher(watch.Path)
+		watcher.Pattern = watch.Pattern
+		watchers = append(watchers, watcher)
+		if watch.ImportExisting {
+			go func() {
+				if err := watcher.ImportExisting(changedFile); err != nil {
+					log.Println("Error importing existing files:", err.Error())
+				}
+			}()
+		}
+		go watcher.Run(changedFile)
 	}
-	go updateDatabase(changedFile, done, tldb)
+	liveBroker := NewLiveBroker()
+	go updateDatabase(changedFile, tldb, alertEngine, liveBroker, cfg.Watch)
+	go alertEngine.WatchNoData(time.Minute)
+	if cfg.Retention.Days > 0 || len(cfg.Retention.Sensors) > 0 {
+		go runRetention(tldb, cfg.Retention, retentionInterval)
+	}
+	registerReadingMetrics(registry, tldb)
 
-	tlWeb := TLWeb{Tldb: tldb}
-	// http.HandleFunc("/ws", ctx.WsHandler)
-	http.HandleFunc("/", tlWeb.ShowDB)
-	http.HandleFunc("/weekly", tlWeb.ShowDBWeek)
+	tlWeb := TLWeb{Tldb: tldb, SensorCfg: cfg.Sensors, Units: cfg.Units, DegreeDays: cfg.DegreeDays, Alerts: alertEngine, LiveBroker: liveBroker, Watchers: watchers}
+	if cfg.Auth {
+		users, err := tldb.Users()
+		if err != nil {
+			log.Fatalln("Error reading users:", err.Error())
+		}
+		if len(users) == 0 {
+			log.Fatalln("-auth needs a user; add one with: tlweb user add -role admin NAME")
+		}
+		tlWeb.AuthRequired = true
+	}
+	if cfg.TLS.ClientCA != "" {
+		tlWeb.ClientCertRole = cfg.TLS.ClientRole
+	}
+	if *devTemplates != "" {
+		tlWeb.Templates, err = NewTemplates(*devTemplates)
+		if err != nil {
+			log.Fatalln("Error loading templates:", err.Error())
+		}
+	}
+	// Routes with no role are open to everyone; the rest need that role to
+	// read, and admin to change anything, when -auth is set.  Loggers with
+	// the ingest role may only send readings.
+	routes := []struct {
+		pattern string
+		role    string
+		handler http.HandlerFunc
+	}{
+		{"/", types.RoleViewer, tlWeb.ShowRange},
+		{"/weekly", types.RoleViewer, tlWeb.ShowWeekly},
+		{"/alerts", types.RoleViewer, tlWeb.ShowAlerts},
+		{"/sites", types.RoleViewer, tlWeb.ShowSites},
+		{"/stats", types.RoleViewer, tlWeb.ShowStats},
+		{"/login", "", tlWeb.Login},
+		{"/logout", "", tlWeb.Logout},
+		{"/api/v1/alerts", types.RoleViewer, tlWeb.APIAlerts},
+		{"/api/v1/export", types.RoleViewer, tlWeb.Export},
+		{"/api/v1/sensors", types.RoleViewer, tlWeb.APISensors},
+		{"/api/v1/sensors/", types.RoleViewer, tlWeb.APISensor},
+		{"/api/v1/readings", types.RoleViewer, tlWeb.APIReadings},
+		{"/api/v1/summaries", types.RoleViewer, tlWeb.APISummaries},
+		{"/api/v1/latest", types.RoleViewer, tlWeb.APILatest},
+		{"/api/v1/sites", types.RoleViewer, tlWeb.APISites},
+		{"/api/v1/stats", types.RoleViewer, tlWeb.APIStats},
+		{"/api/v1/gaps", types.RoleViewer, tlWeb.APIGaps},
+		{"/api/v1/live", types.RoleViewer, tlWeb.APILive},
+		{types.IngestPath, types.RoleIngest, tlWeb.Ingest},
+		{"/api/v1/openapi.json", "", tlWeb.OpenAPI},
+		{"/static/", "", ServeStatic},
+	}
+	for _, route := range routes {
+		http.HandleFunc(route.pattern, instrument(route.pattern, tlWeb.Authorize(route.role, route.handler)))
+	}
+	http.HandleFunc("/metrics", tlWeb.Authorize(types.RoleViewer, registry.Handler().ServeHTTP))
+	http.HandleFunc("/healthz", tlWeb.Healthz)
+	http.HandleFunc("/readyz", tlWeb.Readyz)
 
-	log.Fatal(http.ListenAndServe(*addr, nil))
+	// Listen before telling systemd the service is ready
+	listener, err := net.Listen("tcp", cfg.Addr)
+	if err != nil {
+		log.Fatalln("Error listening on", cfg.Addr, ":", err.Error())
+	}
+	server := &http.Server{}
+	if cfg.TLS.Cert != "" {
+		certs, err := NewCertReloader(cfg.TLS.Cert, cfg.TLS.Key)
+		if err != nil {
+			log.Fatalln("Error loading certificate:", err.Error())
+		}
+		server.TLSConfig, err = NewTLSConfig(certs, cfg.TLS.ClientCA)
+		if err != nil {
+			log.Fatalln("Error configuring TLS:", err.Error())
+		}
+		registerCertMetrics(registry, certs)
+		go certs.Run(certReloadInterval)
+	}
+	if cfg.TLS.RedirectAddr != "" {
+		go func() {
+			log.Fatal(http.ListenAndServe(cfg.TLS.RedirectAddr, redirectHTTPS(cfg.Addr)))
+		}()
+	}
+	if _, err = sdnotify.Notify(sdnotify.Ready); err != nil {
+		log.Println("Error notifying systemd:", err.Error())
+	}
+	go sdnotify.RunWatchdog(tlWeb.healthy)
+	if server.TLSConfig != nil {
+		log.Fatal(server.ServeTLS(listener, "", ""))
+	}
+	log.Fatal(server.Serve(listener))
 
 }
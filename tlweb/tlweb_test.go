@@ -0,0 +1,180 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"tempLogger/types"
+	"testing"
+	"time"
+)
+
+func TestNewSummary(t *testing.T) {
+	tlData := []types.THData{
+		{TimeStamp: "2024-01-14T00:00:00Z", Humidity: 40, TempF: 50, HeatIndexF: 48},
+		{TimeStamp: "2024-01-14T00:02:00Z", Humidity: 60, TempF: 45, HeatIndexF: 44},
+		{TimeStamp: "bad timestamp", Humidity: 99, TempF: 99, HeatIndexF: 99},
+		{TimeStamp: "2024-01-14T00:04:00Z", Humidity: 50, TempF: 47, HeatIndexF: 46},
+	}
+	begin := time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC)
+	summary := NewSummary(tlData, types.UnitF, begin, begin.Add(6*time.Minute), 2*time.Minute)
+	if len(summary.TLData) != 3 {
+		t.Fatalf("Incorrect number of chart points: Expected %d, Actual %d", 3, len(summary.TLData))
+	}
+	expected := map[string][3]float32{
+		"temp":      {50, 45, 47},
+		"humidity":  {60, 40, 50},
+		"heatIndex": {48, 44, 46},
+	}
+	for metric, vals := range expected {
+		stats, ok := summary.Metrics[metric]
+		if !ok {
+			t.Errorf("Missing %s statistics", metric)
+			continue
+		}
+		if stats.Max.Value != vals[0] || stats.Min.Value != vals[1] || stats.Last.Value != vals[2] {
+			t.Errorf("%s: Expected max/min/last %v, Actual %g/%g/%g", metric, vals,
+				stats.Max.Value, stats.Min.Value, stats.Last.Value)
+		}
+	}
+	if summary.TLData[1].Humidity != 60 || summary.TLData[1].HeatIndex != 44 {
+		t.Errorf("Unexpected chart point: %+v", summary.TLData[1])
+	}
+	for _, metric := range []string{types.MetricDewPoint, types.MetricAbsHumidity, types.MetricVPD} {
+		if _, ok := summary.Metrics[metric]; !ok {
+			t.Errorf("Missing %s statistics", metric)
+		}
+	}
+
+	// Each reading stands for two minutes of the six
+	temp := summary.Metrics["temp"]
+	if temp.Mean != 47.33 || temp.Median != 47 || temp.P5 != 45 || temp.P95 != 50 || temp.StdDev != 2.05 || summary.Coverage != 100 {
+		t.Errorf("Unexpected temperature statistics: %+v, coverage %g", temp, summary.Coverage)
+	}
+
+	// A burst of readings counts for the ten seconds it covers, and a gap
+	// for nothing
+	burst := NewSummary([]types.THData{
+		{TimeStamp: "2024-01-14T00:00:00Z", TempF: 40},
+		{TimeStamp: "2024-01-14T00:02:00Z", TempF: 40},
+		{TimeStamp: "2024-01-14T00:03:50Z", TempF: 80},
+		{TimeStamp: "2024-01-14T00:03:55Z", TempF: 80},
+		{TimeStamp: "2024-01-14T00:04:00Z", TempF: 40},
+		{TimeStamp: "2024-01-14T00:16:00Z", TempF: 40},
+	}, types.UnitF, begin, begin.Add(20*time.Minute), 2*time.Minute)
+	if temp := burst.Metrics["temp"]; temp.Mean != 40.83 || temp.Max.Value != 80 || burst.Coverage != 40 {
+		t.Errorf("Unexpected statistics of a burst: %+v, coverage %g", temp, burst.Coverage)
+	}
+
+	empty := NewSummary(nil, types.UnitF, begin, begin.Add(time.Hour), 2*time.Minute)
+	if len(empty.TLData) != 0 || len(empty.Metrics) != 0 {
+		t.Error("Expected an empty summary")
+	}
+}
+
+func TestInsertRecordHeatIndex(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	thd := types.THData{ID: "sensor1", TimeStamp: "2024-07-01T12:00:00Z", Humidity: 50, TempC: 32.2, TempF: 90}
+	if err := tldb.InsertRecord(thd); err != nil {
+		t.Fatalf("Could not insert record: %s", err.Error())
+	}
+	thd, found, err := tldb.LatestRecord("sensor1")
+	if err != nil || !found {
+		t.Fatalf("Could not read latest record: %v", err)
+	}
+	if thd.HeatIndexF < 94 || thd.HeatIndexF > 96 {
+		t.Errorf("Expected a computed heat index near 95 F, Actual %g", thd.HeatIndexF)
+	}
+}
+
+func TestRequestUnits(t *testing.T) {
+	tlWeb := TLWeb{Units: types.UnitC}
+	tests := []struct {
+		url    string
+		cookie string
+		unit   string
+	}{
+		{"/", "", types.UnitC},
+		{"/", "K", types.UnitK},
+		{"/", "bogus", types.UnitC},
+		{"/?units=f", "K", types.UnitF},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest("GET", test.url, nil)
+		if test.cookie != "" {
+			req.AddCookie(&http.Cookie{Name: "units", Value: test.cookie})
+		}
+		w := httptest.NewRecorder()
+		unit, err := tlWeb.RequestUnits(w, req)
+		if err != nil || unit != test.unit {
+			t.Errorf("%s with cookie %q: Expected %s, Actual %s (%v)", test.url, test.cookie, test.unit, unit, err)
+		}
+	}
+	w := httptest.NewRecorder()
+	tlWeb.RequestUnits(w, httptest.NewRequest("GET", "/?units=K", nil))
+	if cookie := w.Result().Cookies(); len(cookie) != 1 || cookie[0].Value != "K" {
+		t.Errorf("Expected a units cookie, got %v", cookie)
+	}
+	if _, err := tlWeb.RequestUnits(httptest.NewRecorder(), httptest.NewRequest("GET", "/?units=R", nil)); err == nil {
+		t.Error("Expected an error for unknown units")
+	}
+
+	summary := NewSummary([]types.THData{{TimeStamp: "2024-01-14T00:00:00Z", TempC: 0, TempF: 32, HeatIndexC: -2, HeatIndexF: 28.4}}, types.UnitK,
+		time.Date(2024, time.January, 14, 0, 0, 0, 0, time.UTC), time.Date(2024, time.January, 14, 1, 0, 0, 0, time.UTC), 2*time.Minute)
+	if temp := summary.Metrics["temp"].Last.Value; temp < 273.14 || temp > 273.16 {
+		t.Errorf("Expected 273.15 K, Actual %g", temp)
+	}
+	if hi := summary.TLData[0].HeatIndex; hi < 271.14 || hi > 271.16 {
+		t.Errorf("Expected a heat index of 271.15 K, Actual %g", hi)
+	}
+}
+
+func TestRangeSummarySpike(t *testing.T) {
+	tldb := newTestDB(t)
+	defer tldb.Close()
+
+	// A week of readings every minute at 20 C, with one at 40 C
+	begin := time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC)
+	spike := begin.Add(3*24*time.Hour + 90*time.Minute + 7*time.Minute)
+	var records []types.THData
+	for ts := begin.Add(time.Minute); ts.Before(begin.AddDate(0, 0, 7)); ts = ts.Add(time.Minute) {
+		tempC := float32(20)
+		if ts.Equal(spike) {
+			tempC = 40
+		}
+		records = append(records, types.THData{ID: "spike1", TimeStamp: ts.Format(time.RFC3339), TempC: tempC, TempF: tempC*9/5 + 32, Humidity: 50})
+	}
+	if _, err := tldb.ImportRecords(records); err != nil {
+		t.Fatalf("ImportRecords: %s", err.Error())
+	}
+	tlWeb := TLWeb{Tldb: tldb}
+	sensor := types.SensorCfg{ID: "spike1", Name: "Spike"}
+	res := chooseResolution(7 * 24 * time.Hour)
+	interval, _ := tldb.SensorInterval(sensor)
+	summary, err := tlWeb.RangeSummary(sensor, interval, begin, begin.AddDate(0, 0, 7), res.Step, types.UnitC)
+	if err != nil {
+		t.Fatalf("RangeSummary: %s", err.Error())
+	}
+	// The spike is averaged away in the chart but kept in the statistics
+	if temp := summary.Metrics["temp"]; temp.Max.Value != 40 || temp.Max.Date != spike.UnixMilli() || temp.Min.Value != 20 {
+		t.Errorf("Expected the spike as the maximum, got %+v", temp)
+	}
+	if len(summary.TLData) == 0 || len(summary.TLData) >= len(records) {
+		t.Fatalf("Expected averaged chart points, got %d", len(summary.TLData))
+	}
+	for _, point := range summary.TLData {
+		if point.Temp >= 40 {
+			t.Errorf("Expected the chart to be averaged, got %+v", point)
+		}
+	}
+	if summary.Name != "Spike" || summary.Coverage < 99 {
+		t.Errorf("Unexpected summary: %s, coverage %g", summary.Name, summary.Coverage)
+	}
+
+	// A sensor without readings keeps its label
+	empty, err := tlWeb.RangeSummary(types.SensorCfg{ID: "nosuch", Name: "None"}, defaultInterval, begin, begin.AddDate(0, 0, 7), res.Step, types.UnitC)
+	if err != nil || empty.Name != "None" || len(empty.Metrics) != 0 || len(empty.TLData) != 0 {
+		t.Errorf("Unexpected empty summary: %+v %v", empty, err)
+	}
+}
@@ -0,0 +1,107 @@
+package types
+
+// Alert rule kinds
+const (
+	AlertAbove  = "above"
+	AlertBelow  = "below"
+	AlertRate   = "rate"
+	AlertNoData = "nodata"
+)
+
+// Alert states
+const (
+	AlertOK      = "ok"
+	AlertPending = "pending"
+	AlertFiring  = "firing"
+)
+
+// Notification channel types
+const (
+	ChannelWebhook = "webhook"
+	ChannelSMTP    = "smtp"
+	ChannelCommand = "command"
+)
+
+// AlertCfg is the contents of the alert configuration file.
+type AlertCfg struct {
+	Channels []AlertChannel `json:"channels"`
+	Rules    []AlertRule    `json:"rules"`
+}
+
+// AlertRule describes a condition on the readings of one sensor, or of every
+// sensor if Sensor is empty.
+type AlertRule struct {
+	Name   string `json:"name"`
+	Sensor string `json:"sensor,omitempty"`
+	// Metric is any of SummaryMetrics, temp if empty.  It is not used by
+	// nodata rules.
+	Metric string `json:"metric,omitempty"`
+	// Units are the temperature units of Threshold and Hysteresis, F if
+	// empty.
+	Units string `json:"units,omitempty"`
+	Kind  string `json:"kind"`
+	// Threshold is the limit for above and below rules.  For rate rules it
+	// is the change per hour: positive for rises, negative for falls.
+	Threshold float32 `json:"threshold"`
+	// Hysteresis is how far back past the threshold a firing rule must
+	// return before it clears.
+	Hysteresis float32 `json:"hysteresis,omitempty"`
+	// ForMinutes is how long the condition must hold before the rule
+	// fires.  For nodata rules it is the silence that triggers the rule.
+	ForMinutes int `json:"forMinutes,omitempty"`
+	// WindowMinutes is the period a rate of change is measured over, 30
+	// if zero.
+	WindowMinutes int `json:"windowMinutes,omitempty"`
+	// Channels are the names of the channels notified when the rule fires
+	// or clears.
+	Channels []string `json:"channels,omitempty"`
+}
+
+// AlertChannel is a destination for alert notifications.  Only the fields
+// of its Type are used.
+type AlertChannel struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	// webhook
+	URL string `json:"url,omitempty"`
+	// smtp
+	Host     string   `json:"host,omitempty"`
+	Port     int      `json:"port,omitempty"`
+	Username string   `json:"username,omitempty"`
+	Password string   `json:"password,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       []string `json:"to,omitempty"`
+	// command
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+}
+
+// AlertStatus is the current state of a rule for one sensor.
+type AlertStatus struct {
+	Rule   string `json:"rule"`
+	Sensor string `json:"sensor"`
+	State  string `json:"state"`
+	// Since is when the rule entered State, Unix milliseconds.
+	Since int64   `json:"since"`
+	Value float32 `json:"value"`
+	// Updated is the time of the last reading evaluated, Unix milliseconds.
+	Updated int64 `json:"updated"`
+}
+
+// AlertEvent records a rule firing or clearing.
+type AlertEvent struct {
+	Rule    string  `json:"rule"`
+	Sensor  string  `json:"sensor"`
+	State   string  `json:"state"`
+	Value   float32 `json:"value"`
+	Date    int64   `json:"date"`
+	Message string  `json:"message"`
+}
+
+// AlertsPage holds the alert rules with their current states and recent
+// history.
+type AlertsPage struct {
+	Rules    []AlertRule   `json:"rules"`
+	Statuses []AlertStatus `json:"statuses"`
+	Events   []AlertEvent  `json:"events"`
+}
@@ -0,0 +1,43 @@
+package types
+
+import "time"
+
+const (
+	// RoleViewer may read the pages and the API.
+	RoleViewer = "viewer"
+	// RoleAdmin may also change the sensor configuration and anything else
+	// written through the API.
+	RoleAdmin = "admin"
+	// RoleIngest may only send readings to IngestPath, for loggers.
+	RoleIngest = "ingest"
+)
+
+// User is a person or API client allowed to use tlweb.
+type User struct {
+	Name string `json:"name"`
+	Role string `json:"role"`
+	// Token is set when the user is an API token or client certificate
+	// rather than a login.
+	Token bool `json:"token,omitempty"`
+	// Site limits an API token to sending the readings of one site.
+	Site    string    `json:"site,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// APIToken is a long lived credential for scripts, such as ingestion and
+// export clients.  The token itself is only shown when it is created.
+type APIToken struct {
+	ID       int64     `json:"id"`
+	Name     string    `json:"name"`
+	Role     string    `json:"role"`
+	Site     string    `json:"site,omitempty"`
+	Created  time.Time `json:"created"`
+	LastUsed time.Time `json:"lastUsed"`
+}
+
+// LoginPage is the sign in form.
+type LoginPage struct {
+	Name  string
+	Next  string
+	Error string
+}
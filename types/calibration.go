@@ -0,0 +1,62 @@
+package types
+
+import (
+	"sort"
+	"time"
+)
+
+// Calibration metrics.  Temperature offsets are in degrees Celsius and the
+// Fahrenheit value is derived from the corrected Celsius value.
+const (
+	MetricTemp     = "temp"
+	MetricHumidity = "humidity"
+)
+
+// Calibration is a linear correction, value*Scale + Offset, for one metric of
+// a sensor.  It applies to readings from Effective until the next
+// calibration of the same metric.
+type Calibration struct {
+	Metric    string    `json:"metric"`
+	Offset    float32   `json:"offset"`
+	Scale     float32   `json:"scale"`
+	Effective time.Time `json:"effective"`
+}
+
+func (cal Calibration) Apply(value float32) float32 {
+	return value*cal.Scale + cal.Offset
+}
+
+// SortCalibrations orders cals by effective time, which Calibrate relies on.
+func SortCalibrations(cals []Calibration) {
+	sort.SliceStable(cals, func(i, j int) bool {
+		return cals[i].Effective.Before(cals[j].Effective)
+	})
+}
+
+// Calibrate corrects thd, taken at ts, using the calibrations in effect at
+// that time, and recomputes the heat index from the corrected values.  cals
+// must be sorted by effective time.
+func (thd *THData) Calibrate(cals []Calibration, ts time.Time) {
+	var temp, humidity *Calibration
+	for i := range cals {
+		if cals[i].Effective.After(ts) {
+			break
+		}
+		switch cals[i].Metric {
+		case MetricTemp:
+			temp = &cals[i]
+		case MetricHumidity:
+			humidity = &cals[i]
+		}
+	}
+	if temp != nil {
+		thd.TempC = temp.Apply(thd.TempC)
+		thd.TempF = thd.TempC*9/5 + 32
+	}
+	if humidity != nil {
+		thd.Humidity = min(max(humidity.Apply(thd.Humidity), 0), 100)
+	}
+	if temp != nil || humidity != nil {
+		thd.setHeatIndex()
+	}
+}
@@ -0,0 +1,70 @@
+package types
+
+// WebCfg is the contents of the tlweb configuration file.  Every field is
+// optional; environment variables and then command line flags override it.
+type WebCfg struct {
+	// DB is the path to the database, ./tempLogger.db if empty.
+	DB string `json:"db,omitempty"`
+	// Addr is the address to listen on, :8080 if empty.
+	Addr string `json:"addr,omitempty"`
+	// Units is the default temperature unit, F if empty.
+	Units string     `json:"units,omitempty"`
+	Watch []WatchCfg `json:"watch,omitempty"`
+	// Sensors are the sensor definitions, as in the -sensors file.
+	Sensors   []SensorCfg  `json:"sensors,omitempty"`
+	Retention RetentionCfg `json:"retention,omitempty"`
+	// DegreeDays sets the bases of the statistics.
+	DegreeDays DegreeDayCfg `json:"degreeDays,omitempty"`
+	// Alerts are the alert rules and channels, as in the -alerts file.
+	Alerts AlertCfg `json:"alerts,omitempty"`
+	// Auth requires users to sign in and API clients to send a token.
+	Auth bool   `json:"auth,omitempty"`
+	TLS  TLSCfg `json:"tls,omitempty"`
+}
+
+// WatchCfg is a directory tempLogger moves finished log files into.
+type WatchCfg struct {
+	Path string `json:"path"`
+	// Pattern is a glob the file names must match, such as *.log, or a
+	// tempLogger file pattern, such as {id}-{date}.log, to be loaded.
+	// Every file is loaded if it is empty.
+	Pattern string `json:"pattern,omitempty"`
+	// ImportExisting loads the files already in the directory at startup,
+	// for readings that arrived while tlweb was down.
+	ImportExisting bool `json:"importExisting,omitempty"`
+	// Site is the location of the readings in the directory that do not
+	// name one.
+	Site string `json:"site,omitempty"`
+}
+
+// RetentionCfg limits how long readings are kept.  Zero days keeps them
+// forever.
+type RetentionCfg struct {
+	Days int `json:"days,omitempty"`
+	// Sensors overrides Days for the sensors with these ids.
+	Sensors map[string]int `json:"sensors,omitempty"`
+}
+
+// DegreeDayCfg sets the base temperatures of degree days and the threshold
+// the statistics count hours below.  Missing fields use 65°F for both bases
+// and freezing for the threshold; a configured 0 is kept.
+type DegreeDayCfg struct {
+	// Units are the temperature units of the other fields, F if empty.
+	Units       string   `json:"units,omitempty"`
+	HeatingBase *float32 `json:"heatingBase,omitempty"`
+	CoolingBase *float32 `json:"coolingBase,omitempty"`
+	Below       *float32 `json:"below,omitempty"`
+}
+
+// TLSCfg serves HTTPS when Cert and Key are set.
+type TLSCfg struct {
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// ClientCA authorities sign the client certificates that authenticate
+	// like an API token, with ClientRole, viewer if empty.  Loggers
+	// sending readings need the ingest role.
+	ClientCA   string `json:"clientCA,omitempty"`
+	ClientRole string `json:"clientRole,omitempty"`
+	// RedirectAddr listens for plain HTTP to redirect to HTTPS.
+	RedirectAddr string `json:"redirectAddr,omitempty"`
+}
@@ -0,0 +1,88 @@
+package types
+
+import "math"
+
+// Derived psychrometric metrics, computed from temperature and relative
+// humidity rather than stored.
+const (
+	MetricDewPoint    = "dewPoint"
+	MetricAbsHumidity = "absHumidity"
+	MetricVPD         = "vpd"
+)
+
+// Magnus coefficients over water (Alduchov and Eskridge, 1996)
+const (
+	magnusA = 17.625
+	magnusB = 243.04
+	// Saturation vapor pressure at 0 C in kPa
+	magnusC = 0.61094
+)
+
+// SaturationVaporPressure returns the saturation vapor pressure in kPa at
+// tempC.
+func SaturationVaporPressure(tempC float64) float64 {
+	return magnusC * math.Exp(magnusA*tempC/(magnusB+tempC))
+}
+
+// DewPointC returns the dew point in Celsius.  Perfectly dry air has no dew
+// point, so humidity below 0.1% is treated as 0.1%.
+func DewPointC(tempC float64, rh float64) float64 {
+	rh = math.Max(rh, 0.1)
+	gamma := math.Log(rh/100) + magnusA*tempC/(magnusB+tempC)
+	return magnusB * gamma / (magnusA - gamma)
+}
+
+// AbsoluteHumidity returns the water vapor density in g/m^3.
+func AbsoluteHumidity(tempC float64, rh float64) float64 {
+	// Ideal gas law with the specific gas constant of water vapor,
+	// 461.5 J/(kg K), converted from kPa and kg to Pa and g.
+	vaporPressure := SaturationVaporPressure(tempC) * rh / 100 * 1000
+	return vaporPressure / (461.5 * (tempC + 273.15)) * 1000
+}
+
+// VaporPressureDeficit returns the difference between the saturation and
+// actual vapor pressure in kPa.
+func VaporPressureDeficit(tempC float64, rh float64) float64 {
+	return SaturationVaporPressure(tempC) * (1 - rh/100)
+}
+
+// HeatIndexF returns the NWS heat index in Fahrenheit.  It uses Steadman's
+// simple formula, switching to the Rothfusz regression with its humidity
+// adjustments above 80 F, as the DHT sensor libraries do.
+func HeatIndexF(tempF float64, rh float64) float64 {
+	hi := 0.5 * (tempF + 61.0 + ((tempF - 68.0) * 1.2) + (rh * 0.094))
+	if hi <= 79 {
+		return hi
+	}
+	hi = -42.379 +
+		2.04901523*tempF +
+		10.14333127*rh +
+		-0.22475541*tempF*rh +
+		-0.00683783*tempF*tempF +
+		-0.05481717*rh*rh +
+		0.00122874*tempF*tempF*rh +
+		0.00085282*tempF*rh*rh +
+		-0.00000199*tempF*tempF*rh*rh
+	if rh < 13 && tempF >= 80 && tempF <= 112 {
+		hi -= ((13 - rh) * 0.25) * math.Sqrt((17-math.Abs(tempF-95))/17)
+	} else if rh > 85 && tempF >= 80 && tempF <= 87 {
+		hi += ((rh - 85) * 0.1) * ((87 - tempF) * 0.2)
+	}
+	return hi
+}
+
+// FillHeatIndex computes the heat index for readings from devices that do
+// not report it, which arrive with both heat index fields zero.
+func (thd *THData) FillHeatIndex() {
+	if thd.HeatIndexC != 0 || thd.HeatIndexF != 0 {
+		return
+	}
+	thd.setHeatIndex()
+}
+
+// setHeatIndex computes both heat index fields from TempF and Humidity.
+func (thd *THData) setHeatIndex() {
+	hiF := HeatIndexF(float64(thd.TempF), float64(thd.Humidity))
+	thd.HeatIndexF = float32(hiF)
+	thd.HeatIndexC = float32((hiF - 32) * 5 / 9)
+}
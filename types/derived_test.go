@@ -0,0 +1,75 @@
+package types
+
+import (
+	"math"
+	"testing"
+)
+
+func near(a float64, b float64, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance
+}
+
+func TestDewPoint(t *testing.T) {
+	tests := []struct {
+		tempC, rh, dewPoint float64
+	}{
+		{20, 100, 20},
+		{20, 50, 9.3},
+		{30, 70, 23.9},
+		{-5, 80, -7.9},
+	}
+	for _, test := range tests {
+		if dp := DewPointC(test.tempC, test.rh); !near(dp, test.dewPoint, 0.1) {
+			t.Errorf("DewPointC(%g, %g): Expected %g, Actual %g", test.tempC, test.rh, test.dewPoint, dp)
+		}
+	}
+	if dp := DewPointC(20, 0); math.IsNaN(dp) || math.IsInf(dp, 0) {
+		t.Errorf("DewPointC(20, 0): Expected a finite value, Actual %g", dp)
+	}
+}
+
+func TestAbsoluteHumidityAndVPD(t *testing.T) {
+	// 20 C saturated air holds about 17.3 g/m^3 at 2.34 kPa
+	if ah := AbsoluteHumidity(20, 100); !near(ah, 17.3, 0.1) {
+		t.Errorf("AbsoluteHumidity(20, 100): Expected 17.3, Actual %g", ah)
+	}
+	if ah := AbsoluteHumidity(25, 50); !near(ah, 11.5, 0.1) {
+		t.Errorf("AbsoluteHumidity(25, 50): Expected 11.5, Actual %g", ah)
+	}
+	if vpd := VaporPressureDeficit(20, 100); vpd != 0 {
+		t.Errorf("VaporPressureDeficit(20, 100): Expected 0, Actual %g", vpd)
+	}
+	if vpd := VaporPressureDeficit(25, 60); !near(vpd, 1.27, 0.01) {
+		t.Errorf("VaporPressureDeficit(25, 60): Expected 1.27, Actual %g", vpd)
+	}
+}
+
+func TestHeatIndex(t *testing.T) {
+	tests := []struct {
+		tempF, rh, hi float64
+	}{
+		// Values from the NWS heat index chart
+		{90, 50, 95},
+		{100, 40, 109},
+		{86, 90, 105},
+		// Below 80 F the simple formula applies; these match the test logs
+		{27.68, 99.9, 24.84},
+		{70, 50, 69.0},
+	}
+	for _, test := range tests {
+		if hi := HeatIndexF(test.tempF, test.rh); !near(hi, test.hi, 1) {
+			t.Errorf("HeatIndexF(%g, %g): Expected %g, Actual %g", test.tempF, test.rh, test.hi, hi)
+		}
+	}
+
+	thd := THData{TempF: 90, Humidity: 50}
+	thd.FillHeatIndex()
+	if !near(float64(thd.HeatIndexF), 95, 1) || !near(float64(thd.HeatIndexC), 35, 0.6) {
+		t.Errorf("FillHeatIndex: Unexpected heat index %g F, %g C", thd.HeatIndexF, thd.HeatIndexC)
+	}
+	thd = THData{TempF: 90, Humidity: 50, HeatIndexF: 1, HeatIndexC: 2}
+	thd.FillHeatIndex()
+	if thd.HeatIndexF != 1 || thd.HeatIndexC != 2 {
+		t.Error("FillHeatIndex replaced a reported heat index")
+	}
+}
@@ -0,0 +1,142 @@
+package types
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Fields of a log file pattern
+const (
+	FieldID   = "{id}"
+	FieldHost = "{host}"
+	FieldDate = "{date}"
+	FieldHour = "{hour}"
+)
+
+// fieldPatterns are what each field matches in a file name.
+var fieldPatterns = map[string]string{
+	FieldID:   `[A-Za-z_][A-Za-z0-9_]*`,
+	FieldHost: `[A-Za-z0-9_.-]+`,
+	FieldDate: `[0-9]{8}`,
+	FieldHour: `[0-9]{2}`,
+}
+
+var fieldRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+var sensorID = regexp.MustCompile("^" + fieldPatterns[FieldID] + "$")
+
+// ValidSensorID reports whether id can name a sensor, which tlweb uses as a
+// table name.  The separator of sites is kept out so that a sensor without
+// a site cannot take the key of one at a site.
+func ValidSensorID(id string) bool {
+	return sensorID.MatchString(id) && !strings.Contains(id, SiteSeparator) && !ReservedName(id)
+}
+
+// sqlKeywords are the SQLite keywords, which cannot be table names without
+// quoting.
+var sqlKeywords = make(map[string]bool)
+
+func init() {
+	for _, keyword := range strings.Fields(`abort action add after all alter always analyze and as asc
+		attach autoincrement before begin between by cascade case cast check collate column commit
+		conflict constraint create cross current current_date current_time current_timestamp database
+		default deferrable deferred delete desc detach distinct do drop each else end escape except
+		exclude exclusive exists explain fail filter first following for foreign from full generated
+		glob group groups having if ignore immediate in index indexed initially inner insert instead
+		intersect into is isnull join key last left like limit match materialized natural no not
+		nothing notnull null nulls of offset on or order others outer over partition plan pragma
+		preceding primary query raise range recursive references regexp reindex release rename replace
+		restrict returning right rollback row rows savepoint select set table temp temporary then ties
+		to transaction trigger unbounded union unique update using vacuum values view virtual when
+		where window with without`) {
+		sqlKeywords[keyword] = true
+	}
+}
+
+// internalTables are the tables tlweb keeps for itself.
+var internalTables = map[string]bool{
+	"tltables":      true,
+	"tlcalibration": true,
+	"tluser":        true,
+	"tlsession":     true,
+	"tltoken":       true,
+	"tlalert":       true,
+	"tlalertevent":  true,
+}
+
+// ReservedName reports whether name is kept from sensors: tlweb's own
+// tables, SQLite's, which start with sqlite_, and keywords, which are not
+// table names.  Table names ignore case, and so does this.
+func ReservedName(name string) bool {
+	name = strings.ToLower(name)
+	return internalTables[name] || strings.HasPrefix(name, "sqlite_") || sqlKeywords[name]
+}
+
+// ValidateFilePattern checks that a log file pattern names a file in one
+// directory, with at least a new file each day.  {id} is the sensor, {host}
+// the machine it is logged on, {date} the day as YYYYMMDD and {hour} the
+// hour as HH, for a new file every hour.
+func ValidateFilePattern(pattern string) error {
+	if strings.ContainsAny(pattern, `/\`) {
+		return fmt.Errorf("ValidateFilePattern: Must be a file name, not a path: %q", pattern)
+	}
+	for _, field := range fieldRegexp.FindAllString(pattern, -1) {
+		if _, ok := fieldPatterns[field]; !ok {
+			return fmt.Errorf("ValidateFilePattern: Unknown field %s; must be %s, %s, %s or %s", field, FieldID, FieldHost, FieldDate, FieldHour)
+		}
+	}
+	if !strings.Contains(pattern, FieldDate) {
+		return fmt.Errorf("ValidateFilePattern: Must contain %s: %q", FieldDate, pattern)
+	}
+	return nil
+}
+
+// FormatFileName fills in a log file pattern for a reading of sensor id on
+// host taken at ts, in the zone of ts.
+func FormatFileName(pattern string, id string, host string, ts time.Time) string {
+	return strings.NewReplacer(
+		FieldID, id,
+		FieldHost, host,
+		FieldDate, ts.Format("20060102"),
+		FieldHour, ts.Format("15"),
+	).Replace(pattern)
+}
+
+// IsFilePattern reports whether pattern has fields, rather than being a
+// glob.
+func IsFilePattern(pattern string) bool {
+	return fieldRegexp.MatchString(pattern)
+}
+
+// FilePatternRegexp returns an expression matching the names of the files a
+// pattern produces.
+func FilePatternRegexp(pattern string) (re *regexp.Regexp, err error) {
+	if err = ValidateFilePattern(pattern); err != nil {
+		err = fmt.Errorf("FilePatternRegexp: %w", err)
+		return
+	}
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range fieldRegexp.FindAllStringIndex(pattern, -1) {
+		expr.WriteString(regexp.QuoteMeta(pattern[last:loc[0]]))
+		expr.WriteString("(" + fieldPatterns[pattern[loc[0]:loc[1]]] + ")")
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(pattern[last:]) + "$")
+	return regexp.Compile(expr.String())
+}
+
+// HostName makes a machine name safe to use in a file name.
+func HostName(host string) string {
+	host, _, _ = strings.Cut(host, ".")
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		}
+		return '_'
+	}, host)
+}
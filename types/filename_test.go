@@ -0,0 +1,85 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateFilePattern(t *testing.T) {
+	for pattern, valid := range map[string]bool{
+		"tempLogger-{date}.log":          true,
+		"{host}-{id}-{date}T{hour}.json": true,
+		"{date}":                         true,
+		"tempLogger.log":                 false,
+		"{id}-{hour}.log":                false,
+		"{date}-{sensor}.log":            false,
+		"../{date}.log":                  false,
+	} {
+		if err := ValidateFilePattern(pattern); (err == nil) != valid {
+			t.Errorf("%s: Expected valid %v, got %v", pattern, valid, err)
+		}
+	}
+}
+
+func TestFilePatternRegexp(t *testing.T) {
+	pattern := "{id}.{host}-{date}T{hour}.log"
+	ts := time.Date(2024, 1, 14, 7, 30, 0, 0, time.UTC)
+	name := FormatFileName(pattern, "sensor1", "pi", ts)
+	if name != "sensor1.pi-20240114T07.log" {
+		t.Fatalf("Unexpected file name: %s", name)
+	}
+	re, err := FilePatternRegexp(pattern)
+	if err != nil {
+		t.Fatalf("FilePatternRegexp: %s", err.Error())
+	}
+	for name, match := range map[string]bool{
+		"sensor1.pi-20240114T07.log":     true,
+		"sensor1.pi-20240114T07.log.tmp": false,
+		"sensor1.pi-2024011T07.log":      false,
+		"sensor1xpi-20240114T07.log":     false,
+		"1sensor.pi-20240114T07.log":     false,
+	} {
+		if re.MatchString(name) != match {
+			t.Errorf("%s: Expected match %v", name, match)
+		}
+	}
+	if !IsFilePattern(pattern) || IsFilePattern("tempLogger-*.log") {
+		t.Error("Patterns and globs not told apart")
+	}
+}
+
+func TestValidSensorID(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"sensor1":          true,
+		"_basement":        true,
+		"outside_2":        true,
+		"1sensor":          false,
+		"crawl space":      false,
+		"tltoken":          false,
+		"TLAlert":          false,
+		"tlalertevent":     false,
+		"tlkitchen":        true,
+		"sqlite_sequence":  false,
+		"SQLITE_master":    false,
+		"order":            false,
+		"Select":           false,
+		"x; drop table tl": false,
+	} {
+		if ValidSensorID(id) != valid {
+			t.Errorf("%s: Expected valid %v", id, valid)
+		}
+	}
+}
+
+func TestHostName(t *testing.T) {
+	for host, expected := range map[string]string{
+		"pi":                "pi",
+		"pi.example.com":    "pi",
+		"crawl space/pi":    "crawl_space_pi",
+		"logger-2_basement": "logger-2_basement",
+	} {
+		if name := HostName(host); name != expected {
+			t.Errorf("%s: Expected %s, got %s", host, expected, name)
+		}
+	}
+}
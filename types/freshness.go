@@ -0,0 +1,34 @@
+package types
+
+import "time"
+
+// Freshness describes how up to date the readings of a sensor are.
+type Freshness struct {
+	// Interval is the expected time between readings in seconds.
+	Interval int64 `json:"intervalSeconds"`
+	// Learned is set when Interval was measured from the readings rather
+	// than configured.
+	Learned bool `json:"learned"`
+	// LastSeen is the time of the newest reading, Unix milliseconds, or
+	// zero if there are none.
+	LastSeen int64 `json:"lastSeen"`
+	// Age describes how long ago LastSeen was, such as "3h 12m".
+	Age   string `json:"age"`
+	Stale bool   `json:"stale"`
+}
+
+// Gap is a period with no readings, between the readings at From and To or
+// the edges of the requested range.
+type Gap struct {
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Seconds int64     `json:"seconds"`
+}
+
+// Gaps lists the missing intervals of a sensor over a range.
+type Gaps struct {
+	Sensor string `json:"sensor"`
+	// Interval is the expected time between readings in seconds.
+	Interval int64 `json:"intervalSeconds"`
+	Gaps     []Gap `json:"gaps"`
+}
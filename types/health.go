@@ -0,0 +1,50 @@
+package types
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	HealthOK        = "ok"
+	HealthUnhealthy = "unhealthy"
+)
+
+// HealthCheck is the result of one check of a service dependency.
+type HealthCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Health is the result of all of the checks, ok only if every check is.
+type Health struct {
+	Status string        `json:"status"`
+	Checks []HealthCheck `json:"checks"`
+}
+
+// Add records a check, failed if err is not nil.
+func (h *Health) Add(name string, err error) {
+	check := HealthCheck{Name: name, OK: err == nil}
+	if err != nil {
+		check.Error = err.Error()
+		h.Status = HealthUnhealthy
+	} else if h.Status == "" {
+		h.Status = HealthOK
+	}
+	h.Checks = append(h.Checks, check)
+}
+
+// Err describes the failed checks, or returns nil if there are none.
+func (h Health) Err() error {
+	var failed []string
+	for _, check := range h.Checks {
+		if !check.OK {
+			failed = append(failed, check.Name+": "+check.Error)
+		}
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	return errors.New(strings.Join(failed, "; "))
+}
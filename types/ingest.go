@@ -0,0 +1,20 @@
+package types
+
+// IngestPath is where loggers send readings to tlweb, as lines of JSON like
+// those of a log file.
+const IngestPath = "/api/v1/ingest"
+
+// IngestResult acknowledges a batch of readings sent to IngestPath.
+type IngestResult struct {
+	// Acked is how many lines, from the start of the batch, tlweb has
+	// stored or rejected for good.  The sender may forget them and resend
+	// the rest.
+	Acked      int `json:"acked"`
+	Inserted   int `json:"inserted"`
+	Duplicates int `json:"duplicates"`
+	// Rejected lines could not be parsed or stored and are not retried.
+	Rejected int `json:"rejected"`
+	// RejectedLines are the numbers, from 1, of the rejected lines, which
+	// the sender should keep aside rather than forget.
+	RejectedLines []int `json:"rejectedLines,omitempty"`
+}
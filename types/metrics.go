@@ -0,0 +1,104 @@
+package types
+
+import (
+	"math"
+	"time"
+)
+
+const MetricHeatIndex = "heatIndex"
+
+// MetricInfo describes a metric that is summarized and charted.
+type MetricInfo struct {
+	Name  string `json:"name"`
+	Label string `json:"label"`
+	Unit  string `json:"unit"`
+	// IsTemp is set for metrics shown in the selected temperature unit.
+	IsTemp bool `json:"isTemp"`
+}
+
+// SummaryMetrics are the metrics summarized for every sensor, in display
+// order.
+var SummaryMetrics = []MetricInfo{
+	{Name: MetricTemp, Label: "Temperature", Unit: "F", IsTemp: true},
+	{Name: MetricHumidity, Label: "Humidity", Unit: "%"},
+	{Name: MetricHeatIndex, Label: "Heat Index", Unit: "F", IsTemp: true},
+	{Name: MetricDewPoint, Label: "Dew Point", Unit: "F", IsTemp: true},
+	{Name: MetricAbsHumidity, Label: "Absolute Humidity", Unit: "g/m³"},
+	{Name: MetricVPD, Label: "Vapor Pressure Deficit", Unit: "kPa"},
+}
+
+// MetricsIn returns SummaryMetrics with temperatures in unit.
+func MetricsIn(unit string) []MetricInfo {
+	metrics := make([]MetricInfo, len(SummaryMetrics))
+	copy(metrics, SummaryMetrics)
+	for i := range metrics {
+		if metrics[i].IsTemp {
+			metrics[i].Unit = unit
+		}
+	}
+	return metrics
+}
+
+// MetricValue returns the named metric of thd, with temperatures in unit.
+// Derived metrics are rounded to two decimal places.
+func MetricValue(thd THData, metric string, unit string) float32 {
+	tempC, rh := float64(thd.TempC), float64(thd.Humidity)
+	switch metric {
+	case MetricTemp:
+		return TempIn(thd.TempC, thd.TempF, unit)
+	case MetricHumidity:
+		return thd.Humidity
+	case MetricHeatIndex:
+		return TempIn(thd.HeatIndexC, thd.HeatIndexF, unit)
+	case MetricDewPoint:
+		dp := DewPointC(tempC, rh)
+		return TempIn(Round2(dp), Round2(dp*9/5+32), unit)
+	case MetricAbsHumidity:
+		return Round2(AbsoluteHumidity(tempC, rh))
+	case MetricVPD:
+		return Round2(VaporPressureDeficit(tempC, rh))
+	}
+	return 0
+}
+
+// Round2 rounds val to two decimal places.
+func Round2(val float64) float32 {
+	return float32(math.Round(val*100) / 100)
+}
+
+// MetricStats holds the extremes and latest value of one metric, with its
+// mean, standard deviation and percentiles weighted by the time each
+// reading stands for.
+type MetricStats struct {
+	Max    TempRecord `json:"max"`
+	Min    TempRecord `json:"min"`
+	Last   TempRecord `json:"last"`
+	Mean   float32    `json:"mean"`
+	StdDev float32    `json:"stdDev"`
+	P5     float32    `json:"p5"`
+	Median float32    `json:"median"`
+	P95    float32    `json:"p95"`
+}
+
+// ChartPoint holds every charted metric of one reading.
+type ChartPoint struct {
+	Date        int64   `json:"date"`
+	Temp        float32 `json:"temp"`
+	Humidity    float32 `json:"humidity"`
+	HeatIndex   float32 `json:"heatIndex"`
+	DewPoint    float32 `json:"dewPoint"`
+	AbsHumidity float32 `json:"absHumidity"`
+	VPD         float32 `json:"vpd"`
+}
+
+func NewChartPoint(ts time.Time, thd THData, unit string) ChartPoint {
+	return ChartPoint{
+		Date:        ts.UnixMilli(),
+		Temp:        MetricValue(thd, MetricTemp, unit),
+		Humidity:    MetricValue(thd, MetricHumidity, unit),
+		HeatIndex:   MetricValue(thd, MetricHeatIndex, unit),
+		DewPoint:    MetricValue(thd, MetricDewPoint, unit),
+		AbsHumidity: MetricValue(thd, MetricAbsHumidity, unit),
+		VPD:         MetricValue(thd, MetricVPD, unit),
+	}
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SiteSeparator joins the site and id of a sensor in its key.
+const SiteSeparator = "__"
+
+var siteName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9]*(_[A-Za-z0-9]+)*$`)
+
+// ValidSite reports whether site can name a location.  Sites start the
+// table names of their sensors, so they are letters, digits and single
+// underscores, and must not make a reserved name.
+func ValidSite(site string) bool {
+	return siteName.MatchString(site) && !ReservedName(site+SiteSeparator)
+}
+
+// ValidSensorKey reports whether key is the key of a sensor that ingest
+// would accept: a valid sensor id, alone or after a valid site.
+func ValidSensorKey(key string) bool {
+	if site, id, ok := strings.Cut(key, SiteSeparator); ok {
+		return ValidSite(site) && ValidSensorID(id)
+	}
+	return ValidSensorID(key)
+}
+
+// SensorKey returns the key, and tlweb table, of sensor id at site.  Sensors
+// without a site keep their id, as they were stored before sites.
+func SensorKey(site string, id string) string {
+	if site == "" {
+		return id
+	}
+	return site + SiteSeparator + id
+}
+
+// SensorName returns the id of the sensor with key at site, to show when it
+// has no name.
+func SensorName(site string, key string) string {
+	if site == "" {
+		return key
+	}
+	return strings.TrimPrefix(key, site+SiteSeparator)
+}
+
+// SiteSensor is the newest reading of a sensor on the sites page.
+type SiteSensor struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Color    string `json:"color"`
+	// Latest is the newest reading, nil if there are none.
+	Latest *THData `json:"latest,omitempty"`
+	// Temp is the temperature of Latest in the requested unit.
+	Temp      float32   `json:"temp"`
+	Freshness Freshness `json:"freshness"`
+}
+
+// SiteOverview is every sensor of a site.  Sensors without a site are under
+// an empty Site.
+type SiteOverview struct {
+	Site    string       `json:"site"`
+	Sensors []SiteSensor `json:"sensors"`
+	// Stale counts the sensors whose readings are overdue.
+	Stale int `json:"stale"`
+}
+
+// SitesPage shows the latest readings of every location.
+type SitesPage struct {
+	Unit  string         `json:"unit"`
+	Units []string       `json:"units"`
+	Sites []SiteOverview `json:"sites"`
+}
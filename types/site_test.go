@@ -0,0 +1,51 @@
+package types
+
+import "testing"
+
+func TestValidSite(t *testing.T) {
+	for site, valid := range map[string]bool{
+		"cabin":       true,
+		"lake_house":  true,
+		"lake__house": false,
+		"cabin_":      false,
+		"_cabin":      false,
+		"tlhome":      true,
+		"sqlite":      false,
+	} {
+		if ValidSite(site) != valid {
+			t.Errorf("%s: Expected valid %v", site, valid)
+		}
+	}
+}
+
+func TestValidSensorKey(t *testing.T) {
+	for key, valid := range map[string]bool{
+		"sensor1":         true,
+		"cabin__sensor1":  true,
+		"lake_house__s_1": true,
+		"cabin__":         false,
+		"__sensor1":       false,
+		"cabin__tltoken":  false,
+		"cabin__a__b":     false,
+		"order":           false,
+		"sensor 1":        false,
+	} {
+		if ValidSensorKey(key) != valid {
+			t.Errorf("%s: Expected valid %v", key, valid)
+		}
+	}
+}
+
+func TestSensorKeyCollision(t *testing.T) {
+	// A bare id that looks like a key at a site would share its table
+	key := SensorKey("cabin", "sensor1")
+	if ValidSensorID(key) {
+		t.Errorf("%s: Expected a key at a site to be refused as a sensor id", key)
+	}
+	if ValidSensorID("cabin___sensor1") || !ValidSensorID("_sensor1") {
+		t.Error("Separators in sensor ids not told apart")
+	}
+	if key != "cabin__sensor1" || SensorName("cabin", key) != "sensor1" {
+		t.Errorf("Unexpected key %s", key)
+	}
+}
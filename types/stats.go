@@ -0,0 +1,102 @@
+package types
+
+import "time"
+
+// Statistics periods
+const (
+	PeriodDay   = "day"
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	// PeriodSeason is a meteorological season: winter starts in December,
+	// spring in March, summer in June and autumn in September.
+	PeriodSeason = "season"
+)
+
+var Periods = []string{PeriodDay, PeriodWeek, PeriodMonth, PeriodSeason}
+
+// Comparisons of a range with an earlier one
+const (
+	// ComparePrevious is the same number of periods just before.
+	ComparePrevious = "previous"
+	// CompareYear is the same range a year before.
+	CompareYear = "year"
+)
+
+var Comparisons = []string{ComparePrevious, CompareYear}
+
+// PeriodStats are the temperature statistics of one day, week, month or
+// season.  The other fields are zero when Count is.
+//
+// Each reading stands for the time until the next one, or one interval of
+// the sensor when the next is missing, so uneven sampling does not skew the
+// mean, degree days and hours.
+type PeriodStats struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	// Count is the number of readings.
+	Count int     `json:"count"`
+	Min   float32 `json:"min"`
+	Max   float32 `json:"max"`
+	Mean  float32 `json:"mean"`
+	// Coverage is the percentage of the period the readings stand for.
+	Coverage float32 `json:"coverage"`
+	// HeatingDegreeDays and CoolingDegreeDays are how far the temperature
+	// was below the heating base, and above the cooling base, integrated
+	// over time, in degree days of the unit.
+	HeatingDegreeDays float32 `json:"heatingDegreeDays"`
+	CoolingDegreeDays float32 `json:"coolingDegreeDays"`
+	// HoursBelow is the time the temperature was below the threshold of
+	// SensorStats.
+	HoursBelow         float32 `json:"hoursBelow"`
+	HoursBelowFreezing float32 `json:"hoursBelowFreezing"`
+	// LongestFreezeHours is the longest continuous time below freezing
+	// that overlaps the period, with its start.  It may run into the
+	// periods before and after.
+	LongestFreezeHours float32    `json:"longestFreezeHours"`
+	LongestFreezeStart *time.Time `json:"longestFreezeStart,omitempty"`
+}
+
+// SensorStats are the statistics of a sensor over a range, by period.
+type SensorStats struct {
+	Sensor string `json:"sensor"`
+	Site   string `json:"site,omitempty"`
+	Name   string `json:"name"`
+	Color  string `json:"color"`
+	Unit   string `json:"unit"`
+	Period string `json:"period"`
+	// HeatingBase and CoolingBase are the base temperatures of the degree
+	// days, and Below the threshold of HoursBelow, in Unit.
+	HeatingBase float32 `json:"heatingBase"`
+	CoolingBase float32 `json:"coolingBase"`
+	Below       float32 `json:"below"`
+	// Periods cover the range, the first and last extended to whole
+	// periods.
+	Periods []PeriodStats `json:"periods"`
+	// Compare holds the periods of the earlier range, where Compare[i] is
+	// compared with Periods[i].
+	Compare []PeriodStats `json:"compare,omitempty"`
+}
+
+// StatsPage shows the statistics of the sensors over a range.
+type StatsPage struct {
+	Label       string        `json:"label"`
+	Range       string        `json:"range"`
+	FromInput   string        `json:"fromInput"`
+	ToInput     string        `json:"toInput"`
+	Presets     []RangePreset `json:"presets"`
+	Period      string        `json:"period"`
+	Periods     []string      `json:"periods"`
+	Compare     string        `json:"compare"`
+	Comparisons []string      `json:"comparisons"`
+	HeatingBase float32       `json:"heatingBase"`
+	CoolingBase float32       `json:"coolingBase"`
+	Below       float32       `json:"below"`
+	// Sensor is the sensor shown, every one if empty, of Sensors.
+	Sensor  string      `json:"sensor"`
+	Sensors []SensorCfg `json:"sensors"`
+	Unit    string      `json:"unit"`
+	Units   []string    `json:"units"`
+	// CSVURL downloads the statistics shown.
+	CSVURL string        `json:"csvURL"`
+	Stats  []SensorStats `json:"stats"`
+}
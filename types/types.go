@@ -1,10 +1,5 @@
 package types
 
-import (
-	"fmt"
-	"time"
-)
-
 type THData struct {
 	ID         string  `json:"id"`
 	TimeStamp  string  `json:"timestamp"`
@@ -13,13 +8,92 @@ type THData struct {
 	TempF      float32 `json:"tempF"`
 	HeatIndexC float32 `json:"heatIndexC"`
 	HeatIndexF float32 `json:"heatIndexF"`
+	// Site is where the sensor is, empty for a logger without one.
+	Site string `json:"site,omitempty"`
 }
 
+// TLCfgVersion is the current version of the tempLogger configuration.
+// Files without a version are the original flat format, which is still
+// read.
+const TLCfgVersion = 2
+
+// Sink types
+const (
+	SinkFile   = "file"
+	SinkStdout = "stdout"
+	SinkHTTP   = "http"
+)
+
+// TLCfg is the contents of the tempLogger configuration file.
 type TLCfg struct {
-	ID         string
-	SerialPath string
-	Baud       int
-	Retries    int
+	Version int `json:"version"`
+	// ID names the sensor in every reading and is its table in tlweb.
+	ID string `json:"id"`
+	// Site names the location of the logger, so sensors with the same id
+	// at different sites are kept apart in tlweb.  It is optional.
+	Site   string    `json:"site,omitempty"`
+	Serial SerialCfg `json:"serial"`
+	Output OutputCfg `json:"output"`
+	// Sinks are where readings are written, a file if empty.
+	Sinks []SinkCfg `json:"sinks,omitempty"`
+}
+
+// SerialCfg is the port of the sensor.  The zero values of the optional
+// fields are the settings of the Arduino the logger was written for.
+type SerialCfg struct {
+	Path string `json:"path"`
+	// Baud is 9600 if zero.
+	Baud int `json:"baud,omitempty"`
+	// DataBits is 8 if zero.
+	DataBits int `json:"dataBits,omitempty"`
+	// Parity is none, odd, even, mark or space; none if empty.
+	Parity string `json:"parity,omitempty"`
+	// StopBits is 1, 1.5 or 2; 1 if zero.
+	StopBits float32 `json:"stopBits,omitempty"`
+	// ReadTimeoutSeconds is how long a read may wait for data before the
+	// port is reopened, up to 25.  Reads wait forever if it is zero.
+	ReadTimeoutSeconds int `json:"readTimeoutSeconds,omitempty"`
+	// Retries is how many times opening the port is retried, 10 seconds
+	// apart, before giving up.
+	Retries int `json:"retries,omitempty"`
+}
+
+// OutputCfg is where the daily log files are written.
+type OutputCfg struct {
+	// Dir is the directory of the files, the working directory if empty.
+	Dir string `json:"dir,omitempty"`
+	// FilePattern is the file name, with {id} replaced by the sensor id,
+	// {host} by the name of the machine, {date} by the day as YYYYMMDD
+	// and {hour} by the hour as HH for hourly files;
+	// tempLogger-{date}.log if empty.  Loggers sharing a directory need
+	// {id} or {host} in their patterns.
+	FilePattern string `json:"filePattern,omitempty"`
+	// Timezone is the IANA zone the day and hour are taken in, local time
+	// if empty.  UTC rolls over at the same time all year, where local
+	// days can be 23 or 25 hours long.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// SinkCfg is a destination of the readings.  The other fields are for
+// the http sink, which sends readings to tlweb.
+type SinkCfg struct {
+	Type string `json:"type"`
+	// URL is the address of tlweb, such as https://tlweb.example.com:8443.
+	URL string `json:"url,omitempty"`
+	// Token is an API token with the ingest role.
+	Token string `json:"token,omitempty"`
+	// CA is a file of the authorities that sign the certificate of tlweb,
+	// the system ones if empty.
+	CA string `json:"ca,omitempty"`
+	// Cert and Key are a client certificate to authenticate with instead
+	// of a token.
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+	// Outbox is the file readings wait in until tlweb acknowledges them,
+	// {id}.outbox if empty.
+	Outbox string `json:"outbox,omitempty"`
+	// BatchSize is the most readings sent in one request, 500 if zero.
+	BatchSize int `json:"batchSize,omitempty"`
 }
 
 type TempRecord struct {
@@ -27,27 +101,90 @@ type TempRecord struct {
 	Value float32 `json:"value"`
 }
 
-func (tr *TempRecord) FromTHData(thd THData) error {
-	tmpTime, err := time.Parse(time.RFC3339, thd.TimeStamp)
-	if err != nil {
-		err = fmt.Errorf("FromTHData: Timestamp parse error: %s: %w",
-			thd.TimeStamp, err)
-		return err
-	}
-	tr.Date = tmpTime.UnixMilli()
-	tr.Value = thd.TempF
-	return nil
+// SensorCfg is the registry entry of a sensor: how tlweb presents it and
+// the calibrations applied to its readings.  Sensors are shown in ascending
+// Order.
+type SensorCfg struct {
+	// ID is the key of the sensor: its id, or site__id for a sensor at a
+	// site.
+	ID string `json:"id"`
+	// Site groups the sensor with the others at its location.
+	Site        string `json:"site,omitempty"`
+	Name        string `json:"name"`
+	Location    string `json:"location"`
+	Color       string `json:"color"`
+	Order       int    `json:"order"`
+	InstallDate string `json:"installDate,omitempty"`
+	Hardware    string `json:"hardware,omitempty"`
+	// IntervalSeconds is the expected time between readings.  It is
+	// learned from the readings if zero.
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// StaleAfterMinutes is how old the newest reading may be before the
+	// sensor is shown as stale, three intervals if zero.
+	StaleAfterMinutes int           `json:"staleAfterMinutes,omitempty"`
+	Calibrations      []Calibration `json:"calibrations,omitempty"`
 }
 
 type TLSummary struct {
-	Name     string       `json:"name"`
-	MaxTemp  TempRecord   `json:"max"`
-	MinTemp  TempRecord   `json:"min"`
-	LastTemp TempRecord   `json:"last"`
-	TLData   []TempRecord `json:"tlData"`
+	ID       string `json:"id"`
+	Site     string `json:"site,omitempty"`
+	Name     string `json:"name"`
+	Location string `json:"location"`
+	Color    string `json:"color"`
+	// Metrics holds the statistics of each of SummaryMetrics by name.
+	Metrics   map[string]MetricStats `json:"metrics"`
+	TLData    []ChartPoint           `json:"tlData"`
+	Freshness Freshness              `json:"freshness"`
+	// Coverage is the percentage of the period the readings stand for.
+	Coverage float32 `json:"coverage"`
+	// Gaps are the periods without readings that the chart shows as
+	// breaks.
+	Gaps []Gap `json:"gaps,omitempty"`
+}
+
+// LiveReading is a newly inserted reading pushed to the page.
+type LiveReading struct {
+	Sensor string     `json:"sensor"`
+	Point  ChartPoint `json:"point"`
+}
+
+// RangePreset is a navigation button for a relative time range.
+type RangePreset struct {
+	Label  string `json:"label"`
+	Range  string `json:"range"`
+	Active bool   `json:"active"`
+}
+
+// BaseInterval is the spacing of the chart data as a count of a time unit.
+type BaseInterval struct {
+	TimeUnit string `json:"timeUnit"`
+	Count    int    `json:"count"`
+}
+
+// ErrorPage is shown when a page cannot be displayed.
+type ErrorPage struct {
+	Status  int
+	Title   string
+	Message string
 }
 
 type TLPage struct {
-	Page      string      `json:"page"`
-	Summaries []TLSummary `json:"summaries"`
+	Page         string        `json:"page"`
+	Range        string        `json:"range"`
+	From         int64         `json:"from"`
+	To           int64         `json:"to"`
+	FromInput    string        `json:"fromInput"`
+	ToInput      string        `json:"toInput"`
+	PrevURL      string        `json:"prevURL"`
+	NextURL      string        `json:"nextURL"`
+	Resolution   string        `json:"resolution"`
+	BaseInterval BaseInterval  `json:"baseInterval"`
+	Presets      []RangePreset `json:"presets"`
+	Unit         string        `json:"unit"`
+	Units        []string      `json:"units"`
+	Metrics      []MetricInfo  `json:"metrics"`
+	Summaries    []TLSummary   `json:"summaries"`
+	// Site is the location shown, every one if empty, of Sites.
+	Site  string   `json:"site,omitempty"`
+	Sites []string `json:"sites,omitempty"`
 }
@@ -0,0 +1,50 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Temperature units
+const (
+	UnitC = "C"
+	UnitF = "F"
+	UnitK = "K"
+)
+
+var Units = []string{UnitF, UnitC, UnitK}
+
+// ParseUnit validates a temperature unit, ignoring case.
+func ParseUnit(s string) (unit string, err error) {
+	unit = strings.ToUpper(strings.TrimSpace(s))
+	switch unit {
+	case UnitC, UnitF, UnitK:
+		return
+	}
+	err = fmt.Errorf("ParseUnit: Unknown units: %s", s)
+	return
+}
+
+// TempIn returns a temperature in unit given its Celsius and Fahrenheit
+// values.  The stored Fahrenheit value is used as is rather than being
+// recomputed from Celsius.
+func TempIn(c float32, f float32, unit string) float32 {
+	switch unit {
+	case UnitC:
+		return c
+	case UnitK:
+		return c + 273.15
+	}
+	return f
+}
+
+// ToCelsius converts a temperature in unit to Celsius.
+func ToCelsius(t float32, unit string) float32 {
+	switch unit {
+	case UnitC:
+		return t
+	case UnitK:
+		return t - 273.15
+	}
+	return (t - 32) * 5 / 9
+}